@@ -13,26 +13,46 @@ const (
 	address        = "localhost:8080"
 	secretKey      = ""
 	cryptoKey      = ""
+	traceExporter  = ""
+	traceEndpoint  = "localhost:4317"
 	configPath     = ""
 	grpcAddress    = ""
+	statusAddress  = ""
 	pollInterval   = 2
 	reportInterval = 10
 	rateLimit      = 3
+	dialTimeout    = 5
+	idleTimeout    = 90
+	maxIdleConns   = 10
+	useHTTP2       = false
+	breakerFails   = 5
+	breakerTimeout = 10
 )
 
 type Config struct {
 	Address        string `env:"ADDRESS" json:"address"`
 	SecretKey      string `env:"KEY" json:"secret_key"`
 	CryptoKey      string `env:"CRYPTO_KEY" json:"crypto_key"`
+	TraceExporter  string `env:"TRACE_EXPORTER" json:"trace_exporter"`
+	TraceEndpoint  string `env:"TRACE_ENDPOINT" json:"trace_endpoint"`
 	ConfigPath     string `env:"CONFIG" json:"-"`
 	GRPCAddress    string `env:"GRPC_ADDRESSS" json:"grpc_address"`
+	StatusAddress  string `env:"STATUS_ADDRESS" json:"status_address"`
 	PollInterval   int    `env:"POLL_INTERVAL" json:"poll_interval"`
 	ReportInterval int    `env:"REPORT_INTERVAL" json:"report_interval"`
 	RateLimit      int    `env:"RATE_LIMIT" json:"rate_limit"`
+	DialTimeout    int    `env:"HTTP_DIAL_TIMEOUT" json:"http_dial_timeout"`
+	IdleTimeout    int    `env:"HTTP_IDLE_TIMEOUT" json:"http_idle_timeout"`
+	MaxIdleConns   int    `env:"HTTP_MAX_IDLE_CONNS" json:"http_max_idle_conns"`
+	BreakerFails   int    `env:"BREAKER_FAILURES" json:"breaker_failures"`
+	BreakerTimeout int    `env:"BREAKER_TIMEOUT" json:"breaker_timeout"`
+	HTTP2          bool   `env:"HTTP2" json:"http2"`
 }
 
 func NewConfig(params []string) (Config, error) {
 	cnf := Config{
+		TraceExporter:  traceExporter,
+		TraceEndpoint:  traceEndpoint,
 		Address:        address,
 		SecretKey:      secretKey,
 		CryptoKey:      cryptoKey,
@@ -40,6 +60,13 @@ func NewConfig(params []string) (Config, error) {
 		ReportInterval: reportInterval,
 		RateLimit:      rateLimit,
 		GRPCAddress:    grpcAddress,
+		DialTimeout:    dialTimeout,
+		IdleTimeout:    idleTimeout,
+		MaxIdleConns:   maxIdleConns,
+		HTTP2:          useHTTP2,
+		StatusAddress:  statusAddress,
+		BreakerFails:   breakerFails,
+		BreakerTimeout: breakerTimeout,
 	}
 
 	if err := cnf.initConfig(params); err != nil {
@@ -65,9 +92,18 @@ func (cnf *Config) initFlags(params []string) error {
 	f.StringVar(&cnf.ConfigPath, "c", cnf.ConfigPath, "path to file with config")
 	f.StringVar(&cnf.ConfigPath, "config", cnf.ConfigPath, "path to file with config")
 	f.StringVar(&cnf.GRPCAddress, "grpc-addr", cnf.GRPCAddress, "GRPC address")
+	f.StringVar(&cnf.TraceExporter, "trace-exporter", cnf.TraceExporter, "trace exporter: stdout or otlp, empty to disable")
+	f.StringVar(&cnf.TraceEndpoint, "trace-endpoint", cnf.TraceEndpoint, "OTLP gRPC collector address")
 	f.IntVar(&cnf.PollInterval, "p", cnf.PollInterval, "poll interval")
 	f.IntVar(&cnf.ReportInterval, "r", cnf.ReportInterval, "report interval")
 	f.IntVar(&cnf.RateLimit, "l", cnf.RateLimit, "rate limit")
+	f.IntVar(&cnf.DialTimeout, "http-dial-timeout", cnf.DialTimeout, "HTTP dial timeout in seconds")
+	f.IntVar(&cnf.IdleTimeout, "http-idle-timeout", cnf.IdleTimeout, "HTTP keep-alive idle timeout in seconds")
+	f.IntVar(&cnf.MaxIdleConns, "http-max-idle-conns", cnf.MaxIdleConns, "HTTP max idle connections")
+	f.StringVar(&cnf.StatusAddress, "status-addr", cnf.StatusAddress, "local address of the status and /debug/vars endpoints, empty to disable")
+	f.IntVar(&cnf.BreakerFails, "breaker-failures", cnf.BreakerFails, "consecutive failed reports that open the circuit breaker")
+	f.IntVar(&cnf.BreakerTimeout, "breaker-timeout", cnf.BreakerTimeout, "seconds the circuit breaker stays open")
+	f.BoolVar(&cnf.HTTP2, "http2", cnf.HTTP2, "use HTTP/2 without TLS (h2c)")
 	if err := f.Parse(params); err != nil {
 		return fmt.Errorf("InitFlags: parse flags fail: %w", err)
 	}
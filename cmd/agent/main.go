@@ -3,14 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/arefev/mtrcstore/internal/agent"
 	"github.com/arefev/mtrcstore/internal/agent/repository"
 	"github.com/arefev/mtrcstore/internal/agent/service"
+	"github.com/arefev/mtrcstore/internal/breaker"
+	"github.com/arefev/mtrcstore/internal/tracing"
 )
 
 var (
@@ -26,30 +30,83 @@ func main() {
 		log.Fatal(err)
 	}
 
+	shutdown, err := tracing.Setup(ctx, tracing.Config{
+		Exporter: config.TraceExporter,
+		Endpoint: config.TraceEndpoint,
+		Service:  "mtrcstore-agent",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	var client service.Sender
 	switch {
 	case config.GRPCAddress != "":
-		client = service.NewGRPCClient(config.GRPCAddress)
+		gc, err := service.NewGRPCClient(config.GRPCAddress, config.RateLimit)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client = gc
 	default:
 		client = service.NewClient(
 			config.SecretKey,
 			config.CryptoKey,
 			"http://"+config.Address+"/updates/",
+			service.HTTPOptions{
+				Timeout:         time.Duration(config.ReportInterval) * time.Second,
+				DialTimeout:     time.Duration(config.DialTimeout) * time.Second,
+				IdleConnTimeout: time.Duration(config.IdleTimeout) * time.Second,
+				MaxIdleConns:    config.MaxIdleConns,
+				HTTP2:           config.HTTP2,
+			},
 		)
 	}
 
-	if err := run(ctx, &config, client); err != nil {
+	err = run(ctx, &config, client)
+
+	if c, ok := client.(io.Closer); ok {
+		if cErr := c.Close(); cErr != nil {
+			log.Printf("main sender close failed: %s", cErr.Error())
+		}
+	}
+
+	if sErr := shutdownTracing(shutdown); sErr != nil {
+		log.Printf("main tracing shutdown failed: %s", sErr.Error())
+	}
+
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// shutdownTracing gives the exporter a moment to send the last spans.
+func shutdownTracing(shutdown tracing.Shutdown) error {
+	const timeout = 5 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return shutdown(ctx)
+}
+
 func run(ctx context.Context, config *Config, sender service.Sender) error {
 	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
 	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer stop()
 
 	storage := repository.NewMemory()
-	report := service.NewReport(&storage, sender)
+	report := service.NewReport(&storage, sender).WithBreaker(breaker.Settings{
+		Threshold:   config.BreakerFails,
+		OpenTimeout: time.Duration(config.BreakerTimeout) * time.Second,
+	})
+
+	if config.StatusAddress != "" {
+		go func() {
+			if err := agent.ServeStatus(ctx, config.StatusAddress, report); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
 
 	worker := agent.Worker{
 		WorkerPool:     service.NewWorkerPool(report, config.RateLimit),
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/arefev/mtrcstore/internal/server/logger"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.uber.org/zap"
+)
+
+// fileStoreInterval keeps the target file storage from writing a snapshot after every batch,
+// its worker is not started and the state is written once on close.
+const fileStoreInterval int = 300
+
+var errEndpoint = errors.New("exactly one of dsn, file and ndjson must be set")
+
+// endpoint is the source or the target of the copy: a database, a file storage or an NDJSON export.
+type endpoint struct {
+	dsn    string
+	file   string
+	ndjson string // path of the export, - for stdin or stdout
+}
+
+type config struct {
+	from     endpoint
+	to       endpoint
+	logLevel string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseFlags(args []string) (config, error) {
+	var c config
+
+	f := flag.NewFlagSet("mtrccopy", flag.ContinueOnError)
+	f.StringVar(&c.from.dsn, "from-dsn", "", "db connection string of the source")
+	f.StringVar(&c.from.file, "from-file", "", "file storage path of the source")
+	f.StringVar(&c.from.ndjson, "from-ndjson", "", "NDJSON export of the source, - for stdin")
+	f.StringVar(&c.to.dsn, "to-dsn", "", "db connection string of the target")
+	f.StringVar(&c.to.file, "to-file", "", "file storage path of the target")
+	f.StringVar(&c.to.ndjson, "to-ndjson", "", "NDJSON export of the target, - for stdout")
+	f.StringVar(&c.logLevel, "l", "error", "log level")
+	if err := f.Parse(args); err != nil {
+		return config{}, fmt.Errorf("parse flags failed: %w", err)
+	}
+
+	for _, e := range []endpoint{c.from, c.to} {
+		if e.count() != 1 {
+			return config{}, errEndpoint
+		}
+	}
+
+	return c, nil
+}
+
+func (e endpoint) count() int {
+	n := 0
+	for _, v := range []string{e.dsn, e.file, e.ndjson} {
+		if v != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// run copies the metrics through the Storage interface, the counters are added to the ones of the target.
+func run(ctx context.Context, args []string) error {
+	c, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+
+	cLog, err := logger.Build(c.logLevel)
+	if err != nil {
+		return fmt.Errorf("logger init failed: %w", err)
+	}
+
+	r, closeSource, err := openSource(ctx, c.from, cLog)
+	if err != nil {
+		return err
+	}
+
+	defer closeSource()
+
+	if c.to.ndjson != "" {
+		w, closeTarget, err := create(c.to.ndjson)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(w, r)
+		return errors.Join(err, closeTarget())
+	}
+
+	target, err := openStorage(c.to, false, cLog)
+	if err != nil {
+		return err
+	}
+
+	res, err := repository.Import(ctx, target, r)
+	if err := errors.Join(err, target.Close()); err != nil {
+		return fmt.Errorf("copy failed: %w", err)
+	}
+
+	cLog.Info("metrics copied", zap.Int("imported", res.Imported), zap.Int("rejected", res.Rejected))
+	fmt.Fprintf(os.Stderr, "imported %d, rejected %d\n", res.Imported, res.Rejected)
+
+	return nil
+}
+
+// openSource returns the source as an NDJSON stream, a storage is exported by a goroutine into a pipe.
+func openSource(ctx context.Context, e endpoint, l *zap.Logger) (io.Reader, func(), error) {
+	if e.ndjson == "-" {
+		return os.Stdin, func() {}, nil
+	}
+
+	if e.ndjson != "" {
+		f, err := os.Open(e.ndjson)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open source failed: %w", err)
+		}
+
+		return f, func() { _ = f.Close() }, nil
+	}
+
+	source, err := openStorage(e, true, l)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := repository.Export(ctx, source, pw)
+		pw.CloseWithError(errors.Join(err, source.Close()))
+	}()
+
+	return pr, func() { _ = pr.Close() }, nil
+}
+
+func openStorage(e endpoint, source bool, l *zap.Logger) (repository.Storage, error) {
+	if e.dsn != "" {
+		db, err := repository.NewDatabaseRep(e.dsn, l)
+		if err != nil {
+			return nil, fmt.Errorf("open storage failed: %w", err)
+		}
+
+		return db, nil
+	}
+
+	if source {
+		if _, err := os.Stat(e.file); err != nil {
+			return nil, fmt.Errorf("open storage failed: %w", err)
+		}
+
+		// the source is only read, the file storage would reset its wal and write a snapshot over it
+		mem, err := repository.LoadFile(e.file, l)
+		if err != nil {
+			return nil, fmt.Errorf("open storage failed: %w", err)
+		}
+
+		return mem, nil
+	}
+
+	file, err := repository.NewFile(fileStoreInterval, e.file, true, l)
+	if err != nil {
+		return nil, fmt.Errorf("open storage failed: %w", err)
+	}
+
+	return file, nil
+}
+
+func create(path string) (io.Writer, func() error, error) {
+	if path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create target failed: %w", err)
+	}
+
+	return f, f.Close, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	export := filepath.Join(dir, "export.ndjson")
+	target := filepath.Join(dir, "target.json")
+
+	require.NoError(t, os.WriteFile(export, []byte(
+		`{"delta":3,"id":"PollCount","type":"counter"}`+"\n"+`{"value":1.5,"id":"Alloc","type":"gauge"}`+"\n",
+	), 0o600))
+
+	ctx := context.Background()
+	require.NoError(t, run(ctx, []string{"-from-ndjson=" + export, "-to-file=" + target}))
+
+	again := filepath.Join(dir, "again.ndjson")
+	require.NoError(t, run(ctx, []string{"-from-file=" + target, "-to-ndjson=" + again}))
+
+	want, err := os.ReadFile(export)
+	require.NoError(t, err)
+	got, err := os.ReadFile(again)
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(got))
+
+	t.Run("source file is not changed", func(t *testing.T) {
+		source := filepath.Join(dir, "source.json")
+		snapshot := []byte(`{"Gauge":{"Alloc":1.5},"Counter":{"PollCount":3},"Seq":1}` + "\n")
+		log := []byte(`{"delta":3,"id":"PollCount","type":"counter","seq":1}` + "\n" +
+			`{"delta":2,"id":"PollCount","type":"counter","seq":2}` + "\n")
+		require.NoError(t, os.WriteFile(source, snapshot, 0o600))
+		require.NoError(t, os.WriteFile(source+".wal", log, 0o600))
+
+		out := filepath.Join(dir, "source.ndjson")
+		require.NoError(t, run(ctx, []string{"-from-file=" + source, "-to-ndjson=" + out}))
+
+		got, err := os.ReadFile(out)
+		require.NoError(t, err)
+		require.Contains(t, string(got), `{"delta":5,"id":"PollCount","type":"counter"}`)
+
+		got, err = os.ReadFile(source)
+		require.NoError(t, err)
+		require.Equal(t, snapshot, got)
+		got, err = os.ReadFile(source + ".wal")
+		require.NoError(t, err)
+		require.Equal(t, log, got)
+	})
+
+	t.Run("missing endpoint", func(t *testing.T) {
+		require.ErrorIs(t, run(ctx, []string{"-from-file=" + target}), errEndpoint)
+	})
+
+	t.Run("missing source file", func(t *testing.T) {
+		require.Error(t, run(ctx, []string{"-from-file=" + filepath.Join(dir, "none.json"), "-to-ndjson=-"}))
+	})
+}
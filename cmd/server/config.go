@@ -16,11 +16,39 @@ const (
 	fileStoragePath string = ""
 	secretKey       string = ""
 	cryptoKey       string = ""
+	traceExporter   string = ""
+	traceEndpoint   string = "localhost:4317"
 	configPath      string = ""
 	trustedSubnet   string = ""
 	grpcAddress     string = ""
+	statsAddress    string = ""
+	graphiteAddress string = ""
+	graphiteRules   string = ""
+	alertRules      string = ""
+	alertWebhook    string = ""
+	forwardConfig   string = ""
+	relayAddress    string = ""
+	relayGRPCAddr   string = ""
+	relayKey        string = ""
+	relayCryptoKey  string = ""
+	relayID         string = ""
+	relayNames      string = ""
+	relayType       string = ""
+	namePattern     string = ""
 	storeInterval   int    = 300
+	maxSeries       int    = 100000
+	maxNameLength   int    = 255
+	maxBatchSize    int    = 10000
+	breakerFailures int    = 5
+	breakerTimeout  int    = 10
+	statsInterval   int    = 0
+	graphiteConns   int    = 100
+	historySize     int    = 60
+	alertInterval   int    = 15
+	staleTTL        int    = 0
+	relayBuffer     int    = 1000
 	restore         bool   = true
+	staleHide       bool   = false
 )
 
 type Config struct {
@@ -30,15 +58,45 @@ type Config struct {
 	FileStoragePath string `env:"FILE_STORAGE_PATH" json:"file_storage_path"`
 	SecretKey       string `env:"KEY" json:"secret_key"`
 	CryptoKey       string `env:"CRYPTO_KEY" json:"crypto_key"`
+	TraceExporter   string `env:"TRACE_EXPORTER" json:"trace_exporter"`
+	TraceEndpoint   string `env:"TRACE_ENDPOINT" json:"trace_endpoint"`
 	ConfigPath      string `env:"CONFIG" json:"-"`
 	TrustedSubnet   string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
 	GRPCAddress     string `env:"GRPC_ADDRESSS" json:"grpc_address"`
+	StatsAddress    string `env:"STATS_ADDRESS" json:"stats_address"`
+	GraphiteAddress string `env:"GRAPHITE_ADDRESS" json:"graphite_address"`
+	GraphiteRules   string `env:"GRAPHITE_RULES" json:"graphite_rules"`
+	AlertRules      string `env:"ALERT_RULES" json:"alert_rules"`
+	AlertWebhook    string `env:"ALERT_WEBHOOK" json:"alert_webhook"`
+	ForwardConfig   string `env:"FORWARD_CONFIG" json:"forward_config"`
+	RelayAddress    string `env:"RELAY_ADDRESS" json:"relay_address"`
+	RelayGRPCAddr   string `env:"RELAY_GRPC_ADDRESS" json:"relay_grpc_address"`
+	RelayKey        string `env:"RELAY_KEY" json:"relay_key"`
+	RelayCryptoKey  string `env:"RELAY_CRYPTO_KEY" json:"relay_crypto_key"`
+	RelayID         string `env:"RELAY_ID" json:"relay_id"`
+	RelayNames      string `env:"RELAY_NAMES" json:"relay_names"`
+	RelayType       string `env:"RELAY_TYPE" json:"relay_type"`
+	NamePattern     string `env:"NAME_PATTERN" json:"name_pattern"`
 	StoreInterval   int    `env:"STORE_INTERVAL" json:"store_interval"`
+	MaxSeries       int    `env:"MAX_SERIES" json:"max_series"`
+	MaxNameLength   int    `env:"MAX_NAME_LENGTH" json:"max_name_length"`
+	MaxBatchSize    int    `env:"MAX_BATCH_SIZE" json:"max_batch_size"`
+	BreakerFailures int    `env:"BREAKER_FAILURES" json:"breaker_failures"`
+	BreakerTimeout  int    `env:"BREAKER_TIMEOUT" json:"breaker_timeout"`
+	StatsInterval   int    `env:"STATS_INTERVAL" json:"stats_interval"`
+	GraphiteConns   int    `env:"GRAPHITE_MAX_CONNS" json:"graphite_max_conns"`
+	HistorySize     int    `env:"DASHBOARD_HISTORY" json:"dashboard_history"`
+	AlertInterval   int    `env:"ALERT_INTERVAL" json:"alert_interval"`
+	StaleTTL        int    `env:"STALE_TTL" json:"stale_ttl"`
+	RelayBuffer     int    `env:"RELAY_BUFFER" json:"relay_buffer"`
 	Restore         bool   `env:"RESTORE" json:"restore"`
+	StaleHide       bool   `env:"STALE_HIDE" json:"stale_hide"`
 }
 
 func NewConfig(params []string) (Config, error) {
 	cnf := Config{
+		TraceExporter:   traceExporter,
+		TraceEndpoint:   traceEndpoint,
 		Address:         address,
 		LogLevel:        logLevel,
 		DatabaseDSN:     databaseDSN,
@@ -50,6 +108,32 @@ func NewConfig(params []string) (Config, error) {
 		Restore:         restore,
 		TrustedSubnet:   trustedSubnet,
 		GRPCAddress:     grpcAddress,
+		NamePattern:     namePattern,
+		MaxSeries:       maxSeries,
+		MaxNameLength:   maxNameLength,
+		MaxBatchSize:    maxBatchSize,
+		BreakerFailures: breakerFailures,
+		BreakerTimeout:  breakerTimeout,
+		StatsAddress:    statsAddress,
+		StatsInterval:   statsInterval,
+		GraphiteAddress: graphiteAddress,
+		GraphiteRules:   graphiteRules,
+		GraphiteConns:   graphiteConns,
+		HistorySize:     historySize,
+		AlertRules:      alertRules,
+		AlertWebhook:    alertWebhook,
+		ForwardConfig:   forwardConfig,
+		RelayAddress:    relayAddress,
+		RelayGRPCAddr:   relayGRPCAddr,
+		RelayKey:        relayKey,
+		RelayCryptoKey:  relayCryptoKey,
+		RelayID:         relayID,
+		RelayNames:      relayNames,
+		RelayType:       relayType,
+		RelayBuffer:     relayBuffer,
+		AlertInterval:   alertInterval,
+		StaleTTL:        staleTTL,
+		StaleHide:       staleHide,
 	}
 
 	if err := cnf.initConfig(params); err != nil {
@@ -79,8 +163,36 @@ func (cnf *Config) initFlags(params []string) error {
 	f.StringVar(&cnf.ConfigPath, "config", cnf.ConfigPath, "path to file with config")
 	f.StringVar(&cnf.TrustedSubnet, "t", cnf.TrustedSubnet, "CIDR")
 	f.StringVar(&cnf.GRPCAddress, "grpc-addr", cnf.GRPCAddress, "GRPC address")
+	f.StringVar(&cnf.TraceExporter, "trace-exporter", cnf.TraceExporter, "trace exporter: stdout or otlp, empty to disable")
+	f.StringVar(&cnf.TraceEndpoint, "trace-endpoint", cnf.TraceEndpoint, "OTLP gRPC collector address")
+	f.StringVar(&cnf.NamePattern, "name-pattern", cnf.NamePattern, "regexp of allowed metric names, empty to allow any")
+	f.StringVar(&cnf.StatsAddress, "stats-addr", cnf.StatsAddress, "address of the stats endpoint in the GRPC mode")
+	f.StringVar(&cnf.GraphiteAddress, "graphite-addr", cnf.GraphiteAddress, "address of the Graphite plaintext listener, empty to disable")
+	f.StringVar(&cnf.GraphiteRules, "graphite-rules", cnf.GraphiteRules, "comma separated pattern=template rules renaming the Graphite paths")
+	f.StringVar(&cnf.AlertRules, "alert-rules", cnf.AlertRules, "path to YAML or JSON file with alert rules, empty to disable")
+	f.StringVar(&cnf.AlertWebhook, "alert-webhook", cnf.AlertWebhook, "URL receiving the alerts that fired or resolved")
+	f.StringVar(&cnf.ForwardConfig, "forward-config", cnf.ForwardConfig, "path to YAML or JSON file with destinations of the saved metrics, empty to disable")
+	f.StringVar(&cnf.RelayAddress, "relay-addr", cnf.RelayAddress, "address and port of the upstream server receiving the relayed metrics over HTTP, empty to disable")
+	f.StringVar(&cnf.RelayGRPCAddr, "relay-grpc-addr", cnf.RelayGRPCAddr, "address and port of the upstream server receiving the relayed metrics over GRPC, empty to disable")
+	f.StringVar(&cnf.RelayKey, "relay-key", cnf.RelayKey, "secret key of the upstream server")
+	f.StringVar(&cnf.RelayCryptoKey, "relay-crypto-key", cnf.RelayCryptoKey, "path to file with public key of the upstream server")
+	f.StringVar(&cnf.RelayID, "relay-id", cnf.RelayID, "unique name of the server in the relay path, the host name by default")
+	f.StringVar(&cnf.RelayNames, "relay-names", cnf.RelayNames, "regular expression of the relayed metric names, empty for all")
+	f.StringVar(&cnf.RelayType, "relay-type", cnf.RelayType, "type of the relayed metrics [counter, gauge], empty for both")
 	f.IntVar(&cnf.StoreInterval, "i", cnf.StoreInterval, "store interval")
+	f.IntVar(&cnf.MaxSeries, "max-series", cnf.MaxSeries, "max number of distinct metrics, 0 to disable")
+	f.IntVar(&cnf.MaxNameLength, "max-name-length", cnf.MaxNameLength, "max metric name length, 0 to disable")
+	f.IntVar(&cnf.MaxBatchSize, "max-batch-size", cnf.MaxBatchSize, "max number of metrics in a batch update, 0 to disable")
+	f.IntVar(&cnf.BreakerFailures, "breaker-failures", cnf.BreakerFailures, "consecutive DB failures that open the circuit breaker")
+	f.IntVar(&cnf.BreakerTimeout, "breaker-timeout", cnf.BreakerTimeout, "seconds the circuit breaker stays open")
+	f.IntVar(&cnf.StatsInterval, "stats-interval", cnf.StatsInterval, "seconds between writes of the server stats into the storage, 0 to disable")
+	f.IntVar(&cnf.GraphiteConns, "graphite-max-conns", cnf.GraphiteConns, "max number of open Graphite connections, 0 to disable")
+	f.IntVar(&cnf.HistorySize, "dashboard-history", cnf.HistorySize, "number of points of a metric kept for the dashboard, 0 to disable")
+	f.IntVar(&cnf.AlertInterval, "alert-interval", cnf.AlertInterval, "seconds between evaluations of the alert rules")
+	f.IntVar(&cnf.RelayBuffer, "relay-buffer", cnf.RelayBuffer, "number of batches kept while the upstream server is unavailable")
+	f.IntVar(&cnf.StaleTTL, "stale-ttl", cnf.StaleTTL, "seconds without updates after which a metric or a source is stale, 0 to disable")
 	f.BoolVar(&cnf.Restore, "r", cnf.Restore, "need restore")
+	f.BoolVar(&cnf.StaleHide, "stale-hide", cnf.StaleHide, "hide the stale metrics instead of flagging them")
 	if err := f.Parse(params); err != nil {
 		return fmt.Errorf("InitFlags: parse flags fail: %w", err)
 	}
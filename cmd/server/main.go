@@ -2,26 +2,56 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
 	"syscall"
+	"time"
 
+	agent "github.com/arefev/mtrcstore/internal/agent/service"
+	"github.com/arefev/mtrcstore/internal/breaker"
 	"github.com/arefev/mtrcstore/internal/proto"
 	"github.com/arefev/mtrcstore/internal/server"
+	"github.com/arefev/mtrcstore/internal/server/alert"
+	"github.com/arefev/mtrcstore/internal/server/dashboard"
+	"github.com/arefev/mtrcstore/internal/server/forward"
 	"github.com/arefev/mtrcstore/internal/server/handler"
+	"github.com/arefev/mtrcstore/internal/server/ingest"
 	"github.com/arefev/mtrcstore/internal/server/logger"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/relay"
 	"github.com/arefev/mtrcstore/internal/server/repository"
 	"github.com/arefev/mtrcstore/internal/server/service"
+	"github.com/arefev/mtrcstore/internal/server/stats"
+	"github.com/arefev/mtrcstore/internal/server/stream"
+	"github.com/arefev/mtrcstore/internal/tracing"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 
 	"go.uber.org/zap"
 )
 
+const traceShutdownTimeout = 5 * time.Second
+
+// timeouts of the requests to the upstream server of the relay.
+const (
+	relayTimeout     = 10 * time.Second
+	relayDialTimeout = 5 * time.Second
+	relayIdleTimeout = 90 * time.Second
+)
+
 var (
 	buildVersion string = "N/A"
 	buildDate    string = "N/A"
@@ -51,7 +81,65 @@ func run(ctx context.Context, args []string) error {
 		return fmt.Errorf("logger init failed: %w", err)
 	}
 
-	storage, err := initStorage(&config, cLog)
+	shutdown, err := tracing.Setup(ctx, tracing.Config{
+		Exporter: config.TraceExporter,
+		Endpoint: config.TraceEndpoint,
+		Service:  "mtrcstore-server",
+	})
+	if err != nil {
+		return fmt.Errorf("tracing init failed: %w", err)
+	}
+
+	defer func() {
+		// the signal context is already done here, the spans get a moment of their own
+		sCtx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+		defer cancel()
+
+		if err := shutdown(sCtx); err != nil {
+			cLog.Error("tracing shutdown failed", zap.Error(err))
+		}
+	}()
+
+	reg := stats.NewRegistry()
+	hub := stream.NewHub()
+	notifiers := []repository.Notifier{hub}
+
+	var history *dashboard.History
+	if config.HistorySize > 0 {
+		history = dashboard.NewHistory(config.HistorySize)
+		notifiers = append(notifiers, history)
+	}
+
+	var forwarder *forward.Forwarder
+	if config.ForwardConfig != "" {
+		destinations, err := forward.Load(config.ForwardConfig)
+		if err != nil {
+			return fmt.Errorf("main run failed: %w", err)
+		}
+
+		forwarder = forward.New(destinations, cLog)
+		notifiers = append(notifiers, forwarder)
+		go forwarder.Run(ctx)
+
+		cLog.Info("Forwarding running", zap.Int("destinations", len(destinations)))
+	}
+
+	var relayer *relay.Relay
+	if config.RelayAddress != "" || config.RelayGRPCAddr != "" {
+		r, closeSender, err := initRelay(&config, cLog)
+		if err != nil {
+			return fmt.Errorf("main run failed: %w", err)
+		}
+		defer closeSender()
+
+		relayer = r
+		notifiers = append(notifiers, relayer)
+		go relayer.Run(ctx)
+
+		cLog.Info("Relay running", zap.String("id", relayer.Status().ID), zap.String("upstream", relayer.Status().Upstream))
+	}
+
+	storage, err := initStorage(ctx, &config, cLog, reg, notifiers...)
 	if err != nil {
 		return fmt.Errorf("main run failed: %w", err)
 	}
@@ -62,24 +150,65 @@ func run(ctx context.Context, args []string) error {
 		}
 	}()
 
+	var alerting *alert.Engine
+	if config.AlertRules != "" {
+		alerting, err = initAlerting(ctx, storage, &config, cLog)
+		if err != nil {
+			return fmt.Errorf("main run failed: %w", err)
+		}
+	}
+
+	if config.GraphiteAddress != "" {
+		gCtx, cancel := context.WithCancel(ctx)
+		wait, err := runGraphite(gCtx, storage, &config, cLog)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("main run failed: %w", err)
+		}
+
+		// the storage is closed after the last Graphite batches are saved,
+		// the listener is stopped first when the server exits on an error
+		defer wait()
+		defer cancel()
+	}
+
 	switch {
 	case config.GRPCAddress != "":
-		return runGRPC(ctx, storage, &config, cLog)
+		return runGRPC(ctx, storage, &config, cLog, reg)
 	default:
-		return runServer(ctx, storage, &config, cLog)
+		metricHandlers := handler.NewMetricHandlers(storage, cLog)
+		metricHandlers.Stats = reg
+		metricHandlers.Hub = hub
+		metricHandlers.History = history
+		metricHandlers.Alerting = alerting
+		metricHandlers.Forwarder = forwarder
+		metricHandlers.Relay = relayer
+		return runServer(ctx, metricHandlers, &config, cLog)
 	}
 }
 
-func runGRPC(ctx context.Context, storage repository.Storage, c *Config, l *zap.Logger) error {
+func runGRPC(ctx context.Context, storage repository.Storage, c *Config, l *zap.Logger, reg *stats.Registry) error {
 	listen, err := net.Listen("tcp", c.GRPCAddress)
 	if err != nil {
 		return fmt.Errorf("runGRPC Listen failed: %w", err)
 	}
 
-	s := grpc.NewServer()
+	if c.StatsAddress != "" {
+		go serveStats(ctx, storage, c.StatsAddress, l, reg)
+	}
+
+	s := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(reg.UnaryInterceptor),
+		grpc.ChainStreamInterceptor(reg.StreamInterceptor),
+	)
 	proto.RegisterMetricsServer(s, &service.GRPCServer{
 		Storage: storage,
 	})
+	colmetrics.RegisterMetricsServiceServer(s, &service.OTLPServer{
+		Storage: storage,
+		OTLP:    ingest.NewOTLP(),
+	})
 
 	go func() {
 		<-ctx.Done()
@@ -100,14 +229,154 @@ func runGRPC(ctx context.Context, storage repository.Storage, c *Config, l *zap.
 	return nil
 }
 
-func runServer(ctx context.Context, storage repository.Storage, c *Config, l *zap.Logger) error {
+// initAlerting loads the alert rules and starts their evaluation, it stops with the context.
+func initAlerting(ctx context.Context, storage repository.Storage, c *Config, l *zap.Logger) (*alert.Engine, error) {
+	if c.AlertInterval <= 0 {
+		return nil, fmt.Errorf("initAlerting failed: alert interval must be positive, got %d", c.AlertInterval)
+	}
+
+	rules, err := alert.Load(c.AlertRules)
+	if err != nil {
+		return nil, fmt.Errorf("initAlerting failed: %w", err)
+	}
+
+	// the alerts of the hidden stale metrics are evaluated with their last values, so they still resolve
+	engine := alert.NewEngine(repository.Unhidden(storage), rules, c.AlertWebhook, l)
+	go engine.Run(ctx, time.Duration(c.AlertInterval)*time.Second)
+
+	l.Info("Alerting running", zap.Int("rules", len(rules)), zap.String("webhook", c.AlertWebhook))
+
+	return engine, nil
+}
+
+// initRelay creates the relay with the sender of the agent, the returned function closes the sender.
+func initRelay(c *Config, l *zap.Logger) (*relay.Relay, func(), error) {
+	id := c.RelayID
+	if id == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, nil, fmt.Errorf("initRelay failed: %w", err)
+		}
+		id = host
+	}
+
+	if strings.Contains(id, ",") {
+		return nil, nil, fmt.Errorf("initRelay failed: relay id %q contains a comma", id)
+	}
+
+	filter := relay.Filter{Type: c.RelayType}
+	if c.RelayType != "" && c.RelayType != repository.CounterName && c.RelayType != repository.GaugeName {
+		return nil, nil, fmt.Errorf("initRelay failed: unknown metric type %q", c.RelayType)
+	}
+
+	if c.RelayNames != "" {
+		names, err := regexp.Compile(c.RelayNames)
+		if err != nil {
+			return nil, nil, fmt.Errorf("initRelay failed: %w", err)
+		}
+		filter.Name = names
+	}
+
+	var sender agent.Sender
+	upstream := c.RelayAddress
+	switch {
+	case c.RelayGRPCAddr != "":
+		gc, err := agent.NewGRPCClient(c.RelayGRPCAddr, 1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("initRelay failed: %w", err)
+		}
+		sender = gc
+		upstream = c.RelayGRPCAddr
+	default:
+		sender = agent.NewClient(c.RelayKey, c.RelayCryptoKey, "http://"+c.RelayAddress+"/updates/", agent.HTTPOptions{
+			Timeout:         relayTimeout,
+			DialTimeout:     relayDialTimeout,
+			IdleConnTimeout: relayIdleTimeout,
+			MaxIdleConns:    1,
+		})
+	}
+
+	closeSender := func() {
+		if closer, ok := sender.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				l.Error("relay sender close failed", zap.Error(err))
+			}
+		}
+	}
+
+	r := relay.New(sender, relay.Options{
+		Filter:   filter,
+		ID:       id,
+		Upstream: upstream,
+		Buffer:   c.RelayBuffer,
+	}, l)
+
+	return r, closeSender, nil
+}
+
+// runGraphite starts the Graphite listener, it stops with the context and the returned function waits for it.
+func runGraphite(ctx context.Context, storage repository.Storage, c *Config, l *zap.Logger) (func(), error) {
+	rules, err := ingest.ParseGraphiteRules(c.GraphiteRules)
+	if err != nil {
+		return nil, fmt.Errorf("runGraphite rules failed: %w", err)
+	}
+
+	listen, err := net.Listen("tcp", c.GraphiteAddress)
+	if err != nil {
+		return nil, fmt.Errorf("runGraphite Listen failed: %w", err)
+	}
+
+	gs := &service.GraphiteServer{
+		Storage:  storage,
+		Graphite: ingest.NewGraphite(rules),
+		Log:      l,
+		MaxConns: c.GraphiteConns,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := gs.Serve(ctx, listen); err != nil {
+			l.Error("graphite server failed", zap.Error(err))
+		}
+		l.Info("Graphite stopped")
+	}()
+
+	l.Info("Graphite running", zap.String("address", c.GraphiteAddress))
+
+	return func() { <-done }, nil
+}
+
+// serveStats exposes the stats endpoint next to the GRPC server, which has no HTTP routes of its own.
+func serveStats(ctx context.Context, storage repository.Storage, addr string, l *zap.Logger, reg *stats.Registry) {
 	metricHandlers := handler.NewMetricHandlers(storage, l)
+	metricHandlers.Stats = reg
+
+	r := chi.NewRouter()
+	r.Get("/admin/stats", metricHandlers.StatsSnapshot)
+
+	serv := http.Server{Addr: addr, Handler: r, ReadHeaderTimeout: time.Second}
+	go func() {
+		<-ctx.Done()
+		if err := serv.Close(); err != nil {
+			l.Error("stats server close failed", zap.Error(err))
+		}
+	}()
+
+	l.Info("Stats running", zap.String("address", addr))
+	if err := serv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		l.Error("stats server failed", zap.Error(err))
+	}
+}
+
+func runServer(ctx context.Context, metricHandlers *handler.MetricHandlers, c *Config, l *zap.Logger) error {
 	r := server.InitRouter(metricHandlers, l, c.TrustedSubnet, c.SecretKey, c.CryptoKey)
 
 	g, gCtx := errgroup.WithContext(ctx)
 	serv := http.Server{
-		Addr:    c.Address,
-		Handler: r,
+		Addr: c.Address,
+		// h2c serves the agents that use HTTP/2 without TLS next to the HTTP/1.1 ones
+		Handler: h2c.NewHandler(r, &http2.Server{}),
 		BaseContext: func(_ net.Listener) context.Context {
 			return gCtx
 		},
@@ -134,23 +403,95 @@ func runServer(ctx context.Context, storage repository.Storage, c *Config, l *za
 	return nil
 }
 
-func initStorage(config *Config, cLog *zap.Logger) (repository.Storage, error) {
+// initStorage picks the backend and wraps it into the decorators,
+// the notifiers receive the metrics that passed the limits and were saved.
+func initStorage(
+	ctx context.Context,
+	config *Config,
+	cLog *zap.Logger,
+	reg *stats.Registry,
+	notifiers ...repository.Notifier,
+) (repository.Storage, error) {
 	var storage repository.Storage
-	var err error
+	var backend string
 
 	switch {
 	case len(config.DatabaseDSN) > 0:
-		storage, err = repository.NewDatabaseRep(config.DatabaseDSN, cLog)
-		if err != nil {
-			err = fmt.Errorf("repository init failed: %w", err)
+		db, dbErr := repository.NewDatabaseRep(config.DatabaseDSN, cLog)
+		if dbErr != nil {
+			return db, fmt.Errorf("repository init failed: %w", dbErr)
 		}
+		storage = db.WithBreaker(breaker.Settings{
+			Threshold:   config.BreakerFailures,
+			OpenTimeout: time.Duration(config.BreakerTimeout) * time.Second,
+		})
+		reg.SetPool(db.PoolStats)
+		backend = "database"
 	case len(config.FileStoragePath) > 0:
-		storage = repository.
-			NewFile(config.StoreInterval, config.FileStoragePath, config.Restore, cLog).
-			WorkerRun()
+		file, fileErr := repository.NewFile(config.StoreInterval, config.FileStoragePath, config.Restore, cLog)
+		if fileErr != nil {
+			return nil, fmt.Errorf("repository init failed: %w", fileErr)
+		}
+		storage = file.WithObserver(reg).WorkerRun(ctx)
+		backend = "file"
 	default:
 		storage = repository.NewMemory()
+		backend = "memory"
 	}
 
-	return storage, err
+	if config.StatsInterval > 0 {
+		go storeStats(ctx, storage, time.Duration(config.StatsInterval)*time.Second, cLog, reg)
+	}
+
+	limits := repository.Limits{
+		NamePattern:    config.NamePattern,
+		MaxSeries:      config.MaxSeries,
+		MaxNameLength:  config.MaxNameLength,
+		MaxBatchSize:   config.MaxBatchSize,
+		ReservedPrefix: stats.Prefix,
+	}
+
+	observed := repository.NewObserved(storage, backend, reg)
+	var inner repository.Storage = repository.NewNotified(observed, notifiers...)
+	if config.StaleTTL > 0 {
+		stale, err := repository.NewStale(inner, repository.Staleness{
+			TTL:  time.Duration(config.StaleTTL) * time.Second,
+			Hide: config.StaleHide,
+		})
+		if err != nil {
+			return storage, errors.Join(fmt.Errorf("storage staleness init failed: %w", err), storage.Close())
+		}
+		inner = stale
+	}
+
+	limited, err := repository.NewLimited(ctx, inner, limits)
+	if err != nil {
+		return storage, errors.Join(fmt.Errorf("storage limits init failed: %w", err), storage.Close())
+	}
+
+	return limited, nil
+}
+
+// storeStats periodically saves the stats as gauges under the reserved prefix,
+// they are written past the limits, which reject the prefix for the clients.
+func storeStats(ctx context.Context, storage repository.Storage, interval time.Duration, l *zap.Logger, reg *stats.Registry) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			gauges := reg.Snapshot().Gauges()
+			elems := make([]model.Metric, 0, len(gauges))
+			for name, value := range gauges {
+				elems = append(elems, model.Metric{ID: name, MType: repository.GaugeName, Value: &value})
+			}
+
+			if err := storage.MassSave(ctx, elems); err != nil {
+				l.Error("store stats failed", zap.Error(err))
+			}
+		}
+	}
 }
@@ -1,26 +1,52 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/arefev/mtrcstore/internal/proto/prompb"
 	"github.com/arefev/mtrcstore/internal/server"
+	"github.com/arefev/mtrcstore/internal/server/alert"
+	"github.com/arefev/mtrcstore/internal/server/dashboard"
+	"github.com/arefev/mtrcstore/internal/server/forward"
 	"github.com/arefev/mtrcstore/internal/server/handler"
+	"github.com/arefev/mtrcstore/internal/server/ingest"
 	"github.com/arefev/mtrcstore/internal/server/logger"
 	mock_repository "github.com/arefev/mtrcstore/internal/server/mocks"
 	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/relay"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/arefev/mtrcstore/internal/server/stats"
+	"github.com/arefev/mtrcstore/internal/server/stream"
+	"github.com/arefev/mtrcstore/internal/tracing"
 	"github.com/go-resty/resty/v2"
 	"github.com/golang/mock/gomock"
+	"github.com/klauspost/compress/snappy"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
 )
 
 func Test_Get(t *testing.T) {
@@ -82,11 +108,8 @@ func Test_Get(t *testing.T) {
 			require.Equal(t, http.StatusOK, res.StatusCode())
 
 			for k, v := range test.want.value {
-				require.Contains(
-					t,
-					string(res.Body()),
-					fmt.Sprintf("<li><strong>%s</strong>: %s</li>", k, v),
-				)
+				require.Contains(t, string(res.Body()), fmt.Sprintf(`<td class="name">%s</td>`, k))
+				require.Contains(t, string(res.Body()), fmt.Sprintf(`<td class="value">%s</td>`, v))
 			}
 		})
 	}
@@ -137,7 +160,7 @@ func Test_UpdateShortUrl(t *testing.T) {
 					ID:    "PollCounter",
 					MType: "counter",
 				},
-				err:        errors.New("saved failed"),
+				err:        repository.ErrInvalid,
 				statusCode: http.StatusBadRequest,
 			},
 		},
@@ -281,11 +304,37 @@ func Test_UpdateFullUrl(t *testing.T) {
 					MType: "gauge",
 					Value: &value,
 				},
-				err:        errors.New("saved failed"),
+				err:        repository.ErrInvalid,
 				urlPath:    "/update/gauge/Alloc/1.55",
 				statusCode: http.StatusBadRequest,
 			},
 		},
+		{
+			name: "service unavailable when storage is down",
+			want: want{
+				metric: model.Metric{
+					ID:    "Alloc",
+					MType: "gauge",
+					Value: &value,
+				},
+				err:        repository.ErrUnavailable,
+				urlPath:    "/update/gauge/Alloc/1.55",
+				statusCode: http.StatusServiceUnavailable,
+			},
+		},
+		{
+			name: "internal error when storage fails",
+			want: want{
+				metric: model.Metric{
+					ID:    "Alloc",
+					MType: "gauge",
+					Value: &value,
+				},
+				err:        errors.New("saved failed"),
+				urlPath:    "/update/gauge/Alloc/1.55",
+				statusCode: http.StatusInternalServerError,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -373,7 +422,7 @@ func Test_FindShortUrl(t *testing.T) {
 					ID:    "PollCounter",
 					MType: "counter",
 				},
-				err:        errors.New("not found"),
+				err:        repository.ErrNotFound,
 				statusCode: http.StatusNotFound,
 			},
 		},
@@ -472,7 +521,7 @@ func Test_FindFullUrl(t *testing.T) {
 					MType: "counter",
 					Delta: &delta,
 				},
-				err:        errors.New("not found"),
+				err:        repository.ErrNotFound,
 				urlPath:    "/value/counter/PollCounter",
 				statusCode: http.StatusNotFound,
 			},
@@ -544,6 +593,7 @@ func TestConfigSuccess(t *testing.T) {
 		conf, err := NewConfig(args)
 		require.NoError(t, err)
 		require.Equal(t, logLevel, conf.LogLevel)
+		require.Empty(t, conf.NamePattern)
 	})
 }
 
@@ -688,6 +738,11 @@ func Test_MassUpdate(t *testing.T) {
 			if test.want.err == nil {
 				require.Contains(t, string(res.Body()), "Mass save successful!")
 			}
+
+			h.Reset()
+			_, err = h.Write(res.Body())
+			require.NoError(t, err)
+			require.Equal(t, hex.EncodeToString(h.Sum(nil)), res.Header().Get("HashSHA256"))
 		})
 	}
 }
@@ -720,3 +775,1028 @@ func TestServerRunWithFile(t *testing.T) {
 		require.FileExists(t, "./storage.json")
 	})
 }
+
+func Test_Snapshot(t *testing.T) {
+	t.Run("snapshot not implemented by storage", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		storage := mock_repository.NewMockStorage(ctrl)
+
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		metricHandlers := handler.NewMetricHandlers(storage, cLog)
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		res, err := resty.New().R().Post(srv.URL + "/admin/snapshot")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, res.StatusCode())
+	})
+
+	t.Run("snapshot success", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage.json")
+		storage, err := repository.NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, storage.Close())
+		}()
+
+		metricHandlers := handler.NewMetricHandlers(storage, cLog)
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		res, err := resty.New().R().Post(srv.URL + "/admin/snapshot")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.FileExists(t, path)
+	})
+}
+
+func Test_MassUpdatePartial(t *testing.T) {
+	t.Run("mass update saves the valid metrics", func(t *testing.T) {
+		ctx := context.Background()
+		storage, err := repository.NewLimited(ctx, repository.NewMemory(), repository.Limits{
+			NamePattern: `^[A-Za-z]+$`,
+		})
+		require.NoError(t, err)
+
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		metricHandlers := handler.NewMetricHandlers(storage, cLog)
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		var result model.BatchResult
+		res, err := resty.New().R().
+			SetBody(`[{"id":"Alloc","type":"gauge","value":1},{"id":"Alloc Sys","type":"gauge","value":1}]`).
+			SetResult(&result).
+			Post(srv.URL + "/updates/?partial=true")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, 1, result.Accepted)
+		require.Equal(t, 1, result.Rejected)
+		require.Equal(t, model.ResultRejected, result.Results[1].Status)
+
+		_, err = storage.Find(ctx, "Alloc", repository.GaugeName)
+		require.NoError(t, err)
+	})
+}
+
+func Test_Limits(t *testing.T) {
+	tests := []struct {
+		name       string
+		urlPath    string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "invalid name",
+			urlPath:    "/update/gauge/Alloc%20Sys/1",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "empty name",
+			urlPath:    "/update/",
+			body:       `{"id":"","type":"gauge","value":1}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "batch is too large",
+			urlPath:    "/updates/",
+			body:       `[{"id":"A","type":"gauge","value":1},{"id":"B","type":"gauge","value":1},{"id":"C","type":"gauge","value":1}]`,
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "series limit exceeded",
+			urlPath:    "/updates/",
+			body:       `[{"id":"A","type":"gauge","value":1},{"id":"B","type":"gauge","value":1}]`,
+			statusCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage, err := repository.NewLimited(ctx, repository.NewMemory(), repository.Limits{
+				NamePattern:  `^[A-Za-z]+$`,
+				MaxSeries:    1,
+				MaxBatchSize: 2,
+			})
+			require.NoError(t, err)
+
+			cLog, err := logger.Build("debug")
+			require.NoError(t, err)
+
+			metricHandlers := handler.NewMetricHandlers(storage, cLog)
+
+			r := server.InitRouter(metricHandlers, cLog, "", "", "")
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			res, err := resty.New().R().SetBody(test.body).Post(srv.URL + test.urlPath)
+			require.NoError(t, err)
+			require.Equal(t, test.statusCode, res.StatusCode())
+
+			res, err = resty.New().R().Get(srv.URL + "/admin/limits")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode())
+			require.Contains(t, string(res.Body()), `"max_series":1`)
+		})
+	}
+}
+
+func Test_Breakers(t *testing.T) {
+	t.Run("storage without breakers", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		metricHandlers := handler.NewMetricHandlers(repository.NewMemory(), cLog)
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		res, err := resty.New().R().Get(srv.URL + "/admin/breakers")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.JSONEq(t, `[]`, string(res.Body()))
+	})
+}
+
+func Test_Stats(t *testing.T) {
+	t.Run("stats disabled", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		metricHandlers := handler.NewMetricHandlers(repository.NewMemory(), cLog)
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		res, err := resty.New().R().Get(srv.URL + "/admin/stats")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, res.StatusCode())
+	})
+
+	t.Run("stats by route and backend", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		reg := stats.NewRegistry()
+		storage, err := initStorage(context.Background(), &Config{}, cLog, reg)
+		require.NoError(t, err)
+
+		metricHandlers := handler.NewMetricHandlers(storage, cLog)
+		metricHandlers.Stats = reg
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		client := resty.New()
+		for _, name := range []string{"Alloc", "Sys"} {
+			res, err := client.R().Post(srv.URL + "/update/gauge/" + name + "/1")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode())
+		}
+
+		res, err := client.R().Post(srv.URL + "/update/gauge/mtrcstore.http/1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+
+		for _, m := range []string{"BREW", "WHEN"} {
+			_, err = client.R().Execute(m, srv.URL+"/update/gauge/Alloc/1")
+			require.NoError(t, err)
+		}
+
+		var snapshot stats.Snapshot
+		res, err = client.R().SetResult(&snapshot).Get(srv.URL + "/admin/stats")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		require.Equal(t, int64(2), snapshot.Requests["POST /update/{type}/{name}/{value} 200"].Count)
+		require.Equal(t, int64(1), snapshot.Requests["POST /update/{type}/{name}/{value} 400"].Count)
+		require.Equal(t, int64(2), snapshot.Storage["memory Save"].Count)
+
+		other := int64(0)
+		for key, r := range snapshot.Requests {
+			require.NotContains(t, key, "BREW")
+			if strings.HasPrefix(key, "other ") {
+				other += r.Count
+			}
+		}
+		require.Equal(t, int64(2), other)
+	})
+}
+
+func Test_Trace(t *testing.T) {
+	t.Run("request span continues the client trace", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		_, err = tracing.Setup(context.Background(), tracing.Config{})
+		require.NoError(t, err)
+
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		otel.SetTracerProvider(provider)
+		defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+		metricHandlers := handler.NewMetricHandlers(repository.NewMemory(), cLog)
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		const traceID = "0af7651916cd43dd8448eb211c80319c"
+		res, err := resty.New().R().
+			SetHeader("traceparent", "00-"+traceID+"-b7ad6b7169203331-01").
+			Post(srv.URL + "/update/gauge/Alloc/1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 1)
+		require.Equal(t, "POST /update/{type}/{name}/{value}", spans[0].Name())
+		require.Equal(t, traceID, spans[0].SpanContext().TraceID().String())
+		require.Equal(t, "b7ad6b7169203331", spans[0].Parent().SpanID().String())
+	})
+}
+
+func Test_OTLP(t *testing.T) {
+	delta := int64(3)
+	req := &colmetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metrics.ResourceMetrics{{
+			ScopeMetrics: []*metrics.ScopeMetrics{{
+				Metrics: []*metrics.Metric{{
+					Name: "requests",
+					Data: &metrics.Metric_Sum{Sum: &metrics.Sum{
+						AggregationTemporality: metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+						IsMonotonic:            true,
+						DataPoints: []*metrics.NumberDataPoint{{
+							Value: &metrics.NumberDataPoint_AsInt{AsInt: delta},
+						}},
+					}},
+				}},
+			}},
+		}},
+	}
+
+	pbBody, err := protobuf.Marshal(req)
+	require.NoError(t, err)
+	jsonBody, err := protojson.Marshal(req)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		statusCode  int
+	}{
+		{name: "protobuf", contentType: "application/x-protobuf", body: pbBody, statusCode: http.StatusOK},
+		{name: "json", contentType: "application/json", body: jsonBody, statusCode: http.StatusOK},
+		{name: "bad body", contentType: "application/x-protobuf", body: []byte("test"), statusCode: http.StatusBadRequest},
+		{name: "unsupported media", contentType: "text/plain", body: pbBody, statusCode: http.StatusUnsupportedMediaType},
+		{
+			name:        "body over the limit",
+			contentType: "application/x-protobuf",
+			body:        bytes.Repeat([]byte("a"), 8<<20+1),
+			statusCode:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cLog, err := logger.Build("debug")
+			require.NoError(t, err)
+
+			storage := repository.NewMemory()
+			metricHandlers := handler.NewMetricHandlers(storage, cLog)
+
+			r := server.InitRouter(metricHandlers, cLog, "", "", "")
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			res, err := resty.New().R().
+				SetHeader("Content-Type", tt.contentType).
+				SetBody(tt.body).
+				Post(srv.URL + "/v1/metrics")
+			require.NoError(t, err)
+			require.Equal(t, tt.statusCode, res.StatusCode())
+
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			require.Equal(t, tt.contentType, res.Header().Get("Content-Type"))
+			m, err := storage.Find(context.Background(), "requests", repository.CounterName)
+			require.NoError(t, err)
+			require.Equal(t, delta, *m.Delta)
+		})
+	}
+}
+
+func Test_RemoteWrite(t *testing.T) {
+	writeRequest := func(t *testing.T, ts ...*prompb.TimeSeries) []byte {
+		t.Helper()
+
+		body, err := protobuf.Marshal(&prompb.WriteRequest{Timeseries: ts})
+		require.NoError(t, err)
+
+		return snappy.Encode(nil, body)
+	}
+
+	gauge := &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "node_load1"}},
+		Samples: []*prompb.Sample{{Value: 0.5, Timestamp: 1}},
+	}
+	unnamed := &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "job", Value: "node"}},
+		Samples: []*prompb.Sample{{Value: 1, Timestamp: 1}},
+	}
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		statusCode int
+		saved      bool
+	}{
+		{name: "samples saved", encoding: "snappy", body: writeRequest(t, gauge), statusCode: http.StatusNoContent, saved: true},
+		{name: "rejected series", encoding: "snappy", body: writeRequest(t, gauge, unnamed), statusCode: http.StatusBadRequest, saved: true},
+		{name: "not snappy", encoding: "", body: []byte("test"), statusCode: http.StatusUnsupportedMediaType},
+		{name: "bad body", encoding: "snappy", body: []byte("test"), statusCode: http.StatusBadRequest},
+		{
+			name:       "declared size over the limit",
+			encoding:   "snappy",
+			body:       append(binary.AppendUvarint(nil, 1<<30), "test"...),
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "body over the limit",
+			encoding:   "snappy",
+			body:       bytes.Repeat([]byte("a"), 8<<20+1),
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cLog, err := logger.Build("debug")
+			require.NoError(t, err)
+
+			storage := repository.NewMemory()
+			metricHandlers := handler.NewMetricHandlers(storage, cLog)
+
+			r := server.InitRouter(metricHandlers, cLog, "", "", "")
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			res, err := resty.New().R().
+				SetHeader("Content-Type", "application/x-protobuf").
+				SetHeader("Content-Encoding", tt.encoding).
+				SetBody(tt.body).
+				Post(srv.URL + "/api/v1/write")
+			require.NoError(t, err)
+			require.Equal(t, tt.statusCode, res.StatusCode())
+
+			if tt.saved {
+				m, err := storage.Find(context.Background(), "node_load1", repository.GaugeName)
+				require.NoError(t, err)
+				require.InDelta(t, 0.5, *m.Value, 1e-9)
+			}
+		})
+	}
+}
+
+func Test_InfluxWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		statusCode int
+		lines      int
+		saved      bool
+	}{
+		{name: "points saved", query: "?precision=s", body: "cpu,host=a usage=0.5 1700000000", statusCode: http.StatusNoContent, saved: true},
+		{name: "newest point saved", query: "?precision=s", body: "cpu,host=a usage=0.5 1700000002\ncpu,host=a usage=0.9 1700000001", statusCode: http.StatusNoContent, saved: true},
+		{name: "partial write", body: "cpu,host=a usage=0.5\ncpu usage=", statusCode: http.StatusBadRequest, lines: 1, saved: true},
+		{name: "bad precision", query: "?precision=d", body: "cpu,host=a usage=0.5", statusCode: http.StatusBadRequest},
+		{name: "bad counters", query: "?counters=gauge", body: "cpu,host=a usage=0.5", statusCode: http.StatusBadRequest},
+		{name: "body over the limit", body: strings.Repeat("cpu usage=0.5\n", 8<<20/14+1), statusCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cLog, err := logger.Build("debug")
+			require.NoError(t, err)
+
+			storage := repository.NewMemory()
+			metricHandlers := handler.NewMetricHandlers(storage, cLog)
+
+			r := server.InitRouter(metricHandlers, cLog, "", "", "")
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			var problem handler.Problem
+			res, err := resty.New().R().
+				SetHeader("Content-Type", "text/plain").
+				SetBody(tt.body).
+				SetError(&problem).
+				Post(srv.URL + "/write" + tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.statusCode, res.StatusCode())
+			require.Len(t, problem.Lines, tt.lines)
+
+			if tt.saved {
+				m, err := storage.Find(context.Background(), "cpu.usage.host.a", repository.GaugeName)
+				require.NoError(t, err)
+				require.InDelta(t, 0.5, *m.Value, 1e-9)
+			}
+		})
+	}
+}
+
+func Test_Graphite(t *testing.T) {
+	cLog, err := logger.Build("debug")
+	require.NoError(t, err)
+
+	t.Run("bad rules", func(t *testing.T) {
+		_, err := runGraphite(context.Background(), repository.NewMemory(), &Config{
+			GraphiteAddress: "127.0.0.1:0",
+			GraphiteRules:   "servers.*",
+		}, cLog)
+		require.ErrorIs(t, err, ingest.ErrBadRule)
+	})
+
+	t.Run("stops with the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		wait, err := runGraphite(ctx, repository.NewMemory(), &Config{GraphiteAddress: "127.0.0.1:0"}, cLog)
+		require.NoError(t, err)
+
+		cancel()
+		wait()
+	})
+}
+
+func Test_ExportImport(t *testing.T) {
+	cLog, err := logger.Build("debug")
+	require.NoError(t, err)
+
+	value := 1.5
+	source := repository.NewMemory()
+	require.NoError(t, source.Save(context.Background(), model.Metric{ID: "Alloc", MType: repository.GaugeName, Value: &value}))
+
+	exportSrv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(source, cLog), cLog, "", "", ""))
+	defer exportSrv.Close()
+
+	res, err := resty.New().R().Get(exportSrv.URL + "/admin/export")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Equal(t, "application/x-ndjson", res.Header().Get("Content-Type"))
+
+	target := repository.NewMemory()
+	importSrv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(target, cLog), cLog, "", "", ""))
+	defer importSrv.Close()
+
+	var result repository.ImportResult
+	res, err = resty.New().R().
+		SetHeader("Content-Type", "application/x-ndjson").
+		SetBody(res.Body()).
+		SetResult(&result).
+		Post(importSrv.URL + "/admin/import")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode())
+	require.Equal(t, repository.ImportResult{Imported: 1}, result)
+
+	m, err := target.Find(context.Background(), "Alloc", repository.GaugeName)
+	require.NoError(t, err)
+	require.InDelta(t, value, *m.Value, 1e-9)
+
+	res, err = resty.New().R().SetBody("{").Post(importSrv.URL + "/admin/import")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode())
+}
+
+func Test_Stream(t *testing.T) {
+	tests := []struct {
+		name      string
+		secretKey string
+	}{
+		{name: "plain stream"},
+		{name: "signed stream", secretKey: "test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cLog, err := logger.Build("debug")
+			require.NoError(t, err)
+
+			hub := stream.NewHub()
+			metricHandlers := handler.NewMetricHandlers(repository.NewNotified(repository.NewMemory(), hub), cLog)
+			metricHandlers.Hub = hub
+
+			srv := httptest.NewServer(server.InitRouter(metricHandlers, cLog, "", tt.secretKey, ""))
+			defer srv.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stream?type=gauge&name=^Al", http.NoBody)
+			require.NoError(t, err)
+
+			h := hmac.New(sha256.New, []byte(tt.secretKey))
+			if tt.secretKey != "" {
+				req.Header.Set("HashSHA256", hex.EncodeToString(h.Sum(nil)))
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, res.Body.Close())
+			}()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+			for _, path := range []string{"/update/counter/Alloc/1", "/update/gauge/Other/1", "/update/gauge/Alloc/2.5"} {
+				upd, err := resty.New().R().Post(srv.URL + path)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, upd.StatusCode())
+			}
+
+			reader := bufio.NewReader(res.Body)
+			event := make([]string, 0)
+			for {
+				line, err := reader.ReadString('\n')
+				require.NoError(t, err)
+				if line = strings.TrimSuffix(line, "\n"); line == "" {
+					break
+				}
+				event = append(event, line)
+			}
+
+			data := `{"value":2.5,"id":"Alloc","type":"gauge"}`
+			if tt.secretKey == "" {
+				require.Equal(t, []string{"event: metric", "data: " + data}, event)
+				return
+			}
+
+			_, err = h.Write([]byte(data))
+			require.NoError(t, err)
+			require.Equal(t, []string{"event: metric", "hash: " + hex.EncodeToString(h.Sum(nil)), "data: " + data}, event)
+		})
+	}
+
+	t.Run("stream disabled", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		srv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(repository.NewMemory(), cLog), cLog, "", "", ""))
+		defer srv.Close()
+
+		res, err := resty.New().R().Get(srv.URL + "/stream")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, res.StatusCode())
+	})
+}
+
+func Test_Dashboard(t *testing.T) {
+	cLog, err := logger.Build("debug")
+	require.NoError(t, err)
+
+	history := dashboard.NewHistory(10)
+	metricHandlers := handler.NewMetricHandlers(repository.NewNotified(repository.NewMemory(), history), cLog)
+	metricHandlers.History = history
+
+	srv := httptest.NewServer(server.InitRouter(metricHandlers, cLog, "", "", ""))
+	defer srv.Close()
+
+	for _, path := range []string{"/update/gauge/Alloc/1", "/update/gauge/Alloc/2", "/update/counter/Alloc/3"} {
+		res, err := resty.New().R().Post(srv.URL + path)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+	}
+
+	tests := []struct {
+		name       string
+		urlPath    string
+		contains   string
+		statusCode int
+	}{
+		{name: "typed groups", urlPath: "/", contains: `<a href="/dashboard/metric/counter/Alloc">Alloc</a>`, statusCode: http.StatusOK},
+		{name: "sparkline", urlPath: "/", contains: `<polyline points="0.0,24.0 120.0,0.0"/>`, statusCode: http.StatusOK},
+		{name: "detail page", urlPath: "/dashboard/metric/gauge/Alloc", contains: `<dd class="value">2</dd>`, statusCode: http.StatusOK},
+		{name: "unknown metric", urlPath: "/dashboard/metric/gauge/Other", statusCode: http.StatusNotFound},
+		{name: "refresh data", urlPath: "/dashboard/api/metrics", contains: `{"id":"Alloc","type":"counter","value":"3"`, statusCode: http.StatusOK},
+		{name: "static assets", urlPath: "/dashboard/static/style.css", contains: ".sparkline", statusCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := resty.New().R().Get(srv.URL + tt.urlPath)
+			require.NoError(t, err)
+			require.Equal(t, tt.statusCode, res.StatusCode())
+			require.Contains(t, string(res.Body()), tt.contains)
+		})
+	}
+}
+
+func Test_Problem(t *testing.T) {
+	tests := []struct {
+		name       string
+		urlPath    string
+		code       string
+		statusCode int
+	}{
+		{
+			name:       "unknown type",
+			urlPath:    "/value/test/Alloc",
+			code:       "invalid_type",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "metric not found",
+			urlPath:    "/value/gauge/Alloc",
+			code:       "not_found",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cLog, err := logger.Build("debug")
+			require.NoError(t, err)
+
+			metricHandlers := handler.NewMetricHandlers(repository.NewMemory(), cLog)
+
+			r := server.InitRouter(metricHandlers, cLog, "", "", "")
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			res, err := resty.New().R().Get(srv.URL + test.urlPath)
+			require.NoError(t, err)
+			require.Equal(t, test.statusCode, res.StatusCode())
+			require.Equal(t, "application/problem+json", res.Header().Get("Content-Type"))
+
+			var p handler.Problem
+			require.NoError(t, json.Unmarshal(res.Body(), &p))
+			require.Equal(t, test.code, p.Code)
+			require.Equal(t, test.statusCode, p.Status)
+		})
+	}
+
+	t.Run("bad value", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		metricHandlers := handler.NewMetricHandlers(repository.NewMemory(), cLog)
+
+		r := server.InitRouter(metricHandlers, cLog, "", "", "")
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		res, err := resty.New().R().Post(srv.URL + "/update/gauge/Alloc/test")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode())
+		require.Contains(t, string(res.Body()), `"code":"invalid_value"`)
+	})
+}
+
+func Test_Alerts(t *testing.T) {
+	t.Run("alerts of the rules file", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		rules := filepath.Join(t.TempDir(), "rules.yaml")
+		require.NoError(t, os.WriteFile(rules, []byte(`rules:
+  - name: AllocHigh
+    metric: Alloc
+    type: gauge
+    expr: value > 10
+  - name: PollCountStuck
+    metric: PollCount
+    type: counter
+    expr: increase(1m) <= 0
+    for: 5m
+`), 0o600))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		storage := repository.NewMemory()
+		config := Config{AlertRules: rules, AlertInterval: 3600}
+		engine, err := initAlerting(ctx, storage, &config, cLog)
+		require.NoError(t, err)
+
+		metricHandlers := handler.NewMetricHandlers(storage, cLog)
+		metricHandlers.Alerting = engine
+
+		srv := httptest.NewServer(server.InitRouter(metricHandlers, cLog, "", "", ""))
+		defer srv.Close()
+
+		upd, err := resty.New().R().Post(srv.URL + "/update/gauge/Alloc/11")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, upd.StatusCode())
+
+		engine.Evaluate(ctx)
+
+		res, err := resty.New().R().Get(srv.URL + "/alerts?state=firing")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		var alerts []alert.Alert
+		require.NoError(t, json.Unmarshal(res.Body(), &alerts))
+		require.Len(t, alerts, 1)
+		require.Equal(t, "AllocHigh", alerts[0].Rule.Name)
+		require.InDelta(t, 11.0, *alerts[0].Value, 0)
+
+		res, err = resty.New().R().Get(srv.URL + "/alerts")
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(res.Body(), &alerts))
+		require.Len(t, alerts, 2)
+		require.Equal(t, alert.StateInactive, alerts[1].State)
+		require.Equal(t, 5*time.Minute, alerts[1].Rule.For)
+	})
+
+	t.Run("alerts of the hidden stale metrics", func(t *testing.T) {
+		rules := filepath.Join(t.TempDir(), "rules.yaml")
+		require.NoError(t, os.WriteFile(rules, []byte(`rules: [{name: AllocHigh, metric: Alloc, type: gauge, expr: "value > 10"}]`), 0o600))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		storage, err := repository.NewStale(repository.NewMemory(), repository.Staleness{TTL: time.Nanosecond, Hide: true})
+		require.NoError(t, err)
+
+		value := 11.0
+		require.NoError(t, storage.Save(ctx, model.Metric{ID: "Alloc", MType: repository.GaugeName, Value: &value}))
+		time.Sleep(time.Millisecond)
+
+		_, err = storage.Find(ctx, "Alloc", repository.GaugeName)
+		require.ErrorIs(t, err, repository.ErrNotFound)
+
+		config := Config{AlertRules: rules, AlertInterval: 3600}
+		engine, err := initAlerting(ctx, storage, &config, zap.NewNop())
+		require.NoError(t, err)
+
+		engine.Evaluate(ctx)
+		require.Equal(t, alert.StateFiring, engine.Alerts()[0].State)
+	})
+
+	t.Run("invalid rules file", func(t *testing.T) {
+		rules := filepath.Join(t.TempDir(), "rules.yaml")
+		require.NoError(t, os.WriteFile(rules, []byte(`rules: [{name: A, metric: A, type: gauge, expr: "avg > 1"}]`), 0o600))
+
+		config := Config{AlertRules: rules, AlertInterval: 15}
+		_, err := initAlerting(context.Background(), repository.NewMemory(), &config, zap.NewNop())
+		require.ErrorIs(t, err, alert.ErrBadRule)
+	})
+
+	t.Run("alerts disabled", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		srv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(repository.NewMemory(), cLog), cLog, "", "", ""))
+		defer srv.Close()
+
+		res, err := resty.New().R().Get(srv.URL + "/alerts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, res.StatusCode())
+	})
+}
+
+func Test_Staleness(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		hide   bool
+	}{
+		{name: "stale metric is flagged", status: http.StatusOK},
+		{name: "stale metric is hidden", status: http.StatusNotFound, hide: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cLog, err := logger.Build("debug")
+			require.NoError(t, err)
+
+			const ttl = 50 * time.Millisecond
+			storage, err := repository.NewStale(repository.NewMemory(), repository.Staleness{TTL: ttl, Hide: tt.hide})
+			require.NoError(t, err)
+
+			srv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(storage, cLog), cLog, "", "", ""))
+			defer srv.Close()
+
+			upd, err := resty.New().R().SetHeader("X-Real-IP", "10.0.0.1").Post(srv.URL + "/update/gauge/Alloc/1")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, upd.StatusCode())
+
+			res, err := resty.New().R().Get(srv.URL + "/value/gauge/Alloc")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode())
+			require.Empty(t, res.Header().Get("X-Metric-Stale"))
+
+			time.Sleep(2 * ttl)
+
+			res, err = resty.New().R().Get(srv.URL + "/value/gauge/Alloc")
+			require.NoError(t, err)
+			require.Equal(t, tt.status, res.StatusCode())
+			if !tt.hide {
+				require.Equal(t, "true", res.Header().Get("X-Metric-Stale"))
+			}
+
+			var items []dashboard.Item
+			res, err = resty.New().R().SetResult(&items).Get(srv.URL + "/dashboard/api/metrics")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode())
+			if tt.hide {
+				require.Empty(t, items)
+			} else {
+				require.Len(t, items, 1)
+				require.True(t, items[0].Stale)
+			}
+
+			var sources []repository.Source
+			res, err = resty.New().R().SetResult(&sources).Get(srv.URL + "/admin/sources?silent=true")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode())
+			require.Len(t, sources, 1)
+			require.Equal(t, "10.0.0.1", sources[0].Name)
+			require.Equal(t, int64(1), sources[0].Writes)
+		})
+	}
+
+	t.Run("staleness disabled", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		srv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(repository.NewMemory(), cLog), cLog, "", "", ""))
+		defer srv.Close()
+
+		res, err := resty.New().R().Get(srv.URL + "/admin/sources")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, res.StatusCode())
+	})
+}
+
+func Test_Forward(t *testing.T) {
+	t.Run("saved metrics are forwarded to another server", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		downstream := repository.NewMemory()
+		downSrv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(downstream, cLog), cLog, "", "down", ""))
+		defer downSrv.Close()
+
+		forwarder := forward.New([]forward.Destination{{
+			Name:    "down",
+			URL:     downSrv.URL + "/updates/",
+			Key:     "down",
+			Drop:    forward.DropNewest,
+			Timeout: time.Second,
+			Queue:   10,
+			Retries: 1,
+		}}, cLog)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go forwarder.Run(ctx)
+
+		metricHandlers := handler.NewMetricHandlers(repository.NewNotified(repository.NewMemory(), forwarder), cLog)
+		metricHandlers.Forwarder = forwarder
+		srv := httptest.NewServer(server.InitRouter(metricHandlers, cLog, "", "", ""))
+		defer srv.Close()
+
+		res, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(`[{"id":"PollCount","type":"counter","delta":3},{"id":"Alloc","type":"gauge","value":1.5}]`).
+			Post(srv.URL + "/updates/")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		require.Eventually(t, func() bool {
+			m, err := downstream.Find(ctx, "PollCount", repository.CounterName)
+			return err == nil && *m.Delta == 3
+		}, time.Second, 10*time.Millisecond)
+
+		m, err := downstream.Find(ctx, "Alloc", repository.GaugeName)
+		require.NoError(t, err)
+		require.InDelta(t, 1.5, *m.Value, 0)
+
+		var statuses []forward.Status
+		res, err = resty.New().R().SetResult(&statuses).Get(srv.URL + "/admin/forward")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Len(t, statuses, 1)
+		require.Equal(t, int64(1), statuses[0].Sent)
+	})
+
+	t.Run("forwarding disabled", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		srv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(repository.NewMemory(), cLog), cLog, "", "", ""))
+		defer srv.Close()
+
+		res, err := resty.New().R().Get(srv.URL + "/admin/forward")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, res.StatusCode())
+	})
+}
+
+func Test_Relay(t *testing.T) {
+	t.Run("servers relaying to each other do not loop", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		// the relay path goes with the baggage of the propagator
+		_, err = tracing.Setup(context.Background(), tracing.Config{})
+		require.NoError(t, err)
+
+		regionalHandlers := handler.NewMetricHandlers(repository.NewMemory(), cLog)
+		regionalSrv := httptest.NewServer(server.InitRouter(regionalHandlers, cLog, "", "", ""))
+		defer regionalSrv.Close()
+
+		centralHandlers := handler.NewMetricHandlers(repository.NewMemory(), cLog)
+		centralSrv := httptest.NewServer(server.InitRouter(centralHandlers, cLog, "", "", ""))
+		defer centralSrv.Close()
+
+		regional, closeRegional, err := initRelay(&Config{
+			RelayAddress: strings.TrimPrefix(centralSrv.URL, "http://"),
+			RelayID:      "eu",
+			RelayBuffer:  10,
+		}, cLog)
+		require.NoError(t, err)
+		defer closeRegional()
+
+		central, closeCentral, err := initRelay(&Config{
+			RelayAddress: strings.TrimPrefix(regionalSrv.URL, "http://"),
+			RelayID:      "central",
+			RelayNames:   "^Alloc$",
+			RelayBuffer:  10,
+		}, cLog)
+		require.NoError(t, err)
+		defer closeCentral()
+
+		centralStorage := repository.NewMemory()
+		regionalHandlers.Storage = repository.NewNotified(regionalHandlers.Storage, regional)
+		regionalHandlers.Relay = regional
+		centralHandlers.Storage = repository.NewNotified(centralStorage, central)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go regional.Run(ctx)
+		go central.Run(ctx)
+
+		res, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(`[{"id":"Alloc","type":"gauge","value":1.5},{"id":"Sys","type":"gauge","value":2}]`).
+			Post(regionalSrv.URL + "/updates/")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+
+		require.Eventually(t, func() bool { return regional.Status().Looped == 1 }, 2*time.Second, 10*time.Millisecond)
+
+		m, err := centralStorage.Find(ctx, "Sys", repository.GaugeName)
+		require.NoError(t, err)
+		require.InDelta(t, 2.0, *m.Value, 0)
+
+		var status relay.Status
+		res, err = resty.New().R().SetResult(&status).Get(regionalSrv.URL + "/admin/relay")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Equal(t, int64(2), status.Relayed)
+		require.Equal(t, int64(1), status.Looped)
+		require.Equal(t, int64(1), central.Status().Relayed)
+	})
+
+	t.Run("invalid relay filter", func(t *testing.T) {
+		_, _, err := initRelay(&Config{RelayAddress: "localhost:8080", RelayID: "eu", RelayType: "histogram"}, zap.NewNop())
+		require.Error(t, err)
+	})
+
+	t.Run("relay mode off", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		srv := httptest.NewServer(server.InitRouter(handler.NewMetricHandlers(repository.NewMemory(), cLog), cLog, "", "", ""))
+		defer srv.Close()
+
+		res, err := resty.New().R().Get(srv.URL + "/admin/relay")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, res.StatusCode())
+	})
+}
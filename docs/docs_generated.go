@@ -26,7 +26,7 @@ const docTemplate = `{
                 "tags": [
                     "Info"
                 ],
-                "summary": "Get metrics list",
+                "summary": "Get metrics dashboard",
                 "operationId": "getMetric",
                 "responses": {
                     "200": {
@@ -38,120 +38,152 @@ const docTemplate = `{
                 }
             }
         },
-        "/ping": {
+        "/admin/breakers": {
             "get": {
                 "consumes": [
-                    "text/html"
+                    "application/json"
                 ],
                 "produces": [
-                    "text/html"
+                    "application/json"
                 ],
                 "tags": [
-                    "Info"
+                    "Admin"
                 ],
-                "summary": "Check storage status",
-                "operationId": "pingMetric",
+                "summary": "Get state of the circuit breakers protecting the storage",
+                "operationId": "breakersMetric",
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_breaker.Status"
+                            }
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
                     }
                 }
             }
         },
-        "/update": {
-            "post": {
-                "consumes": [
-                    "application/json"
-                ],
+        "/admin/export": {
+            "get": {
                 "produces": [
-                    "application/json"
+                    "application/x-ndjson"
                 ],
                 "tags": [
-                    "Update"
+                    "Admin"
                 ],
-                "summary": "Update metric with json format",
-                "operationId": "updateJSONMetric",
-                "parameters": [
-                    {
-                        "description": "Metric's data",
-                        "name": "metric",
-                        "in": "body",
-                        "required": true,
+                "summary": "Stream all metrics as NDJSON",
+                "operationId": "exportMetrics",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
                         }
                     }
+                }
+            }
+        },
+        "/admin/forward": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
                 ],
+                "summary": "Get delivery state of the forwarding destinations",
+                "operationId": "forwardMetrics",
                 "responses": {
                     "200": {
-                        "description": "Metric's data",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_forward.Status"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request"
-                    },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
                     }
                 }
             }
         },
-        "/update/{type}/{name}/{value}": {
+        "/admin/import": {
             "post": {
+                "description": "Counters are added to the existing values.",
                 "consumes": [
-                    "text/html"
+                    "application/x-ndjson"
                 ],
                 "produces": [
-                    "text/html"
+                    "application/json"
                 ],
                 "tags": [
-                    "Update"
-                ],
-                "summary": "Update metric by type and name",
-                "operationId": "updateMetric",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "metric type [counter, gauge]",
-                        "name": "type",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "metric name",
-                        "name": "name",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "number",
-                        "description": "metric value",
-                        "name": "value",
-                        "in": "path",
-                        "required": true
-                    }
+                    "Admin"
                 ],
+                "summary": "Load metrics written by the export",
+                "operationId": "importMetrics",
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_repository.ImportResult"
+                        }
                     },
                     "400": {
-                        "description": "Bad Request"
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
                     }
                 }
             }
         },
-        "/updates/": {
-            "post": {
+        "/admin/limits": {
+            "get": {
                 "consumes": [
                     "application/json"
                 ],
@@ -159,131 +191,1019 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Update"
+                    "Admin"
                 ],
-                "summary": "Mass update metrics with json format",
-                "operationId": "updatesMetric",
-                "parameters": [
-                    {
-                        "description": "Metric's data",
-                        "name": "metric",
-                        "in": "body",
-                        "required": true,
+                "summary": "Get configured limits and number of rejected writes",
+                "operationId": "limitsMetric",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
-                            }
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
                         }
                     }
+                }
+            }
+        },
+        "/admin/relay": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
                 ],
+                "summary": "Get state of the relay to the upstream server",
+                "operationId": "relayMetrics",
                 "responses": {
                     "200": {
-                        "description": "OK"
-                    },
-                    "400": {
-                        "description": "Bad Request"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_relay.Status"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
                     }
                 }
             }
         },
-        "/value/": {
+        "/admin/snapshot": {
             "post": {
                 "consumes": [
-                    "application/json"
+                    "text/html"
+                ],
+                "produces": [
+                    "text/html"
                 ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Write storage snapshot to the disk",
+                "operationId": "snapshotMetric",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/sources": {
+            "get": {
+                "description": "A source is silent when it wrote nothing for the staleness TTL.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Info"
+                    "Admin"
                 ],
-                "summary": "Get metric info with json format",
-                "operationId": "findJSONMetric",
+                "summary": "Get clients writing metrics and the time of their last write",
+                "operationId": "sourcesMetric",
                 "parameters": [
                     {
-                        "description": "Metric's data",
-                        "name": "metric",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
-                        }
+                        "type": "boolean",
+                        "description": "list only the silent sources",
+                        "name": "silent",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Metric's data",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_repository.Source"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
                     }
                 }
             }
         },
-        "/value/{type}/{name}": {
+        "/admin/stats": {
             "get": {
                 "consumes": [
-                    "text/html"
+                    "application/json"
                 ],
                 "produces": [
-                    "text/html"
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get request, storage and gRPC latencies of the server",
+                "operationId": "statsMetric",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_stats.Snapshot"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/alerts": {
+            "get": {
+                "produces": [
+                    "application/json"
                 ],
                 "tags": [
                     "Info"
                 ],
-                "summary": "Find metric by type and name",
-                "operationId": "findMetric",
+                "summary": "Get state of the alert rules",
+                "operationId": "alerts",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "metric type [counter, gauge]",
-                        "name": "type",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "metric name",
-                        "name": "name",
-                        "in": "path",
-                        "required": true
+                        "description": "alert state [inactive, pending, firing, resolved]",
+                        "name": "state",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "metric's value, for example 200.4",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_alert.Alert"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request"
-                    },
-                    "404": {
-                        "description": "Not Found"
-                    },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "github_com_arefev_mtrcstore_internal_server_model.Metric": {
+        },
+        "/api/v1/write": {
+            "post": {
+                "consumes": [
+                    "application/x-protobuf"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Update"
+                ],
+                "summary": "Receive samples from Prometheus remote_write",
+                "operationId": "remoteWrite",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/dashboard/api/metrics": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Info"
+                ],
+                "summary": "Get metrics with their history for the dashboard refresh",
+                "operationId": "dashboardData",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_dashboard.Item"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/dashboard/metric/{type}/{name}": {
+            "get": {
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "Info"
+                ],
+                "summary": "Get dashboard page of a metric",
+                "operationId": "metricPage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "metric type [counter, gauge]",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "metric name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/ping": {
+            "get": {
+                "consumes": [
+                    "text/html"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "Info"
+                ],
+                "summary": "Check storage status",
+                "operationId": "pingMetric",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream": {
+            "get": {
+                "description": "Every saved metric is sent as a \"metric\" event, the counters carry the increment.\nThe number of events lost by a slow client is sent as a \"dropped\" event.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Info"
+                ],
+                "summary": "Stream metric updates as server-sent events",
+                "operationId": "streamMetrics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "metric type [counter, gauge]",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "regexp of the metric names",
+                        "name": "name",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/update": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Update"
+                ],
+                "summary": "Update metric with json format",
+                "operationId": "updateJSONMetric",
+                "parameters": [
+                    {
+                        "description": "Metric's data",
+                        "name": "metric",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Metric's data",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/update/{type}/{name}/{value}": {
+            "post": {
+                "consumes": [
+                    "text/html"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "Update"
+                ],
+                "summary": "Update metric by type and name",
+                "operationId": "updateMetric",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "metric type [counter, gauge]",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "metric name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "metric value",
+                        "name": "value",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/updates/": {
+            "post": {
+                "description": "With partial=true the valid metrics are saved and the status of every metric is returned,\notherwise the batch is saved as a whole or rejected as a whole.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Update"
+                ],
+                "summary": "Mass update metrics with json format",
+                "operationId": "updatesMetric",
+                "parameters": [
+                    {
+                        "description": "Metric's data",
+                        "name": "metric",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                            }
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "partial success mode",
+                        "name": "partial",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "status of every metric in the partial success mode",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.BatchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/metrics": {
+            "post": {
+                "consumes": [
+                    "application/x-protobuf",
+                    "application/json"
+                ],
+                "produces": [
+                    "application/x-protobuf",
+                    "application/json"
+                ],
+                "tags": [
+                    "Update"
+                ],
+                "summary": "Receive OpenTelemetry metrics over OTLP/HTTP",
+                "operationId": "otlpMetrics",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/value/": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Info"
+                ],
+                "summary": "Get metric info with json format",
+                "operationId": "findJSONMetric",
+                "parameters": [
+                    {
+                        "description": "Metric's data",
+                        "name": "metric",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Metric's data",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Metric"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/value/{type}/{name}": {
+            "get": {
+                "consumes": [
+                    "text/html"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "Info"
+                ],
+                "summary": "Find metric by type and name",
+                "operationId": "findMetric",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "metric type [counter, gauge]",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "metric name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "metric's value, for example 200.4",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/write": {
+            "post": {
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Update"
+                ],
+                "summary": "Receive points in the InfluxDB line protocol",
+                "operationId": "influxWrite",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "unit of the timestamps [ns, us, ms, s, m, h]",
+                        "name": "precision",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "integer fields are [cumulative, delta] counters, gauges by default",
+                        "name": "counters",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_server_handler.Problem"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "github_com_arefev_mtrcstore_internal_breaker.Status": {
+            "type": "object",
+            "properties": {
+                "changed": {
+                    "type": "string"
+                },
+                "failures": {
+                    "description": "consecutive failures in the closed state",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "rejected": {
+                    "description": "calls rejected while open",
+                    "type": "integer"
+                },
+                "state": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_alert.Alert": {
+            "type": "object",
+            "properties": {
+                "active_at": {
+                    "description": "the condition holds since",
+                    "type": "string"
+                },
+                "fired_at": {
+                    "description": "the condition held for the For duration",
+                    "type": "string"
+                },
+                "resolved_at": {
+                    "description": "the firing alert stopped holding",
+                    "type": "string"
+                },
+                "rule": {
+                    "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_alert.Rule"
+                },
+                "state": {
+                    "type": "string"
+                },
+                "value": {
+                    "description": "the last computed value of the expression",
+                    "type": "number"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_alert.Rule": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "expr": {
+                    "type": "string"
+                },
+                "for": {
+                    "type": "string",
+                    "example": "5m0s"
+                },
+                "metric": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_dashboard.Item": {
+            "type": "object",
+            "properties": {
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_dashboard.Point"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "stale": {
+                    "description": "nobody wrote the metric for the staleness TTL",
+                    "type": "boolean"
+                },
+                "type": {
+                    "description": "empty when the storage does not tell the types apart",
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_dashboard.Point": {
+            "type": "object",
+            "properties": {
+                "time": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "number"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_forward.Status": {
+            "type": "object",
+            "properties": {
+                "drop": {
+                    "type": "string"
+                },
+                "dropped": {
+                    "description": "did not fit into the full queue",
+                    "type": "integer"
+                },
+                "failed": {
+                    "description": "given up after the retries",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "queued": {
+                    "type": "integer"
+                },
+                "sent": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_ingest.LineError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_model.BatchResult": {
+            "type": "object",
+            "properties": {
+                "accepted": {
+                    "type": "integer"
+                },
+                "rejected": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_model.Result"
+                    }
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_model.Metric": {
             "type": "object",
             "properties": {
                 "delta": {
@@ -303,6 +1223,240 @@ const docTemplate = `{
                     "type": "number"
                 }
             }
+        },
+        "github_com_arefev_mtrcstore_internal_server_model.Result": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "metric name",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "why the metric was rejected",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "accepted or rejected",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "metric type",
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_relay.Status": {
+            "type": "object",
+            "properties": {
+                "buffered": {
+                    "description": "batches waiting for the upstream",
+                    "type": "integer"
+                },
+                "dropped": {
+                    "description": "batches dropped from the full buffer or failed for good",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "looped": {
+                    "description": "batches not relayed because they were relayed by this server before",
+                    "type": "integer"
+                },
+                "rejected": {
+                    "description": "metrics rejected by the upstream",
+                    "type": "integer"
+                },
+                "relayed": {
+                    "description": "metrics accepted by the upstream",
+                    "type": "integer"
+                },
+                "upstream": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_repository.ImportResult": {
+            "type": "object",
+            "properties": {
+                "imported": {
+                    "type": "integer"
+                },
+                "rejected": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_repository.Source": {
+            "type": "object",
+            "properties": {
+                "last_seen": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "silent": {
+                    "description": "nothing was written by the source for the TTL",
+                    "type": "boolean"
+                },
+                "writes": {
+                    "description": "number of metrics written since the server started",
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_stats.Histogram": {
+            "type": "object",
+            "properties": {
+                "buckets": {
+                    "description": "cumulative counts by the upper bound in seconds",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "sum": {
+                    "description": "total duration in seconds",
+                    "type": "number"
+                }
+            }
+        },
+        "github_com_arefev_mtrcstore_internal_server_stats.Snapshot": {
+            "type": "object",
+            "properties": {
+                "db_pool": {
+                    "$ref": "#/definitions/sql.DBStats"
+                },
+                "grpc": {
+                    "description": "by \"method code\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_stats.Histogram"
+                    }
+                },
+                "requests": {
+                    "description": "by \"method route status\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_stats.Histogram"
+                    }
+                },
+                "snapshots": {
+                    "description": "by \"result\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_stats.Histogram"
+                    }
+                },
+                "storage": {
+                    "description": "by \"backend method\"",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_stats.Histogram"
+                    }
+                }
+            }
+        },
+        "internal_server_handler.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "machine readable reason of the error",
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "lines": {
+                    "description": "rejected lines of a line protocol request",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_arefev_mtrcstore_internal_server_ingest.LineError"
+                    }
+                },
+                "status": {
+                    "description": "HTTP status code",
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "sql.DBStats": {
+            "type": "object",
+            "properties": {
+                "idle": {
+                    "description": "The number of idle connections.",
+                    "type": "integer"
+                },
+                "inUse": {
+                    "description": "The number of connections currently in use.",
+                    "type": "integer"
+                },
+                "maxIdleClosed": {
+                    "description": "The total number of connections closed due to SetMaxIdleConns.",
+                    "type": "integer"
+                },
+                "maxIdleTimeClosed": {
+                    "description": "The total number of connections closed due to SetConnMaxIdleTime.",
+                    "type": "integer"
+                },
+                "maxLifetimeClosed": {
+                    "description": "The total number of connections closed due to SetConnMaxLifetime.",
+                    "type": "integer"
+                },
+                "maxOpenConnections": {
+                    "description": "Maximum number of open connections to the database.",
+                    "type": "integer"
+                },
+                "openConnections": {
+                    "description": "Pool Status",
+                    "type": "integer"
+                },
+                "waitCount": {
+                    "description": "Counters",
+                    "type": "integer"
+                },
+                "waitDuration": {
+                    "description": "The total time blocked waiting for a new connection.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/time.Duration"
+                        }
+                    ]
+                }
+            }
+        },
+        "time.Duration": {
+            "type": "integer",
+            "enum": [
+                -9223372036854775808,
+                9223372036854775807,
+                1,
+                1000,
+                1000000,
+                1000000000,
+                60000000000,
+                3600000000000
+            ],
+            "x-enum-varnames": [
+                "minDuration",
+                "maxDuration",
+                "Nanosecond",
+                "Microsecond",
+                "Millisecond",
+                "Second",
+                "Minute",
+                "Hour"
+            ]
         }
     },
     "tags": [
@@ -313,6 +1467,10 @@ const docTemplate = `{
         {
             "description": "\"Group of requests to update metrics\"",
             "name": "Update"
+        },
+        {
+            "description": "\"Group of requests to manage the storage\"",
+            "name": "Admin"
         }
     ]
 }`
@@ -6,3 +6,16 @@ type Metric struct {
 	ID    string   `json:"id"`              // имя метрики
 	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
 }
+
+const (
+	ResultAccepted = "accepted"
+	ResultRejected = "rejected"
+)
+
+// Result - статус сохранения метрики из пакета
+type Result struct {
+	ID     string `json:"id"`               // имя метрики
+	MType  string `json:"type"`             // тип метрики
+	Status string `json:"status"`           // accepted или rejected
+	Reason string `json:"reason,omitempty"` // причина отказа
+}
@@ -8,6 +8,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
@@ -16,42 +17,197 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/arefev/mtrcstore/internal/agent/model"
+	"github.com/arefev/mtrcstore/internal/retry"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/net/http2"
 )
 
-var ErrRequestFail = errors.New("doRequest failed")
+var (
+	ErrRequestFail  = errors.New("doRequest failed")
+	ErrSignMissing  = errors.New("response signature is missing")
+	ErrSignMismatch = errors.New("response signature does not match")
+)
+
+// HTTPOptions configures the HTTP client shared by all the reports of the agent.
+type HTTPOptions struct {
+	Timeout         time.Duration // deadline of a single report, derived from the report interval
+	DialTimeout     time.Duration
+	IdleConnTimeout time.Duration // how long an unused keep-alive connection stays open
+	MaxIdleConns    int
+	HTTP2           bool // HTTP/2 over plain TCP with prior knowledge (h2c)
+}
 
 type client struct {
+	http      *resty.Client
+	failures  map[string]int64
+	mutex     *sync.Mutex
 	secretKey string
 	cryptoKey string
 	url       string
+	timeout   time.Duration
 }
 
-func NewClient(secretKey, cryptoKey, url string) *client {
+func NewClient(secretKey, cryptoKey, url string, opts HTTPOptions) *client {
 	return &client{
+		http:      resty.New().SetTransport(otelhttp.NewTransport(newTransport(opts))),
+		failures:  make(map[string]int64),
+		mutex:     &sync.Mutex{},
 		secretKey: secretKey,
 		cryptoKey: cryptoKey,
 		url:       url,
+		timeout:   opts.Timeout,
+	}
+}
+
+// newTransport builds the transport that keeps the connections to the server alive between the reports.
+func newTransport(opts HTTPOptions) http.RoundTripper {
+	const keepAlive = 30 * time.Second
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: keepAlive,
+	}
+
+	if opts.HTTP2 {
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			IdleConnTimeout: opts.IdleConnTimeout,
+		}
+	}
+
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        opts.MaxIdleConns,
+		MaxIdleConnsPerHost: opts.MaxIdleConns,
+		IdleConnTimeout:     opts.IdleConnTimeout,
+		TLSHandshakeTimeout: opts.DialTimeout,
 	}
 }
 
-func (c *client) doRequest(ctx context.Context, headers map[string]string, body any) error {
-	request := resty.New().R().SetContext(ctx)
+// Close drops the idle connections to the server.
+func (c *client) Close() error {
+	c.http.GetClient().CloseIdleConnections()
+	return nil
+}
+
+// batchResult is the server response in the partial success mode.
+type batchResult struct {
+	Results []model.Result `json:"results"`
+}
+
+// doRequest sends the batch in the partial success mode, so the server saves the valid metrics
+// and returns the status of every one of them.
+func (c *client) doRequest(ctx context.Context, headers map[string]string, body any) ([]model.Result, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	request := c.http.R().SetContext(ctx).SetQueryParam("partial", "true")
 	for k, v := range headers {
 		request.SetHeader(k, v)
 	}
 
-	if _, err := request.SetBody(body).Post(c.url); err != nil {
-		return fmt.Errorf("%w: %w", ErrRequestFail, err)
+	var result batchResult
+	resp, err := request.SetBody(body).SetResult(&result).Post(c.url)
+	if err != nil {
+		c.fail("transport")
+		return nil, fmt.Errorf("%w: %w", ErrRequestFail, err)
+	}
+
+	if !resp.IsSuccess() {
+		c.fail("status_" + strconv.Itoa(resp.StatusCode()))
+		return nil, fmt.Errorf("%w: %w", ErrRequestFail, &retry.StatusError{
+			Code:  resp.StatusCode(),
+			After: retry.ParseRetryAfter(resp.Header().Get("Retry-After"), time.Now()),
+		})
+	}
+
+	if err := c.verify(resp); err != nil {
+		c.fail("signature")
+		return nil, fmt.Errorf("%w: %w", ErrRequestFail, err)
+	}
+
+	return result.Results, nil
+}
+
+// verify checks the HMAC the server puts on the response body when the secret key is configured.
+func (c *client) verify(resp *resty.Response) error {
+	if c.secretKey == "" {
+		return nil
+	}
+
+	hash := resp.Header().Get("HashSHA256")
+	if hash == "" {
+		return ErrSignMissing
+	}
+
+	got, err := hex.DecodeString(hash)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSignMismatch, err)
+	}
+
+	want, err := c.sign(resp.Body())
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(got, want) {
+		return ErrSignMismatch
 	}
 
 	return nil
 }
 
-func (c *client) Request(ctx context.Context, data []model.Metric) error {
+// fail counts the failed request by its reason, the counters are shown by the status endpoint.
+func (c *client) fail(reason string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.failures[reason]++
+}
+
+// Failures returns the number of failed requests by the reason: transport, signature or status_<code>.
+func (c *client) Failures() map[string]int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	failures := make(map[string]int64, len(c.failures))
+	for reason, n := range c.failures {
+		failures[reason] = n
+	}
+
+	return failures
+}
+
+func (c *client) Request(ctx context.Context, data []model.Metric) ([]model.Result, error) {
+	ctx, span := tracer.Start(ctx, "client.Request")
+	defer span.End()
+
+	results, err := c.request(ctx, data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "request failed")
+	}
+
+	return results, err
+}
+
+func (c *client) request(ctx context.Context, data []model.Metric) ([]model.Result, error) {
 	headers := map[string]string{
 		"Content-Type":     "application/json",
 		"Content-Encoding": "gzip",
@@ -59,13 +215,13 @@ func (c *client) Request(ctx context.Context, data []model.Metric) error {
 
 	jsonBody, mErr := json.Marshal(data)
 	if mErr != nil {
-		return c.requestError(mErr)
+		return nil, c.requestError(mErr)
 	}
 
 	if c.secretKey != "" {
 		hash, err := c.sign(jsonBody)
 		if err != nil {
-			return c.requestError(err)
+			return nil, c.requestError(err)
 		}
 
 		headers["HashSHA256"] = hex.EncodeToString(hash)
@@ -73,34 +229,35 @@ func (c *client) Request(ctx context.Context, data []model.Metric) error {
 
 	ip, err := c.getIP()
 	if err != nil {
-		return c.requestError(err)
+		return nil, c.requestError(err)
 	}
 	headers["X-Real-IP"] = ip
 
 	body, err := c.compress(jsonBody)
 	if err != nil {
-		return c.requestError(err)
+		return nil, c.requestError(err)
 	}
 
 	jsonBody, err = io.ReadAll(body)
 	if err != nil {
-		return c.requestError(err)
+		return nil, c.requestError(err)
 	}
 
 	if c.cryptoKey != "" {
 		ecrypted, err := c.encrypt(jsonBody, c.cryptoKey)
 		if err != nil {
-			return c.requestError(err)
+			return nil, c.requestError(err)
 		}
 
 		jsonBody = ecrypted
 	}
 
-	if err := c.doRequest(ctx, headers, jsonBody); err != nil {
-		return c.requestError(err)
+	results, err := c.doRequest(ctx, headers, jsonBody)
+	if err != nil {
+		return nil, c.requestError(err)
 	}
 
-	return nil
+	return results, nil
 }
 
 func (c *client) getIP() (string, error) {
@@ -196,7 +353,7 @@ func (c *client) compress(p []byte) (*bytes.Buffer, error) {
 	return body, nil
 }
 
-func (c *client) IsConnRefused(err error) bool {
-	var netErr *net.OpError
-	return errors.As(err, &netErr) && netErr.Op == "dial" && netErr.Err.Error() == "connect: connection refused"
+// CanRetry allows to resend the batch when the server is not reachable, too slow or overloaded.
+func (c *client) CanRetry(err error) bool {
+	return retry.Any(retry.IsConnRefused, retry.IsTimeout, retry.IsHTTPRetryable)(err)
 }
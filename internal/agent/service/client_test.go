@@ -2,30 +2,276 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/arefev/mtrcstore/internal/agent/model"
+	"github.com/arefev/mtrcstore/internal/tracing"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func TestDoRequestSuccess(t *testing.T) {
 	t.Run("do request success", func(t *testing.T) {
 		ctx := context.Background()
-		s := httptest.NewServer(nil)
+		s, _ := countingServer(t, false, 0)
+
+		client := NewClient("", "", s.URL, HTTPOptions{})
+		_, err := client.Request(ctx, []model.Metric{})
+		require.NoError(t, err)
+	})
+}
+
+func TestDoRequestResults(t *testing.T) {
+	t.Run("do request returns rejected metrics", func(t *testing.T) {
+		ctx := context.Background()
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "true", r.URL.Query().Get("partial"))
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte(`{"results":[{"id":"Alloc","type":"gauge","status":"rejected","reason":"test"}]}`))
+			require.NoError(t, err)
+		}))
+		defer s.Close()
+
+		client := NewClient("", "", s.URL, HTTPOptions{})
+		results, err := client.Request(ctx, []model.Metric{})
+		require.NoError(t, err)
+		require.Equal(t, []model.Result{{ID: "Alloc", MType: "gauge", Status: model.ResultRejected, Reason: "test"}}, results)
+	})
+}
+
+func TestDoRequestStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		canRetry bool
+	}{
+		{name: "server error is retried", status: http.StatusServiceUnavailable, canRetry: true},
+		{name: "too many requests is retried", status: http.StatusTooManyRequests, canRetry: true},
+		{name: "bad request is not retried", status: http.StatusBadRequest, canRetry: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer s.Close()
+
+			client := NewClient("", "", s.URL, HTTPOptions{})
+			_, err := client.Request(context.Background(), []model.Metric{})
+			require.ErrorIs(t, err, ErrRequestFail)
+			require.Equal(t, tt.canRetry, client.CanRetry(err))
+			require.Equal(t, map[string]int64{fmt.Sprintf("status_%d", tt.status): 1}, client.Failures())
+		})
+	}
+}
+
+func TestDoRequestSignature(t *testing.T) {
+	const secretKey = "test"
+	body := []byte(`{"results":[]}`)
+
+	h := hmac.New(sha256.New, []byte(secretKey))
+	_, err := h.Write(body)
+	require.NoError(t, err)
+	valid := hex.EncodeToString(h.Sum(nil))
+
+	tests := []struct {
+		err  error
+		name string
+		hash string
+	}{
+		{name: "valid signature", hash: valid},
+		{name: "missing signature", hash: "", err: ErrSignMissing},
+		{name: "wrong signature", hash: hex.EncodeToString([]byte("test")), err: ErrSignMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.hash != "" {
+					w.Header().Set("HashSHA256", tt.hash)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(body)
+			}))
+			defer s.Close()
+
+			client := NewClient(secretKey, "", s.URL, HTTPOptions{})
+			_, err := client.Request(context.Background(), []model.Metric{})
+			if tt.err == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, tt.err)
+			require.False(t, client.CanRetry(err))
+			require.Equal(t, int64(1), client.Failures()["signature"])
+		})
+	}
+}
+
+func TestRequestTrace(t *testing.T) {
+	t.Run("request sends trace context", func(t *testing.T) {
+		_, err := tracing.Setup(context.Background(), tracing.Config{})
+		require.NoError(t, err)
+
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+		var traceparent string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparent = r.Header.Get("traceparent")
+			_, _ = w.Write([]byte(`{"results":[]}`))
+		}))
 		defer s.Close()
 
-		client := NewClient("", "", s.URL)
-		err := client.Request(ctx, []model.Metric{})
+		client := NewClient("", "", s.URL, HTTPOptions{})
+		_, err = client.Request(context.Background(), []model.Metric{})
 		require.NoError(t, err)
+
+		var request sdktrace.ReadOnlySpan
+		for _, span := range recorder.Ended() {
+			if span.Name() == "client.Request" {
+				request = span
+			}
+		}
+		require.NotNil(t, request)
+		require.Contains(t, traceparent, request.SpanContext().TraceID().String())
 	})
 }
 
 func TestDoRequestFail(t *testing.T) {
 	t.Run("do request success", func(t *testing.T) {
 		ctx := context.Background()
-		client := NewClient("", "", "http://fail.lo")
-		err := client.Request(ctx, []model.Metric{})
+		client := NewClient("", "", "http://fail.lo", HTTPOptions{})
+		_, err := client.Request(ctx, []model.Metric{})
 		require.ErrorIs(t, err, ErrRequestFail)
 	})
 }
+
+// countingServer starts a test server that counts the accepted connections,
+// with h2c it also accepts HTTP/2 without TLS.
+func countingServer(tb testing.TB, h2 bool, delay time.Duration) (*httptest.Server, *atomic.Int64) {
+	tb.Helper()
+
+	var conns atomic.Int64
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if h2 && r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[]}`))
+	})
+	if h2 {
+		h = h2c.NewHandler(h, &http2.Server{})
+	}
+
+	s := httptest.NewUnstartedServer(h)
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	s.Start()
+	tb.Cleanup(s.Close)
+
+	return s, &conns
+}
+
+func TestClientConnectionReuse(t *testing.T) {
+	tests := []struct {
+		name  string
+		http2 bool
+	}{
+		{name: "keep-alive connection is reused"},
+		{name: "http2 connection is reused", http2: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, conns := countingServer(t, tt.http2, 0)
+
+			client := NewClient("", "", s.URL, HTTPOptions{MaxIdleConns: 1, HTTP2: tt.http2})
+			defer func() {
+				require.NoError(t, client.Close())
+			}()
+
+			for range 5 {
+				_, err := client.Request(ctx, []model.Metric{})
+				require.NoError(t, err)
+			}
+			require.Equal(t, int64(1), conns.Load())
+		})
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	t.Run("request is canceled after the timeout", func(t *testing.T) {
+		s, _ := countingServer(t, false, 200*time.Millisecond)
+
+		client := NewClient("", "", s.URL, HTTPOptions{Timeout: 50 * time.Millisecond})
+		_, err := client.Request(context.Background(), []model.Metric{})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func BenchmarkClientRequest(b *testing.B) {
+	ctx := context.Background()
+	var value float64 = 1
+	data := []model.Metric{{ID: "Alloc", MType: "gauge", Value: &value}}
+
+	b.Run("client per request", func(b *testing.B) {
+		s, conns := countingServer(b, false, 0)
+		b.ResetTimer()
+		for range b.N {
+			client := NewClient("", "", s.URL, HTTPOptions{})
+			if _, err := client.Request(ctx, data); err != nil {
+				b.Fatal(err)
+			}
+			_ = client.Close()
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+
+	b.Run("shared client", func(b *testing.B) {
+		s, conns := countingServer(b, false, 0)
+		client := NewClient("", "", s.URL, HTTPOptions{MaxIdleConns: 10})
+		b.ResetTimer()
+		for range b.N {
+			if _, err := client.Request(ctx, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+
+	b.Run("shared client http2", func(b *testing.B) {
+		s, conns := countingServer(b, true, 0)
+		client := NewClient("", "", s.URL, HTTPOptions{HTTP2: true})
+		b.ResetTimer()
+		for range b.N {
+			if _, err := client.Request(ctx, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+}
@@ -2,38 +2,233 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"sync"
 
 	"github.com/arefev/mtrcstore/internal/agent/model"
 	"github.com/arefev/mtrcstore/internal/proto"
+	"github.com/arefev/mtrcstore/internal/retry"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
+var (
+	// ErrStreamBroken is returned for the batches sent but not acknowledged before the stream failed or was closed.
+	// The server may have saved them, so they are not resent: a counter would be added twice.
+	ErrStreamBroken = errors.New("grpc stream broken")
+	// ErrNotSent is returned for the batches the broken stream failed to send, they can be resent safely.
+	ErrNotSent = errors.New("grpc batch not sent")
+	// ErrNoAck is returned for the batches sent but not acknowledged before the request context was done,
+	// they are not resent for the same reason as the ones of the broken stream.
+	ErrNoAck = errors.New("grpc batch not acknowledged")
+)
+
+type streamResult struct {
+	ack *proto.BatchAck
+	err error
+}
+
+// grpcClient keeps one connection and one StreamMetrics stream for all the reports.
+// The number of batches waiting for the acknowledgement is limited by the window,
+// a broken stream is reopened on the next request and the connection reconnects by itself.
 type grpcClient struct {
-	url string
+	conn    *grpc.ClientConn
+	client  proto.MetricsClient
+	stream  proto.Metrics_StreamMetricsClient
+	cancel  context.CancelFunc
+	pending map[uint64]chan streamResult
+	window  chan struct{}
+	mutex   *sync.Mutex
+	send    *sync.Mutex
+	seq     uint64
 }
 
-func NewGRPCClient(url string) *grpcClient {
+func NewGRPCClient(url string, window int) (*grpcClient, error) {
+	conn, err := grpc.NewClient(
+		url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("grpc client NewClient failed: %w", err)
+	}
+
 	return &grpcClient{
-		url: url,
+		conn:    conn,
+		client:  proto.NewMetricsClient(conn),
+		pending: make(map[uint64]chan streamResult),
+		window:  make(chan struct{}, max(window, 1)),
+		mutex:   &sync.Mutex{},
+		send:    &sync.Mutex{},
+	}, nil
+}
+
+func (gc *grpcClient) Request(ctx context.Context, data []model.Metric) ([]model.Result, error) {
+	ctx, span := tracer.Start(ctx, "grpcClient.Request", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	results, err := gc.request(ctx, data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, "request failed")
 	}
+
+	return results, err
 }
 
-func (gc *grpcClient) Request(ctx context.Context, data []model.Metric) error {
-	conn, err := grpc.NewClient(gc.url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func (gc *grpcClient) request(ctx context.Context, data []model.Metric) ([]model.Result, error) {
+	select {
+	case gc.window <- struct{}{}:
+		defer func() { <-gc.window }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("grpc request wait for window failed: %w", ctx.Err())
+	}
+
+	stream, seq, wait, err := gc.register()
+	if err != nil {
+		return nil, err
+	}
+	defer gc.forget(seq)
+
+	// the stream is shared by the batches, so the trace context goes with every batch
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	gc.send.Lock()
+	err = stream.Send(&proto.MetricBatch{Seq: seq, Metrics: metricsProto(data), Trace: carrier})
+	gc.send.Unlock()
+
 	if err != nil {
-		return fmt.Errorf("grpc request NewClient failed: %w", err)
+		gc.broken(stream, err)
+		return nil, fmt.Errorf("grpc request send batch failed: %w: %w", ErrNotSent, err)
 	}
-	defer func() {
-		if err = conn.Close(); err != nil {
-			log.Printf("grpc request conn close failed: %s", err.Error())
+
+	select {
+	case res := <-wait:
+		if res.err != nil {
+			return nil, fmt.Errorf("grpc request batch %d failed: %w", seq, res.err)
 		}
-	}()
-	client := proto.NewMetricsClient(conn)
+		return resultsModel(res.ack)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("grpc request wait for ack failed: %w: %w", ErrNoAck, ctx.Err())
+	}
+}
 
+// register assigns the next sequence number to the batch, the stream is opened if there is none.
+func (gc *grpcClient) register() (proto.Metrics_StreamMetricsClient, uint64, chan streamResult, error) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.stream == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := gc.client.StreamMetrics(ctx)
+		if err != nil {
+			cancel()
+			return nil, 0, nil, fmt.Errorf("grpc request open stream failed: %w", err)
+		}
+
+		gc.stream = stream
+		gc.cancel = cancel
+		go gc.receive(stream)
+	}
+
+	gc.seq++
+	wait := make(chan streamResult, 1)
+	gc.pending[gc.seq] = wait
+
+	return gc.stream, gc.seq, wait, nil
+}
+
+func (gc *grpcClient) forget(seq uint64) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	delete(gc.pending, seq)
+}
+
+// receive delivers the acknowledgements to the waiting requests until the stream fails.
+func (gc *grpcClient) receive(stream proto.Metrics_StreamMetricsClient) {
+	for {
+		ack, err := stream.Recv()
+		if err != nil {
+			gc.broken(stream, err)
+			return
+		}
+
+		gc.mutex.Lock()
+		wait, ok := gc.pending[ack.GetSeq()]
+		delete(gc.pending, ack.GetSeq())
+		gc.mutex.Unlock()
+
+		if ok {
+			wait <- streamResult{ack: ack}
+		}
+	}
+}
+
+// broken drops the failed stream and fails the batches waiting for it.
+func (gc *grpcClient) broken(stream proto.Metrics_StreamMetricsClient, err error) {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.stream != stream {
+		return
+	}
+
+	gc.cancel()
+	gc.stream = nil
+	gc.failPending(err)
+}
+
+// failPending fails the batches waiting for the acknowledgement, the caller holds the mutex.
+func (gc *grpcClient) failPending(err error) {
+	for seq, wait := range gc.pending {
+		wait <- streamResult{err: fmt.Errorf("%w: %w", ErrStreamBroken, err)}
+		delete(gc.pending, seq)
+	}
+}
+
+// Close cancels the stream, fails the batches still waiting for it and closes the connection.
+// The send lock is not taken: a send blocked by a stalled server is only released by the cancel.
+func (gc *grpcClient) Close() error {
+	gc.mutex.Lock()
+	if gc.stream != nil {
+		gc.cancel()
+		gc.stream = nil
+		gc.failPending(errors.New("grpc client closed"))
+	}
+	gc.mutex.Unlock()
+
+	if err := gc.conn.Close(); err != nil {
+		return fmt.Errorf("grpc client close failed: %w", err)
+	}
+
+	return nil
+}
+
+// CanRetry allows to resend the batch the broken stream did not send or an unavailable server rejected,
+// a batch lost with the stream or not acknowledged in time after it was sent is not resent.
+func (gc *grpcClient) CanRetry(err error) bool {
+	if errors.Is(err, ErrStreamBroken) || errors.Is(err, ErrNoAck) {
+		return false
+	}
+
+	return retry.Any(isNotSent, retry.IsGRPCUnavailable, retry.IsTimeout)(err)
+}
+
+func isNotSent(err error) bool {
+	return errors.Is(err, ErrNotSent)
+}
+
+func metricsProto(data []model.Metric) []*proto.Metric {
 	pMetrics := make([]*proto.Metric, 0, len(data))
 	for _, m := range data {
 		pm := &proto.Metric{
@@ -52,17 +247,22 @@ func (gc *grpcClient) Request(ctx context.Context, data []model.Metric) error {
 		pMetrics = append(pMetrics, pm)
 	}
 
-	_, err = client.UpdateMetric(ctx, &proto.UpdateMetricRequest{
-		Metrics: pMetrics,
-	})
+	return pMetrics
+}
 
-	if err != nil {
-		return fmt.Errorf("grpc request UpdateMetric failed: %w", err)
+func resultsModel(ack *proto.BatchAck) ([]model.Result, error) {
+	if code := codes.Code(ack.GetCode()); code != codes.OK {
+		return nil, fmt.Errorf("grpc request batch %d rejected: %w", ack.GetSeq(), status.Error(code, ack.GetError()))
 	}
 
-	return nil
-}
+	results := make([]model.Result, 0, len(ack.GetResults()))
+	for _, r := range ack.GetResults() {
+		res := model.Result{ID: r.GetID(), MType: r.GetType(), Status: model.ResultAccepted, Reason: r.GetReason()}
+		if !r.GetAccepted() {
+			res.Status = model.ResultRejected
+		}
+		results = append(results, res)
+	}
 
-func (gc *grpcClient) IsConnRefused(err error) bool {
-	return strings.Contains(err.Error(), "connection refused")
+	return results, nil
 }
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/agent/model"
+	"github.com/arefev/mtrcstore/internal/proto"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+type streamServer struct {
+	proto.UnimplementedMetricsServer
+}
+
+func (s *streamServer) StreamMetrics(stream proto.Metrics_StreamMetricsServer) error {
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		ack := &proto.BatchAck{Seq: batch.GetSeq()}
+		for _, m := range batch.GetMetrics() {
+			ack.Results = append(ack.Results, &proto.MetricResult{
+				ID:       m.GetID(),
+				Type:     m.GetType(),
+				Accepted: m.GetType() == "gauge",
+			})
+		}
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// silentServer reads the batches and never acknowledges them.
+type silentServer struct {
+	proto.UnimplementedMetricsServer
+	received chan struct{}
+}
+
+func (s *silentServer) StreamMetrics(stream proto.Metrics_StreamMetricsServer) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return nil
+		}
+		s.received <- struct{}{}
+	}
+}
+
+// stalledServer never reads the batches, so the sends block on the flow control.
+type stalledServer struct {
+	proto.UnimplementedMetricsServer
+}
+
+func (s *stalledServer) StreamMetrics(stream proto.Metrics_StreamMetricsServer) error {
+	<-stream.Context().Done()
+	return nil
+}
+
+func serveStream(t *testing.T, addr string) *grpc.Server {
+	t.Helper()
+
+	return serve(t, addr, &streamServer{})
+}
+
+func serve(t *testing.T, addr string, s proto.MetricsServer) *grpc.Server {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	proto.RegisterMetricsServer(srv, s)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+
+	return srv
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, lis.Close())
+	}()
+
+	return lis.Addr().String()
+}
+
+func TestGRPCClientStream(t *testing.T) {
+	t.Run("grpc client sends concurrent batches over one stream", func(t *testing.T) {
+		ctx := context.Background()
+		var value float64 = 1
+
+		addr := freeAddr(t)
+
+		srv := serveStream(t, addr)
+		defer srv.Stop()
+
+		client, err := NewGRPCClient(addr, 2)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, client.Close())
+		}()
+
+		g := &errgroup.Group{}
+		for range 10 {
+			g.Go(func() error {
+				_, err := client.Request(ctx, []model.Metric{{ID: "Alloc", MType: "gauge", Value: &value}})
+				return err
+			})
+		}
+		require.NoError(t, g.Wait())
+		require.Empty(t, client.pending)
+	})
+
+	t.Run("grpc client reopens the stream after the server restart", func(t *testing.T) {
+		ctx := context.Background()
+		var value float64 = 1
+
+		addr := freeAddr(t)
+
+		client, err := NewGRPCClient(addr, 2)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, client.Close())
+		}()
+
+		data := []model.Metric{
+			{ID: "Alloc", MType: "gauge", Value: &value},
+			{ID: "PollCount", MType: "counter"},
+		}
+
+		srv := serveStream(t, addr)
+		for range 3 {
+			results, err := client.Request(ctx, data)
+			require.NoError(t, err)
+			require.Equal(t, model.ResultAccepted, results[0].Status)
+			require.Equal(t, model.ResultRejected, results[1].Status)
+		}
+		srv.Stop()
+		require.Eventually(t, func() bool {
+			client.mutex.Lock()
+			defer client.mutex.Unlock()
+			return client.stream == nil
+		}, time.Second, 10*time.Millisecond)
+
+		_, err = client.Request(ctx, data)
+		require.Error(t, err)
+		require.True(t, client.CanRetry(err))
+
+		srv = serveStream(t, addr)
+		defer srv.Stop()
+
+		require.Eventually(t, func() bool {
+			results, err := client.Request(ctx, data)
+			return err == nil && len(results) == 2
+		}, 5*time.Second, 100*time.Millisecond)
+	})
+	t.Run("grpc client does not resend the batch sent before the close", func(t *testing.T) {
+		var value float64 = 1
+
+		addr := freeAddr(t)
+
+		silent := &silentServer{received: make(chan struct{}, 1)}
+		srv := serve(t, addr, silent)
+		defer srv.Stop()
+
+		client, err := NewGRPCClient(addr, 1)
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.Request(context.Background(), []model.Metric{{ID: "Alloc", MType: "gauge", Value: &value}})
+			done <- err
+		}()
+
+		<-silent.received
+		require.NoError(t, client.Close())
+
+		select {
+		case err := <-done:
+			require.ErrorIs(t, err, ErrStreamBroken)
+			require.False(t, client.CanRetry(err))
+		case <-time.After(time.Second):
+			require.Fail(t, "request is still waiting after the close")
+		}
+	})
+	t.Run("grpc client does not resend the batch not acknowledged in time", func(t *testing.T) {
+		var value float64 = 1
+
+		addr := freeAddr(t)
+
+		silent := &silentServer{received: make(chan struct{}, 1)}
+		srv := serve(t, addr, silent)
+		defer srv.Stop()
+
+		client, err := NewGRPCClient(addr, 1)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, client.Close())
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err = client.Request(ctx, []model.Metric{{ID: "Alloc", MType: "gauge", Value: &value}})
+		require.ErrorIs(t, err, ErrNoAck)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, client.CanRetry(err))
+	})
+
+	t.Run("grpc client closes while a send is blocked", func(t *testing.T) {
+		addr := freeAddr(t)
+
+		srv := serve(t, addr, &stalledServer{})
+		defer srv.Stop()
+
+		client, err := NewGRPCClient(addr, 2)
+		require.NoError(t, err)
+
+		data := make([]model.Metric, 0, 20000)
+		for i := range 20000 {
+			delta := int64(i)
+			data = append(data, model.Metric{ID: fmt.Sprintf("%s%d", strings.Repeat("a", 64), i), MType: "counter", Delta: &delta})
+		}
+
+		// the first batch is buffered by the stream, the second one waits for the flow control
+		done := make(chan error, 2)
+		for range 2 {
+			go func() {
+				_, err := client.Request(context.Background(), data)
+				done <- err
+			}()
+		}
+
+		// the send lock is held while the batch waits for the flow control
+		require.Eventually(t, func() bool {
+			if client.send.TryLock() {
+				client.send.Unlock()
+				return false
+			}
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- client.Close()
+		}()
+
+		select {
+		case err := <-closed:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			require.Fail(t, "close is blocked by the send")
+		}
+
+		for range 2 {
+			select {
+			case err := <-done:
+				require.Error(t, err)
+			case <-time.After(time.Second):
+				require.Fail(t, "request is still sending after the close")
+			}
+		}
+	})
+}
@@ -140,26 +140,27 @@ func (m *MockSender) EXPECT() *MockSenderMockRecorder {
 	return m.recorder
 }
 
-// IsConnRefused mocks base method.
-func (m *MockSender) IsConnRefused(err error) bool {
+// CanRetry mocks base method.
+func (m *MockSender) CanRetry(err error) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsConnRefused", err)
+	ret := m.ctrl.Call(m, "CanRetry", err)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
-// IsConnRefused indicates an expected call of IsConnRefused.
-func (mr *MockSenderMockRecorder) IsConnRefused(err interface{}) *gomock.Call {
+// CanRetry indicates an expected call of CanRetry.
+func (mr *MockSenderMockRecorder) CanRetry(err interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsConnRefused", reflect.TypeOf((*MockSender)(nil).IsConnRefused), err)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CanRetry", reflect.TypeOf((*MockSender)(nil).CanRetry), err)
 }
 
 // Request mocks base method.
-func (m *MockSender) Request(ctx context.Context, data []model.Metric) error {
+func (m *MockSender) Request(ctx context.Context, data []model.Metric) ([]model.Result, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Request", ctx, data)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].([]model.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Request indicates an expected call of Request.
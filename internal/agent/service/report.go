@@ -5,11 +5,18 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"time"
 
 	"github.com/arefev/mtrcstore/internal/agent/model"
+	"github.com/arefev/mtrcstore/internal/breaker"
 	"github.com/arefev/mtrcstore/internal/retry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+var tracer = otel.Tracer("github.com/arefev/mtrcstore/internal/agent/service")
+
 type Gauge float64
 type Counter int64
 
@@ -23,13 +30,20 @@ type Storage interface {
 }
 
 type Sender interface {
-	Request(ctx context.Context, data []model.Metric) error
-	IsConnRefused(err error) bool
+	Request(ctx context.Context, data []model.Metric) ([]model.Result, error)
+	CanRetry(err error) bool
+}
+
+// FailureReporter is implemented by senders that count the failed requests by the reason.
+type FailureReporter interface {
+	Failures() map[string]int64
 }
 
 type Report struct {
 	Storage     Storage
+	Telemetry   *Telemetry
 	sender      Sender
+	breaker     *breaker.Breaker
 	gaugeName   string
 	counterName string
 }
@@ -42,19 +56,81 @@ func NewReport(s Storage, sender Sender) *Report {
 
 	return &Report{
 		Storage:     s,
+		Telemetry:   &Telemetry{},
 		gaugeName:   gaugeName,
 		counterName: counterName,
 		sender:      sender,
 	}
 }
 
+// WithBreaker stops sending the reports for a while when the server keeps failing,
+// so the workers do not pile up waiting for the retries.
+func (r *Report) WithBreaker(s breaker.Settings) *Report {
+	s.Name = "server"
+	s.IsFailure = r.sender.CanRetry
+	s.OnStateChange = func(name string, from, to breaker.State) {
+		log.Printf("report circuit breaker %s changed state from %s to %s", name, from, to)
+	}
+	r.breaker = breaker.New(s)
+
+	return r
+}
+
+// Breakers returns the state of the breaker for the status endpoint.
+func (r *Report) Breakers() []breaker.Status {
+	if r.breaker == nil {
+		return []breaker.Status{}
+	}
+
+	return []breaker.Status{r.breaker.Status()}
+}
+
+// Failures returns the failure counters of the sender for the status endpoint.
+func (r *Report) Failures() map[string]int64 {
+	if f, ok := r.sender.(FailureReporter); ok {
+		return f.Failures()
+	}
+
+	return map[string]int64{}
+}
+
 func (r *Report) Send(ctx context.Context, metrics []model.Metric) {
 	const rCount = 3
+	ctx, span := tracer.Start(ctx, "Report.Send")
+	defer span.End()
+
+	var results []model.Result
+	attempts := 0
 	action := func() error {
-		return r.sender.Request(ctx, metrics)
+		attempts++
+		return r.breaker.Do(func() error {
+			start := time.Now()
+			var err error
+			results, err = r.sender.Request(ctx, metrics)
+			r.Telemetry.observeSend(time.Since(start))
+			return err
+		})
 	}
-	if err := retry.New(action, r.sender.IsConnRefused, rCount).Run(); err != nil {
+
+	err := retry.New(action, r.sender.CanRetry, rCount).RunContext(ctx)
+	r.Telemetry.observeBatch(err != nil, attempts-1)
+	span.SetAttributes(attribute.Int("metrics.count", len(metrics)), attribute.Int("attempts", attempts))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "send failed")
 		log.Printf("report failed to send the metrics: %s", err.Error())
+		return
+	}
+
+	r.logRejected(results)
+}
+
+// logRejected reports the metrics the server refused to save while the rest of the batch was accepted.
+func (r *Report) logRejected(results []model.Result) {
+	for _, res := range results {
+		if res.Status == model.ResultRejected {
+			log.Printf("report metric %s %s rejected: %s", res.MType, res.ID, res.Reason)
+		}
 	}
 }
 
@@ -62,6 +138,7 @@ func (r *Report) GetMetrics() []model.Metric {
 	metrics := make([]model.Metric, 0)
 	metrics = append(metrics, r.getGauges()...)
 	metrics = append(metrics, r.getCounters()...)
+	metrics = append(metrics, r.Telemetry.Metrics()...)
 	return metrics
 }
 
@@ -2,12 +2,15 @@ package service_test
 
 import (
 	"context"
+	"errors"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/arefev/mtrcstore/internal/agent/repository"
 	"github.com/arefev/mtrcstore/internal/agent/service"
 	mock_service "github.com/arefev/mtrcstore/internal/agent/service/mocks"
+	"github.com/arefev/mtrcstore/internal/breaker"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 )
@@ -98,3 +101,34 @@ func TestSendSuccess(t *testing.T) {
 		report.Send(ctx, mtrs)
 	})
 }
+
+func TestSendBreaker(t *testing.T) {
+	t.Run("open breaker stops sending", func(t *testing.T) {
+		ctx := context.Background()
+		errTest := errors.New("test")
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		storage := repository.NewMemory()
+
+		client := mock_service.NewMockSender(ctrl)
+		client.EXPECT().Request(gomock.Any(), gomock.Any()).Return(nil, errTest).Times(1)
+		client.EXPECT().CanRetry(gomock.Any()).DoAndReturn(func(err error) bool {
+			return errors.Is(err, errTest)
+		}).AnyTimes()
+
+		report := service.NewReport(&storage, client).WithBreaker(breaker.Settings{
+			Threshold:   1,
+			OpenTimeout: time.Hour,
+		})
+
+		report.Send(ctx, report.GetMetrics())
+		report.Send(ctx, report.GetMetrics())
+
+		statuses := report.Breakers()
+		require.Len(t, statuses, 1)
+		require.Equal(t, "open", statuses[0].State)
+		require.Positive(t, statuses[0].Rejected)
+	})
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/agent/model"
+)
+
+// telemetryCounter keeps the total for the status endpoint and
+// the part of it already reported, because the server adds up the counter deltas.
+type telemetryCounter struct {
+	total    atomic.Int64
+	reported atomic.Int64
+}
+
+func (c *telemetryCounter) add(n int64) {
+	c.total.Add(n)
+}
+
+// delta returns the growth since the previous call.
+func (c *telemetryCounter) delta() int64 {
+	total := c.total.Load()
+	return total - c.reported.Swap(total)
+}
+
+// Telemetry describes the work of the agent itself, it is sent to the server with the collected metrics.
+type Telemetry struct {
+	batchesSent     telemetryCounter
+	batchesFailed   telemetryCounter
+	retries         telemetryCounter
+	dropped         telemetryCounter
+	sendLatency     atomic.Int64 // duration of the last request in nanoseconds
+	collectDuration atomic.Int64 // duration of the last collection in nanoseconds
+	queueDepth      atomic.Int64 // batches waiting for a worker
+}
+
+func (t *Telemetry) observeSend(d time.Duration) {
+	t.sendLatency.Store(int64(d))
+}
+
+// observeBatch counts the batch once all its attempts are over.
+func (t *Telemetry) observeBatch(failed bool, retries int) {
+	if failed {
+		t.batchesFailed.add(1)
+	} else {
+		t.batchesSent.add(1)
+	}
+	t.retries.add(int64(retries))
+}
+
+func (t *Telemetry) drop() {
+	t.dropped.add(1)
+}
+
+func (t *Telemetry) setQueueDepth(n int) {
+	t.queueDepth.Store(int64(n))
+}
+
+// ObserveCollect records how long the last collection of the metrics took.
+func (t *Telemetry) ObserveCollect(d time.Duration) {
+	t.collectDuration.Store(int64(d))
+}
+
+// Metrics returns the telemetry in the format of the collected metrics, the counters hold the growth since the last call.
+func (t *Telemetry) Metrics() []model.Metric {
+	gauges := map[string]float64{
+		"AgentSendLatency":     time.Duration(t.sendLatency.Load()).Seconds(),
+		"AgentCollectDuration": time.Duration(t.collectDuration.Load()).Seconds(),
+		"AgentQueueDepth":      float64(t.queueDepth.Load()),
+	}
+
+	counters := map[string]int64{
+		"AgentBatchesSent":    t.batchesSent.delta(),
+		"AgentBatchesFailed":  t.batchesFailed.delta(),
+		"AgentRetries":        t.retries.delta(),
+		"AgentBatchesDropped": t.dropped.delta(),
+	}
+
+	metrics := make([]model.Metric, 0, len(gauges)+len(counters))
+	for name, val := range gauges {
+		value := val
+		metrics = append(metrics, model.Metric{ID: name, MType: "gauge", Value: &value})
+	}
+
+	for name, val := range counters {
+		delta := val
+		metrics = append(metrics, model.Metric{ID: name, MType: "counter", Delta: &delta})
+	}
+
+	return metrics
+}
+
+// Snapshot returns the totals for the local debug endpoint.
+func (t *Telemetry) Snapshot() map[string]any {
+	return map[string]any{
+		"batches_sent":             t.batchesSent.total.Load(),
+		"batches_failed":           t.batchesFailed.total.Load(),
+		"retries":                  t.retries.total.Load(),
+		"batches_dropped":          t.dropped.total.Load(),
+		"queue_depth":              t.queueDepth.Load(),
+		"send_latency_seconds":     time.Duration(t.sendLatency.Load()).Seconds(),
+		"collect_duration_seconds": time.Duration(t.collectDuration.Load()).Seconds(),
+	}
+}
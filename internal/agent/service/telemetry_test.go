@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetryMetrics(t *testing.T) {
+	t.Run("counters are reported as deltas", func(t *testing.T) {
+		tm := &Telemetry{}
+		tm.observeBatch(false, 2)
+		tm.observeBatch(true, 0)
+		tm.drop()
+		tm.setQueueDepth(3)
+		tm.ObserveCollect(time.Second)
+
+		values := func() map[string]float64 {
+			values := make(map[string]float64)
+			for _, m := range tm.Metrics() {
+				if m.Delta != nil {
+					values[m.ID] = float64(*m.Delta)
+					continue
+				}
+				values[m.ID] = *m.Value
+			}
+			return values
+		}
+
+		first := values()
+		require.Equal(t, float64(1), first["AgentBatchesSent"])
+		require.Equal(t, float64(1), first["AgentBatchesFailed"])
+		require.Equal(t, float64(2), first["AgentRetries"])
+		require.Equal(t, float64(1), first["AgentBatchesDropped"])
+		require.Equal(t, float64(3), first["AgentQueueDepth"])
+		require.Equal(t, float64(1), first["AgentCollectDuration"])
+
+		tm.observeBatch(false, 0)
+		second := values()
+		require.Equal(t, float64(1), second["AgentBatchesSent"])
+		require.Zero(t, second["AgentRetries"])
+
+		snapshot := tm.Snapshot()
+		require.Equal(t, int64(2), snapshot["batches_sent"])
+		require.Equal(t, int64(2), snapshot["retries"])
+	})
+}
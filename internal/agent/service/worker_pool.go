@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"log"
 
 	"github.com/arefev/mtrcstore/internal/agent/model"
 )
@@ -9,6 +10,7 @@ import (
 type WorkerPool struct {
 	Report    *Report
 	jobChan   chan []model.Metric
+	slots     chan struct{} // places in the queue, taken before the batch is built
 	rateLimit int
 }
 
@@ -21,6 +23,7 @@ func NewWorkerPool(report *Report, rateLimit int) *WorkerPool {
 
 func (wp *WorkerPool) Run(ctx context.Context) {
 	wp.jobChan = make(chan []model.Metric, wp.rateLimit)
+	wp.slots = make(chan struct{}, wp.rateLimit)
 
 	for range wp.rateLimit {
 		go wp.worker(ctx)
@@ -29,11 +32,24 @@ func (wp *WorkerPool) Run(ctx context.Context) {
 
 func (wp *WorkerPool) worker(ctx context.Context) {
 	for metrics := range wp.jobChan {
+		<-wp.slots
 		wp.Report.Send(ctx, metrics)
 	}
 }
 
+// Send queues the collected metrics for the workers, the batch is dropped when all the workers are busy
+// and the queue is full. The batch is built only after a place in the queue is taken,
+// so the counters and the telemetry deltas of a dropped batch are kept until the next report.
 func (wp *WorkerPool) Send() {
-	wp.jobChan <- wp.Report.GetMetrics()
-	wp.Report.ClearCounter()
+	wp.Report.Telemetry.setQueueDepth(len(wp.jobChan))
+
+	// the place is taken in one step, so concurrent senders never block on the full queue
+	select {
+	case wp.slots <- struct{}{}:
+		wp.jobChan <- wp.Report.GetMetrics()
+		wp.Report.ClearCounter()
+	default:
+		wp.Report.Telemetry.drop()
+		log.Printf("worker pool queue is full, batch dropped")
+	}
 }
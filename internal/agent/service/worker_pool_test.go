@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/arefev/mtrcstore/internal/agent/model"
 	"github.com/arefev/mtrcstore/internal/agent/repository"
 	"github.com/arefev/mtrcstore/internal/agent/service"
 	mock_service "github.com/arefev/mtrcstore/internal/agent/service/mocks"
@@ -47,3 +48,99 @@ func TestWorkerPoolRunSuccess(t *testing.T) {
 		require.Equal(t, 0, int(counter["PollCount"]))
 	})
 }
+
+func TestWorkerPoolDrop(t *testing.T) {
+	t.Run("batch is dropped when the queue is full", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		storage := repository.NewMemory()
+		client := mock_service.NewMockSender(ctrl)
+		client.EXPECT().Request(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, []model.Metric) ([]model.Result, error) {
+				started <- struct{}{}
+				<-release
+				return nil, nil
+			},
+		).Times(2)
+
+		report := service.NewReport(&storage, client)
+		report.IncrementCounter()
+
+		pool := service.NewWorkerPool(report, 1)
+		pool.Run(ctx)
+		pool.Send()
+		<-started
+
+		pool.Send()
+		pool.Send()
+		require.Equal(t, int64(1), report.Telemetry.Snapshot()["batches_dropped"])
+		require.Equal(t, int64(1), report.Telemetry.Snapshot()["queue_depth"])
+
+		close(release)
+		require.Eventually(t, func() bool {
+			return report.Telemetry.Snapshot()["batches_sent"] == int64(2)
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestWorkerPoolDropKeepsTelemetry(t *testing.T) {
+	t.Run("telemetry of the dropped batches goes with the next one", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		started := make(chan struct{}, 3)
+		release := make(chan struct{})
+		batches := make(chan []model.Metric, 3)
+		storage := repository.NewMemory()
+		client := mock_service.NewMockSender(ctrl)
+		client.EXPECT().Request(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, data []model.Metric) ([]model.Result, error) {
+				started <- struct{}{}
+				<-release
+				batches <- data
+				return nil, nil
+			},
+		).Times(3)
+
+		report := service.NewReport(&storage, client)
+
+		pool := service.NewWorkerPool(report, 1)
+		pool.Run(ctx)
+		pool.Send()
+		<-started
+
+		// the worker is busy and the queue holds one batch, the next two are dropped
+		pool.Send()
+		pool.Send()
+		pool.Send()
+		require.Equal(t, int64(2), report.Telemetry.Snapshot()["batches_dropped"])
+
+		close(release)
+		require.Eventually(t, func() bool {
+			return report.Telemetry.Snapshot()["batches_sent"] == int64(2)
+		}, time.Second, 10*time.Millisecond)
+
+		pool.Send()
+		<-batches
+		<-batches
+		last := <-batches
+
+		deltas := make(map[string]int64)
+		for _, m := range last {
+			if m.Delta != nil {
+				deltas[m.ID] = *m.Delta
+			}
+		}
+		require.Equal(t, int64(2), deltas["AgentBatchesDropped"])
+		require.Equal(t, int64(2), deltas["AgentBatchesSent"])
+	})
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/agent/service"
+)
+
+// ServeStatus serves the state of the agent and its telemetry in the expvar format
+// on the local address until ctx is done.
+func ServeStatus(ctx context.Context, addr string, report *service.Report) error {
+	const shutdownTimeout = 5 * time.Second
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		data := map[string]any{
+			"breakers": report.Breakers(),
+			"failures": report.Failures(),
+		}
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			log.Printf("status response writer failed: %s", err.Error())
+		}
+	})
+
+	mux.HandleFunc("GET /debug/vars", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		vars := map[string]any{
+			"agent": report.Telemetry.Snapshot(),
+		}
+		expvar.Do(func(kv expvar.KeyValue) {
+			vars[kv.Key] = json.RawMessage(kv.Value.String())
+		})
+		if err := json.NewEncoder(w).Encode(vars); err != nil {
+			log.Printf("debug vars response writer failed: %s", err.Error())
+		}
+	})
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		sCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(sCtx); err != nil {
+			log.Printf("status server shutdown failed: %s", err.Error())
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("status server failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/agent/repository"
+	"github.com/arefev/mtrcstore/internal/agent/service"
+	"github.com/arefev/mtrcstore/internal/breaker"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeStatus(t *testing.T) {
+	t.Run("status endpoint reports the breaker state", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := lis.Addr().String()
+		require.NoError(t, lis.Close())
+
+		storage := repository.NewMemory()
+		client := service.NewClient("", "", "http://"+addr, service.HTTPOptions{})
+		report := service.NewReport(&storage, client).WithBreaker(breaker.Settings{})
+
+		done := make(chan error)
+		go func() {
+			done <- ServeStatus(ctx, addr, report)
+		}()
+
+		var res *resty.Response
+		require.Eventually(t, func() bool {
+			res, err = resty.New().R().Get("http://" + addr + "/status")
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Contains(t, string(res.Body()), `"state":"closed"`)
+
+		res, err = resty.New().R().Get("http://" + addr + "/debug/vars")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode())
+		require.Contains(t, string(res.Body()), `"batches_sent":0`)
+		require.Contains(t, string(res.Body()), `"memstats"`)
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+}
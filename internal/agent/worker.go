@@ -44,6 +44,11 @@ func (w *Worker) Run(ctx context.Context) error {
 }
 
 func (w *Worker) read(memStats *runtime.MemStats) error {
+	start := time.Now()
+	defer func() {
+		w.WorkerPool.Report.Telemetry.ObserveCollect(time.Since(start))
+	}()
+
 	g := &errgroup.Group{}
 
 	g.Go(func() error {
@@ -40,7 +40,7 @@ func TestWorker_read(t *testing.T) {
 			serverHost := "http://localhost:8080"
 			storage := repository.NewMemory()
 
-			client := service.NewClient("", "", serverHost)
+			client := service.NewClient("", "", serverHost, service.HTTPOptions{})
 			report := service.NewReport(&storage, client)
 
 			wp := service.NewWorkerPool(report, tt.fields.RateLimit)
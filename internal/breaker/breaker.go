@@ -0,0 +1,198 @@
+// The breaker package stops calling a failing dependency for a while,
+// so the callers fail fast instead of waiting for the retries and timeouts.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned without calling the action while the breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed   State = iota // calls pass through, the failures are counted
+	Open                  // calls are rejected until OpenTimeout passes
+	HalfOpen              // a limited number of trial calls decide whether to close or open again
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Settings configures the breaker, zero values are replaced with the defaults.
+type Settings struct {
+	IsFailure     func(err error) bool              // errors that count as failures, all errors when nil
+	OnStateChange func(name string, from, to State) // called without the lock held
+	Name          string
+	Threshold     int           // consecutive failures that open the breaker
+	HalfOpenCalls int           // successful trial calls that close the breaker
+	OpenTimeout   time.Duration // time in the open state before the trial calls
+}
+
+// Status is a snapshot of the breaker for logs and status endpoints.
+type Status struct {
+	Changed  time.Time `json:"changed"`
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Failures int       `json:"failures"` // consecutive failures in the closed state
+	Rejected int64     `json:"rejected"` // calls rejected while open
+}
+
+type Breaker struct {
+	changed   time.Time
+	mutex     *sync.Mutex
+	settings  Settings
+	state     State
+	failures  int
+	trials    int
+	successes int
+	rejected  int64
+}
+
+func New(s Settings) *Breaker {
+	const (
+		threshold     = 5
+		halfOpenCalls = 1
+		openTimeout   = 10 * time.Second
+	)
+
+	if s.Threshold <= 0 {
+		s.Threshold = threshold
+	}
+
+	if s.HalfOpenCalls <= 0 {
+		s.HalfOpenCalls = halfOpenCalls
+	}
+
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = openTimeout
+	}
+
+	return &Breaker{
+		settings: s,
+		mutex:    &sync.Mutex{},
+		changed:  time.Now(),
+	}
+}
+
+// Do calls the action unless the breaker is open, a nil breaker always calls it.
+func (b *Breaker) Do(action func() error) error {
+	if b == nil {
+		return action()
+	}
+
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := action()
+	b.record(err)
+
+	return err
+}
+
+func (b *Breaker) allow() error {
+	b.mutex.Lock()
+
+	from := b.state
+	if b.state == Open && time.Since(b.changed) >= b.settings.OpenTimeout {
+		b.setState(HalfOpen)
+	}
+
+	var err error
+	switch {
+	case b.state == Open, b.state == HalfOpen && b.trials >= b.settings.HalfOpenCalls:
+		b.rejected++
+		err = ErrOpen
+	case b.state == HalfOpen:
+		b.trials++
+	}
+
+	to := b.state
+	b.mutex.Unlock()
+
+	if to != from {
+		b.notify(from, to)
+	}
+
+	return err
+}
+
+func (b *Breaker) record(err error) {
+	failed := err != nil && (b.settings.IsFailure == nil || b.settings.IsFailure(err))
+
+	b.mutex.Lock()
+	from, to := b.state, b.state
+
+	switch {
+	case failed && b.state == HalfOpen:
+		to = Open
+	case failed:
+		b.failures++
+		if b.failures >= b.settings.Threshold {
+			to = Open
+		}
+	case b.state == HalfOpen:
+		b.successes++
+		if b.successes >= b.settings.HalfOpenCalls {
+			to = Closed
+		}
+	default:
+		b.failures = 0
+	}
+
+	if to != from {
+		b.setState(to)
+	}
+	b.mutex.Unlock()
+
+	if to != from {
+		b.notify(from, to)
+	}
+}
+
+// setState switches the state and resets the counters, the caller holds the lock.
+func (b *Breaker) setState(to State) {
+	b.state = to
+	b.changed = time.Now()
+	b.failures = 0
+	b.trials = 0
+	b.successes = 0
+}
+
+func (b *Breaker) notify(from, to State) {
+	if b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.settings.Name, from, to)
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+func (b *Breaker) Status() Status {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return Status{
+		Name:     b.settings.Name,
+		State:    b.state.String(),
+		Failures: b.failures,
+		Rejected: b.rejected,
+		Changed:  b.changed,
+	}
+}
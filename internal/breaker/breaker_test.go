@@ -0,0 +1,98 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errTest = errors.New("test")
+
+func fail() error    { return errTest }
+func succeed() error { return nil }
+
+func TestBreakerOpens(t *testing.T) {
+	t.Run("breaker opens after the threshold and rejects the calls", func(t *testing.T) {
+		var changes []State
+		b := New(Settings{
+			Threshold:   2,
+			OpenTimeout: time.Hour,
+			OnStateChange: func(_ string, _, to State) {
+				changes = append(changes, to)
+			},
+		})
+
+		require.ErrorIs(t, b.Do(fail), errTest)
+		require.Equal(t, Closed, b.State())
+		require.ErrorIs(t, b.Do(fail), errTest)
+		require.Equal(t, Open, b.State())
+
+		called := false
+		err := b.Do(func() error {
+			called = true
+			return nil
+		})
+		require.ErrorIs(t, err, ErrOpen)
+		require.False(t, called)
+		require.Equal(t, int64(1), b.Status().Rejected)
+		require.Equal(t, []State{Open}, changes)
+	})
+
+	t.Run("success resets the consecutive failures", func(t *testing.T) {
+		b := New(Settings{Threshold: 2})
+		require.Error(t, b.Do(fail))
+		require.NoError(t, b.Do(succeed))
+		require.Error(t, b.Do(fail))
+		require.Equal(t, Closed, b.State())
+	})
+
+	t.Run("ignored errors are not failures", func(t *testing.T) {
+		b := New(Settings{Threshold: 1, IsFailure: func(err error) bool { return false }})
+		require.Error(t, b.Do(fail))
+		require.Equal(t, Closed, b.State())
+	})
+
+	t.Run("nil breaker calls the action", func(t *testing.T) {
+		var b *Breaker
+		require.ErrorIs(t, b.Do(fail), errTest)
+	})
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		action func() error
+		name   string
+		want   State
+	}{
+		{name: "successful trial closes the breaker", action: succeed, want: Closed},
+		{name: "failed trial opens the breaker again", action: fail, want: Open},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(Settings{Threshold: 1, OpenTimeout: 10 * time.Millisecond})
+			require.Error(t, b.Do(fail))
+			require.Equal(t, Open, b.State())
+
+			time.Sleep(20 * time.Millisecond)
+
+			trial := make(chan struct{})
+			done := make(chan error)
+			go func() {
+				done <- b.Do(func() error {
+					<-trial
+					return tt.action()
+				})
+			}()
+
+			require.Eventually(t, func() bool { return b.State() == HalfOpen }, time.Second, time.Millisecond)
+			require.ErrorIs(t, b.Do(succeed), ErrOpen)
+
+			close(trial)
+			<-done
+			require.Equal(t, tt.want, b.State())
+		})
+	}
+}
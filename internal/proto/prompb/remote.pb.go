@@ -0,0 +1,461 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v3.12.4
+// source: proto/prompb/remote.proto
+
+// Сообщения Prometheus remote_write 1.0, совместимые по номерам полей с prometheus/prompb.
+
+package prompb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type MetricMetadata_MetricType int32
+
+const (
+	MetricMetadata_UNKNOWN        MetricMetadata_MetricType = 0
+	MetricMetadata_COUNTER        MetricMetadata_MetricType = 1
+	MetricMetadata_GAUGE          MetricMetadata_MetricType = 2
+	MetricMetadata_HISTOGRAM      MetricMetadata_MetricType = 3
+	MetricMetadata_GAUGEHISTOGRAM MetricMetadata_MetricType = 4
+	MetricMetadata_SUMMARY        MetricMetadata_MetricType = 5
+	MetricMetadata_INFO           MetricMetadata_MetricType = 6
+	MetricMetadata_STATESET       MetricMetadata_MetricType = 7
+)
+
+// Enum value maps for MetricMetadata_MetricType.
+var (
+	MetricMetadata_MetricType_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "COUNTER",
+		2: "GAUGE",
+		3: "HISTOGRAM",
+		4: "GAUGEHISTOGRAM",
+		5: "SUMMARY",
+		6: "INFO",
+		7: "STATESET",
+	}
+	MetricMetadata_MetricType_value = map[string]int32{
+		"UNKNOWN":        0,
+		"COUNTER":        1,
+		"GAUGE":          2,
+		"HISTOGRAM":      3,
+		"GAUGEHISTOGRAM": 4,
+		"SUMMARY":        5,
+		"INFO":           6,
+		"STATESET":       7,
+	}
+)
+
+func (x MetricMetadata_MetricType) Enum() *MetricMetadata_MetricType {
+	p := new(MetricMetadata_MetricType)
+	*p = x
+	return p
+}
+
+func (x MetricMetadata_MetricType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MetricMetadata_MetricType) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_prompb_remote_proto_enumTypes[0].Descriptor()
+}
+
+func (MetricMetadata_MetricType) Type() protoreflect.EnumType {
+	return &file_proto_prompb_remote_proto_enumTypes[0]
+}
+
+func (x MetricMetadata_MetricType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MetricMetadata_MetricType.Descriptor instead.
+func (MetricMetadata_MetricType) EnumDescriptor() ([]byte, []int) {
+	return file_proto_prompb_remote_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type WriteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timeseries    []*TimeSeries          `protobuf:"bytes,1,rep,name=timeseries,proto3" json:"timeseries,omitempty"`
+	Metadata      []*MetricMetadata      `protobuf:"bytes,3,rep,name=metadata,proto3" json:"metadata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteRequest) Reset() {
+	*x = WriteRequest{}
+	mi := &file_proto_prompb_remote_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteRequest) ProtoMessage() {}
+
+func (x *WriteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_prompb_remote_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteRequest.ProtoReflect.Descriptor instead.
+func (*WriteRequest) Descriptor() ([]byte, []int) {
+	return file_proto_prompb_remote_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *WriteRequest) GetTimeseries() []*TimeSeries {
+	if x != nil {
+		return x.Timeseries
+	}
+	return nil
+}
+
+func (x *WriteRequest) GetMetadata() []*MetricMetadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type MetricMetadata struct {
+	state            protoimpl.MessageState    `protogen:"open.v1"`
+	Type             MetricMetadata_MetricType `protobuf:"varint,1,opt,name=type,proto3,enum=prometheus.MetricMetadata_MetricType" json:"type,omitempty"`
+	MetricFamilyName string                    `protobuf:"bytes,2,opt,name=metric_family_name,json=metricFamilyName,proto3" json:"metric_family_name,omitempty"` // имя метрики без суффиксов _bucket, _count и _sum
+	Help             string                    `protobuf:"bytes,4,opt,name=help,proto3" json:"help,omitempty"`
+	Unit             string                    `protobuf:"bytes,5,opt,name=unit,proto3" json:"unit,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *MetricMetadata) Reset() {
+	*x = MetricMetadata{}
+	mi := &file_proto_prompb_remote_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricMetadata) ProtoMessage() {}
+
+func (x *MetricMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_prompb_remote_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricMetadata.ProtoReflect.Descriptor instead.
+func (*MetricMetadata) Descriptor() ([]byte, []int) {
+	return file_proto_prompb_remote_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MetricMetadata) GetType() MetricMetadata_MetricType {
+	if x != nil {
+		return x.Type
+	}
+	return MetricMetadata_UNKNOWN
+}
+
+func (x *MetricMetadata) GetMetricFamilyName() string {
+	if x != nil {
+		return x.MetricFamilyName
+	}
+	return ""
+}
+
+func (x *MetricMetadata) GetHelp() string {
+	if x != nil {
+		return x.Help
+	}
+	return ""
+}
+
+func (x *MetricMetadata) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+type TimeSeries struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Labels        []*Label               `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"` // метка __name__ содержит имя метрики
+	Samples       []*Sample              `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TimeSeries) Reset() {
+	*x = TimeSeries{}
+	mi := &file_proto_prompb_remote_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TimeSeries) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimeSeries) ProtoMessage() {}
+
+func (x *TimeSeries) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_prompb_remote_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimeSeries.ProtoReflect.Descriptor instead.
+func (*TimeSeries) Descriptor() ([]byte, []int) {
+	return file_proto_prompb_remote_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TimeSeries) GetLabels() []*Label {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *TimeSeries) GetSamples() []*Sample {
+	if x != nil {
+		return x.Samples
+	}
+	return nil
+}
+
+type Label struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Label) Reset() {
+	*x = Label{}
+	mi := &file_proto_prompb_remote_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Label) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Label) ProtoMessage() {}
+
+func (x *Label) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_prompb_remote_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Label.ProtoReflect.Descriptor instead.
+func (*Label) Descriptor() ([]byte, []int) {
+	return file_proto_prompb_remote_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Label) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Label) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type Sample struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         float64                `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // миллисекунды от начала эпохи
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sample) Reset() {
+	*x = Sample{}
+	mi := &file_proto_prompb_remote_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sample) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sample) ProtoMessage() {}
+
+func (x *Sample) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_prompb_remote_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sample.ProtoReflect.Descriptor instead.
+func (*Sample) Descriptor() ([]byte, []int) {
+	return file_proto_prompb_remote_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Sample) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Sample) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+var File_proto_prompb_remote_proto protoreflect.FileDescriptor
+
+const file_proto_prompb_remote_proto_rawDesc = "" +
+	"\n" +
+	"\x19proto/prompb/remote.proto\x12\n" +
+	"prometheus\"\x84\x01\n" +
+	"\fWriteRequest\x126\n" +
+	"\n" +
+	"timeseries\x18\x01 \x03(\v2\x16.prometheus.TimeSeriesR\n" +
+	"timeseries\x126\n" +
+	"\bmetadata\x18\x03 \x03(\v2\x1a.prometheus.MetricMetadataR\bmetadataJ\x04\b\x02\x10\x03\"\x9c\x02\n" +
+	"\x0eMetricMetadata\x129\n" +
+	"\x04type\x18\x01 \x01(\x0e2%.prometheus.MetricMetadata.MetricTypeR\x04type\x12,\n" +
+	"\x12metric_family_name\x18\x02 \x01(\tR\x10metricFamilyName\x12\x12\n" +
+	"\x04help\x18\x04 \x01(\tR\x04help\x12\x12\n" +
+	"\x04unit\x18\x05 \x01(\tR\x04unit\"y\n" +
+	"\n" +
+	"MetricType\x12\v\n" +
+	"\aUNKNOWN\x10\x00\x12\v\n" +
+	"\aCOUNTER\x10\x01\x12\t\n" +
+	"\x05GAUGE\x10\x02\x12\r\n" +
+	"\tHISTOGRAM\x10\x03\x12\x12\n" +
+	"\x0eGAUGEHISTOGRAM\x10\x04\x12\v\n" +
+	"\aSUMMARY\x10\x05\x12\b\n" +
+	"\x04INFO\x10\x06\x12\f\n" +
+	"\bSTATESET\x10\a\"e\n" +
+	"\n" +
+	"TimeSeries\x12)\n" +
+	"\x06labels\x18\x01 \x03(\v2\x11.prometheus.LabelR\x06labels\x12,\n" +
+	"\asamples\x18\x02 \x03(\v2\x12.prometheus.SampleR\asamples\"1\n" +
+	"\x05Label\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"<\n" +
+	"\x06Sample\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\x01R\x05value\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestampB\x18Z\x16mtrcstore/proto/prompbb\x06proto3"
+
+var (
+	file_proto_prompb_remote_proto_rawDescOnce sync.Once
+	file_proto_prompb_remote_proto_rawDescData []byte
+)
+
+func file_proto_prompb_remote_proto_rawDescGZIP() []byte {
+	file_proto_prompb_remote_proto_rawDescOnce.Do(func() {
+		file_proto_prompb_remote_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_prompb_remote_proto_rawDesc), len(file_proto_prompb_remote_proto_rawDesc)))
+	})
+	return file_proto_prompb_remote_proto_rawDescData
+}
+
+var file_proto_prompb_remote_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_prompb_remote_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proto_prompb_remote_proto_goTypes = []any{
+	(MetricMetadata_MetricType)(0), // 0: prometheus.MetricMetadata.MetricType
+	(*WriteRequest)(nil),           // 1: prometheus.WriteRequest
+	(*MetricMetadata)(nil),         // 2: prometheus.MetricMetadata
+	(*TimeSeries)(nil),             // 3: prometheus.TimeSeries
+	(*Label)(nil),                  // 4: prometheus.Label
+	(*Sample)(nil),                 // 5: prometheus.Sample
+}
+var file_proto_prompb_remote_proto_depIdxs = []int32{
+	3, // 0: prometheus.WriteRequest.timeseries:type_name -> prometheus.TimeSeries
+	2, // 1: prometheus.WriteRequest.metadata:type_name -> prometheus.MetricMetadata
+	0, // 2: prometheus.MetricMetadata.type:type_name -> prometheus.MetricMetadata.MetricType
+	4, // 3: prometheus.TimeSeries.labels:type_name -> prometheus.Label
+	5, // 4: prometheus.TimeSeries.samples:type_name -> prometheus.Sample
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_proto_prompb_remote_proto_init() }
+func file_proto_prompb_remote_proto_init() {
+	if File_proto_prompb_remote_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_prompb_remote_proto_rawDesc), len(file_proto_prompb_remote_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_prompb_remote_proto_goTypes,
+		DependencyIndexes: file_proto_prompb_remote_proto_depIdxs,
+		EnumInfos:         file_proto_prompb_remote_proto_enumTypes,
+		MessageInfos:      file_proto_prompb_remote_proto_msgTypes,
+	}.Build()
+	File_proto_prompb_remote_proto = out.File
+	file_proto_prompb_remote_proto_goTypes = nil
+	file_proto_prompb_remote_proto_depIdxs = nil
+}
@@ -92,6 +92,7 @@ func (x *Metric) GetType() string {
 type UpdateMetricRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=Metrics,proto3" json:"Metrics,omitempty"`
+	Partial       bool                   `protobuf:"varint,2,opt,name=Partial,proto3" json:"Partial,omitempty"` // сохранить корректные метрики и вернуть статус каждой
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -133,16 +134,92 @@ func (x *UpdateMetricRequest) GetMetrics() []*Metric {
 	return nil
 }
 
+func (x *UpdateMetricRequest) GetPartial() bool {
+	if x != nil {
+		return x.Partial
+	}
+	return false
+}
+
+type MetricResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ID            string                 `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`              // идентификатор метрики
+	Type          string                 `protobuf:"bytes,2,opt,name=Type,proto3" json:"Type,omitempty"`          // тип метрики
+	Accepted      bool                   `protobuf:"varint,3,opt,name=Accepted,proto3" json:"Accepted,omitempty"` // метрика сохранена
+	Reason        string                 `protobuf:"bytes,4,opt,name=Reason,proto3" json:"Reason,omitempty"`      // причина отказа
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricResult) Reset() {
+	*x = MetricResult{}
+	mi := &file_proto_server_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricResult) ProtoMessage() {}
+
+func (x *MetricResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_server_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricResult.ProtoReflect.Descriptor instead.
+func (*MetricResult) Descriptor() ([]byte, []int) {
+	return file_proto_server_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MetricResult) GetID() string {
+	if x != nil {
+		return x.ID
+	}
+	return ""
+}
+
+func (x *MetricResult) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *MetricResult) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+func (x *MetricResult) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
 type UpdateMetricResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"` // ошибка
+	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`     // ошибка
+	Results       []*MetricResult        `protobuf:"bytes,2,rep,name=Results,proto3" json:"Results,omitempty"` // статус каждой метрики в режиме Partial
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *UpdateMetricResponse) Reset() {
 	*x = UpdateMetricResponse{}
-	mi := &file_proto_server_proto_msgTypes[2]
+	mi := &file_proto_server_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -154,7 +231,7 @@ func (x *UpdateMetricResponse) String() string {
 func (*UpdateMetricResponse) ProtoMessage() {}
 
 func (x *UpdateMetricResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_server_proto_msgTypes[2]
+	mi := &file_proto_server_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -167,7 +244,7 @@ func (x *UpdateMetricResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateMetricResponse.ProtoReflect.Descriptor instead.
 func (*UpdateMetricResponse) Descriptor() ([]byte, []int) {
-	return file_proto_server_proto_rawDescGZIP(), []int{2}
+	return file_proto_server_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *UpdateMetricResponse) GetError() string {
@@ -177,6 +254,141 @@ func (x *UpdateMetricResponse) GetError() string {
 	return ""
 }
 
+func (x *UpdateMetricResponse) GetResults() []*MetricResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type MetricBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=Seq,proto3" json:"Seq,omitempty"` // номер пакета в потоке, возвращается в подтверждении
+	Metrics       []*Metric              `protobuf:"bytes,2,rep,name=Metrics,proto3" json:"Metrics,omitempty"`
+	Trace         map[string]string      `protobuf:"bytes,3,rep,name=Trace,proto3" json:"Trace,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // контекст трассировки пакета, метаданные потока общие для всех пакетов
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricBatch) Reset() {
+	*x = MetricBatch{}
+	mi := &file_proto_server_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricBatch) ProtoMessage() {}
+
+func (x *MetricBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_server_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricBatch.ProtoReflect.Descriptor instead.
+func (*MetricBatch) Descriptor() ([]byte, []int) {
+	return file_proto_server_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MetricBatch) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *MetricBatch) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *MetricBatch) GetTrace() map[string]string {
+	if x != nil {
+		return x.Trace
+	}
+	return nil
+}
+
+type BatchAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=Seq,proto3" json:"Seq,omitempty"`        // номер подтверждаемого пакета
+	Code          uint32                 `protobuf:"varint,2,opt,name=Code,proto3" json:"Code,omitempty"`      // код gRPC статуса, если пакет не обработан целиком
+	Error         string                 `protobuf:"bytes,3,opt,name=Error,proto3" json:"Error,omitempty"`     // ошибка
+	Results       []*MetricResult        `protobuf:"bytes,4,rep,name=Results,proto3" json:"Results,omitempty"` // статус каждой метрики пакета
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchAck) Reset() {
+	*x = BatchAck{}
+	mi := &file_proto_server_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchAck) ProtoMessage() {}
+
+func (x *BatchAck) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_server_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchAck.ProtoReflect.Descriptor instead.
+func (*BatchAck) Descriptor() ([]byte, []int) {
+	return file_proto_server_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchAck) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *BatchAck) GetCode() uint32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *BatchAck) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *BatchAck) GetResults() []*MetricResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
 var File_proto_server_proto protoreflect.FileDescriptor
 
 const file_proto_server_proto_rawDesc = "" +
@@ -186,13 +398,34 @@ const file_proto_server_proto_rawDesc = "" +
 	"\x05Delta\x18\x01 \x01(\x03R\x05Delta\x12\x14\n" +
 	"\x05Value\x18\x02 \x01(\x01R\x05Value\x12\x0e\n" +
 	"\x02ID\x18\x03 \x01(\tR\x02ID\x12\x12\n" +
-	"\x04Type\x18\x04 \x01(\tR\x04Type\"B\n" +
+	"\x04Type\x18\x04 \x01(\tR\x04Type\"\\\n" +
 	"\x13UpdateMetricRequest\x12+\n" +
-	"\aMetrics\x18\x01 \x03(\v2\x11.mtrcstore.MetricR\aMetrics\",\n" +
+	"\aMetrics\x18\x01 \x03(\v2\x11.mtrcstore.MetricR\aMetrics\x12\x18\n" +
+	"\aPartial\x18\x02 \x01(\bR\aPartial\"f\n" +
+	"\fMetricResult\x12\x0e\n" +
+	"\x02ID\x18\x01 \x01(\tR\x02ID\x12\x12\n" +
+	"\x04Type\x18\x02 \x01(\tR\x04Type\x12\x1a\n" +
+	"\bAccepted\x18\x03 \x01(\bR\bAccepted\x12\x16\n" +
+	"\x06Reason\x18\x04 \x01(\tR\x06Reason\"_\n" +
 	"\x14UpdateMetricResponse\x12\x14\n" +
-	"\x05error\x18\x01 \x01(\tR\x05error2Z\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\x121\n" +
+	"\aResults\x18\x02 \x03(\v2\x17.mtrcstore.MetricResultR\aResults\"\xbf\x01\n" +
+	"\vMetricBatch\x12\x10\n" +
+	"\x03Seq\x18\x01 \x01(\x04R\x03Seq\x12+\n" +
+	"\aMetrics\x18\x02 \x03(\v2\x11.mtrcstore.MetricR\aMetrics\x127\n" +
+	"\x05Trace\x18\x03 \x03(\v2!.mtrcstore.MetricBatch.TraceEntryR\x05Trace\x1a8\n" +
+	"\n" +
+	"TraceEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"y\n" +
+	"\bBatchAck\x12\x10\n" +
+	"\x03Seq\x18\x01 \x01(\x04R\x03Seq\x12\x12\n" +
+	"\x04Code\x18\x02 \x01(\rR\x04Code\x12\x14\n" +
+	"\x05Error\x18\x03 \x01(\tR\x05Error\x121\n" +
+	"\aResults\x18\x04 \x03(\v2\x17.mtrcstore.MetricResultR\aResults2\x9c\x01\n" +
 	"\aMetrics\x12O\n" +
-	"\fUpdateMetric\x12\x1e.mtrcstore.UpdateMetricRequest\x1a\x1f.mtrcstore.UpdateMetricResponseB\x11Z\x0fmtrcstore/protob\x06proto3"
+	"\fUpdateMetric\x12\x1e.mtrcstore.UpdateMetricRequest\x1a\x1f.mtrcstore.UpdateMetricResponse\x12@\n" +
+	"\rStreamMetrics\x12\x16.mtrcstore.MetricBatch\x1a\x13.mtrcstore.BatchAck(\x010\x01B\x11Z\x0fmtrcstore/protob\x06proto3"
 
 var (
 	file_proto_server_proto_rawDescOnce sync.Once
@@ -206,21 +439,31 @@ func file_proto_server_proto_rawDescGZIP() []byte {
 	return file_proto_server_proto_rawDescData
 }
 
-var file_proto_server_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_server_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_proto_server_proto_goTypes = []any{
 	(*Metric)(nil),               // 0: mtrcstore.Metric
 	(*UpdateMetricRequest)(nil),  // 1: mtrcstore.UpdateMetricRequest
-	(*UpdateMetricResponse)(nil), // 2: mtrcstore.UpdateMetricResponse
+	(*MetricResult)(nil),         // 2: mtrcstore.MetricResult
+	(*UpdateMetricResponse)(nil), // 3: mtrcstore.UpdateMetricResponse
+	(*MetricBatch)(nil),          // 4: mtrcstore.MetricBatch
+	(*BatchAck)(nil),             // 5: mtrcstore.BatchAck
+	nil,                          // 6: mtrcstore.MetricBatch.TraceEntry
 }
 var file_proto_server_proto_depIdxs = []int32{
 	0, // 0: mtrcstore.UpdateMetricRequest.Metrics:type_name -> mtrcstore.Metric
-	1, // 1: mtrcstore.Metrics.UpdateMetric:input_type -> mtrcstore.UpdateMetricRequest
-	2, // 2: mtrcstore.Metrics.UpdateMetric:output_type -> mtrcstore.UpdateMetricResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	2, // 1: mtrcstore.UpdateMetricResponse.Results:type_name -> mtrcstore.MetricResult
+	0, // 2: mtrcstore.MetricBatch.Metrics:type_name -> mtrcstore.Metric
+	6, // 3: mtrcstore.MetricBatch.Trace:type_name -> mtrcstore.MetricBatch.TraceEntry
+	2, // 4: mtrcstore.BatchAck.Results:type_name -> mtrcstore.MetricResult
+	1, // 5: mtrcstore.Metrics.UpdateMetric:input_type -> mtrcstore.UpdateMetricRequest
+	4, // 6: mtrcstore.Metrics.StreamMetrics:input_type -> mtrcstore.MetricBatch
+	3, // 7: mtrcstore.Metrics.UpdateMetric:output_type -> mtrcstore.UpdateMetricResponse
+	5, // 8: mtrcstore.Metrics.StreamMetrics:output_type -> mtrcstore.BatchAck
+	7, // [7:9] is the sub-list for method output_type
+	5, // [5:7] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_proto_server_proto_init() }
@@ -234,7 +477,7 @@ func file_proto_server_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_server_proto_rawDesc), len(file_proto_server_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,7 +19,8 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Metrics_UpdateMetric_FullMethodName = "/mtrcstore.Metrics/UpdateMetric"
+	Metrics_UpdateMetric_FullMethodName  = "/mtrcstore.Metrics/UpdateMetric"
+	Metrics_StreamMetrics_FullMethodName = "/mtrcstore.Metrics/StreamMetrics"
 )
 
 // MetricsClient is the client API for Metrics service.
@@ -27,6 +28,9 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type MetricsClient interface {
 	UpdateMetric(ctx context.Context, in *UpdateMetricRequest, opts ...grpc.CallOption) (*UpdateMetricResponse, error)
+	// StreamMetrics принимает пакеты метрик по одному долгоживущему соединению
+	// и подтверждает каждый пакет в порядке получения
+	StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[MetricBatch, BatchAck], error)
 }
 
 type metricsClient struct {
@@ -47,11 +51,27 @@ func (c *metricsClient) UpdateMetric(ctx context.Context, in *UpdateMetricReques
 	return out, nil
 }
 
+func (c *metricsClient) StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[MetricBatch, BatchAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[0], Metrics_StreamMetrics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[MetricBatch, BatchAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Metrics_StreamMetricsClient = grpc.BidiStreamingClient[MetricBatch, BatchAck]
+
 // MetricsServer is the server API for Metrics service.
 // All implementations must embed UnimplementedMetricsServer
 // for forward compatibility.
 type MetricsServer interface {
 	UpdateMetric(context.Context, *UpdateMetricRequest) (*UpdateMetricResponse, error)
+	// StreamMetrics принимает пакеты метрик по одному долгоживущему соединению
+	// и подтверждает каждый пакет в порядке получения
+	StreamMetrics(grpc.BidiStreamingServer[MetricBatch, BatchAck]) error
 	mustEmbedUnimplementedMetricsServer()
 }
 
@@ -65,6 +85,9 @@ type UnimplementedMetricsServer struct{}
 func (UnimplementedMetricsServer) UpdateMetric(context.Context, *UpdateMetricRequest) (*UpdateMetricResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateMetric not implemented")
 }
+func (UnimplementedMetricsServer) StreamMetrics(grpc.BidiStreamingServer[MetricBatch, BatchAck]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMetrics not implemented")
+}
 func (UnimplementedMetricsServer) mustEmbedUnimplementedMetricsServer() {}
 func (UnimplementedMetricsServer) testEmbeddedByValue()                 {}
 
@@ -104,6 +127,13 @@ func _Metrics_UpdateMetric_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_StreamMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServer).StreamMetrics(&grpc.GenericServerStream[MetricBatch, BatchAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Metrics_StreamMetricsServer = grpc.BidiStreamingServer[MetricBatch, BatchAck]
+
 // Metrics_ServiceDesc is the grpc.ServiceDesc for Metrics service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -116,6 +146,13 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _Metrics_UpdateMetric_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMetrics",
+			Handler:       _Metrics_StreamMetrics_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "proto/server.proto",
 }
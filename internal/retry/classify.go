@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusError is the error of a request answered with an unsuccessful HTTP status.
+type StatusError struct {
+	Code  int
+	After time.Duration // value of the Retry-After header
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.Code, http.StatusText(e.Code))
+}
+
+func (e *StatusError) RetryAfter() time.Duration {
+	return e.After
+}
+
+// ParseRetryAfter reads the Retry-After header given either in seconds or as an HTTP date.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+
+	return 0
+}
+
+// Any reports whether one of the checks allows to retry the error.
+func Any(checks ...CheckErr) CheckErr {
+	return func(err error) bool {
+		for _, check := range checks {
+			if check(err) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// IsConnRefused reports whether the server refused the connection.
+func IsConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// IsTimeout reports whether the attempt ran out of time.
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// IsHTTPRetryable reports whether the server answered with a status worth another attempt: 429 or 5xx.
+func IsHTTPRetryable(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= http.StatusInternalServerError
+}
+
+// IsGRPCUnavailable reports whether the gRPC server is unavailable.
+func IsGRPCUnavailable(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.Unavailable
+}
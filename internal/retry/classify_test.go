@@ -0,0 +1,64 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassify(t *testing.T) {
+	_, dialErr := net.Dial("tcp", "127.0.0.1:1")
+
+	tests := []struct {
+		err   error
+		check CheckErr
+		name  string
+		want  bool
+	}{
+		{name: "connection refused", err: dialErr, check: IsConnRefused, want: true},
+		{name: "other error is not connection refused", err: errors.New("test"), check: IsConnRefused},
+		{name: "deadline exceeded", err: fmt.Errorf("test: %w", context.DeadlineExceeded), check: IsTimeout, want: true},
+		{name: "canceled is not a timeout", err: context.Canceled, check: IsTimeout},
+		{name: "too many requests", err: &StatusError{Code: http.StatusTooManyRequests}, check: IsHTTPRetryable, want: true},
+		{name: "bad gateway", err: fmt.Errorf("test: %w", &StatusError{Code: http.StatusBadGateway}), check: IsHTTPRetryable, want: true},
+		{name: "bad request", err: &StatusError{Code: http.StatusBadRequest}, check: IsHTTPRetryable},
+		{name: "grpc unavailable", err: fmt.Errorf("test: %w", status.Error(codes.Unavailable, "test")), check: IsGRPCUnavailable, want: true},
+		{name: "grpc invalid argument", err: status.Error(codes.InvalidArgument, "test"), check: IsGRPCUnavailable},
+		{name: "any of the checks", err: context.DeadlineExceeded, check: Any(IsConnRefused, IsTimeout), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.check(tt.err))
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "empty", value: "", want: 0},
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "http date", value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute},
+		{name: "date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "invalid", value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, ParseRetryAfter(tt.value, now))
+		})
+	}
+}
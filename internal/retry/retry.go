@@ -1,8 +1,12 @@
 // The retry package repeats the operation until it reaches the number of attempts specified in count.
+// The waits between the attempts grow exponentially with full jitter and are interrupted by the context.
 package retry
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"time"
 )
 
@@ -12,9 +16,31 @@ type Action func() error
 // CheckErr function checks for an error.
 type CheckErr func(err error) bool
 
+// Policy configures the waits between the attempts.
+type Policy struct {
+	Initial    time.Duration // upper bound of the first wait
+	Max        time.Duration // upper bound of any wait
+	MaxElapsed time.Duration // no attempt is started after this time since the first one, zero disables the limit
+	Multiplier float64       // growth of the upper bound after every attempt
+}
+
+// DefaultPolicy waits up to 1s, 2s, 4s... but never more than 5s at once.
+var DefaultPolicy = Policy{
+	Initial:    time.Second,
+	Max:        5 * time.Second,
+	MaxElapsed: 30 * time.Second,
+	Multiplier: 2,
+}
+
+// RetryAfter is implemented by errors that carry the server's hint of when to try again.
+type RetryAfter interface {
+	RetryAfter() time.Duration
+}
+
 type retry struct {
 	action   Action   // The action function that retry calls.
 	checkErr CheckErr // A function that checks for an error.
+	policy   Policy   // Waits between the attempts.
 	attempt  uint     // Number of attempts made
 	max      uint     // Number of maximum attempts
 }
@@ -26,11 +52,25 @@ func New(action Action, checkErr CheckErr, count uint) *retry {
 		checkErr: checkErr,
 		max:      count,
 		action:   action,
+		policy:   DefaultPolicy,
 	}
 }
 
+// WithPolicy replaces the default policy.
+func (r *retry) WithPolicy(p Policy) *retry {
+	r.policy = p
+	return r
+}
+
 // Run calls Action as long as CheckErr == true and the number of attempts is less than the maximum set.
 func (r *retry) Run() error {
+	return r.RunContext(context.Background())
+}
+
+// RunContext is Run that stops waiting as soon as ctx is done.
+func (r *retry) RunContext(ctx context.Context) error {
+	start := time.Now()
+
 	var err error
 	for {
 		err = r.action()
@@ -38,7 +78,15 @@ func (r *retry) Run() error {
 			break
 		}
 
-		r.wait()
+		d := r.getDuration(err)
+		if r.policy.MaxElapsed > 0 && time.Since(start)+d > r.policy.MaxElapsed {
+			break
+		}
+
+		if wErr := r.wait(ctx, d); wErr != nil {
+			err = errors.Join(err, wErr)
+			break
+		}
 		r.attempt++
 	}
 
@@ -49,12 +97,42 @@ func (r *retry) Run() error {
 	return nil
 }
 
-// wait stop program execution for the period specified in getDuration.
-func (r *retry) wait() {
-	time.Sleep(r.getDuration())
+// wait stops for the duration or until ctx is done.
+func (r *retry) wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("retry wait canceled: %w", ctx.Err())
+	case <-t.C:
+		return nil
+	}
 }
 
-// getDuration specifies the period for which the program execution will stop.
-func (r *retry) getDuration() time.Duration {
-	return (1 + 2*time.Duration(r.attempt-1)) * time.Second
+// getDuration picks a random wait up to the exponentially growing bound (full jitter),
+// the Retry-After hint of the error is used as is.
+func (r *retry) getDuration(err error) time.Duration {
+	var ra RetryAfter
+	if errors.As(err, &ra) && ra.RetryAfter() > 0 {
+		return ra.RetryAfter()
+	}
+
+	bound := float64(r.policy.Initial)
+	for range r.attempt - 1 {
+		bound *= r.policy.Multiplier
+		if r.policy.Max > 0 && bound >= float64(r.policy.Max) {
+			break
+		}
+	}
+
+	if r.policy.Max > 0 {
+		bound = min(bound, float64(r.policy.Max))
+	}
+
+	if bound < 1 {
+		return 0
+	}
+
+	return time.Duration(rand.Int64N(int64(bound) + 1))
 }
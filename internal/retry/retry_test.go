@@ -1,15 +1,107 @@
 package retry
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
+var testPolicy = Policy{
+	Initial:    time.Millisecond,
+	Max:        4 * time.Millisecond,
+	Multiplier: 2,
+}
+
 func TestConfigSuccess(t *testing.T) {
 	t.Run("retry success with error", func(t *testing.T) {
 		r := New(func() error { return errors.New("test") }, func(err error) bool { return true }, 2)
-		require.Error(t, r.Run())
+		require.Error(t, r.WithPolicy(testPolicy).Run())
+	})
+}
+
+func TestRunAttempts(t *testing.T) {
+	tests := []struct {
+		checkErr CheckErr
+		name     string
+		attempts int
+	}{
+		{name: "retryable error is repeated", checkErr: func(error) bool { return true }, attempts: 3},
+		{name: "permanent error is not repeated", checkErr: func(error) bool { return false }, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := New(func() error {
+				attempts++
+				return errors.New("test")
+			}, tt.checkErr, 3).WithPolicy(testPolicy).Run()
+
+			require.Error(t, err)
+			require.Equal(t, tt.attempts, attempts)
+		})
+	}
+
+	t.Run("success stops the retries", func(t *testing.T) {
+		attempts := 0
+		err := New(func() error {
+			attempts++
+			if attempts < 2 {
+				return errors.New("test")
+			}
+			return nil
+		}, func(error) bool { return true }, 5).WithPolicy(testPolicy).Run()
+
+		require.NoError(t, err)
+		require.Equal(t, 2, attempts)
+	})
+}
+
+func TestRunContext(t *testing.T) {
+	t.Run("wait is interrupted by the context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := New(func() error { return errors.New("test") }, func(error) bool { return true }, 5).
+			WithPolicy(Policy{Initial: time.Hour, Multiplier: 2}).
+			RunContext(ctx)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("no attempt is made after max elapsed", func(t *testing.T) {
+		attempts := 0
+		err := New(func() error {
+			attempts++
+			return &StatusError{Code: 503, After: time.Hour}
+		}, IsHTTPRetryable, 5).WithPolicy(Policy{MaxElapsed: time.Second}).Run()
+
+		require.Error(t, err)
+		require.Equal(t, 1, attempts)
+	})
+}
+
+func TestGetDuration(t *testing.T) {
+	t.Run("duration is bounded by the exponential policy", func(t *testing.T) {
+		r := New(nil, nil, 10).WithPolicy(Policy{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2})
+		bounds := []time.Duration{10, 20, 40, 50, 50}
+		for i, bound := range bounds {
+			r.attempt = uint(i + 1)
+			for range 100 {
+				d := r.getDuration(errors.New("test"))
+				require.GreaterOrEqual(t, d, time.Duration(0))
+				require.LessOrEqual(t, d, bound*time.Millisecond)
+			}
+		}
+	})
+
+	t.Run("retry after hint is used", func(t *testing.T) {
+		r := New(nil, nil, 3)
+		require.Equal(t, 7*time.Second, r.getDuration(&StatusError{Code: 429, After: 7 * time.Second}))
 	})
 }
@@ -0,0 +1,267 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/retry"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	webhookTimeout  = 5 * time.Second
+	webhookAttempts = 3
+	maxQueued       = 1000 // the oldest undelivered alerts are dropped above it
+)
+
+// webhookPolicy keeps the retries of a round short, the undelivered alerts are sent again in the next round.
+var webhookPolicy = retry.Policy{
+	Initial:    500 * time.Millisecond,
+	Max:        2 * time.Second,
+	MaxElapsed: 5 * time.Second,
+	Multiplier: 2,
+}
+
+// states of an alert.
+const (
+	StateInactive = "inactive"
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Alert is the state of a rule.
+type Alert struct {
+	ActiveAt   *time.Time `json:"active_at,omitempty"`   // the condition holds since
+	FiredAt    *time.Time `json:"fired_at,omitempty"`    // the condition held for the For duration
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"` // the firing alert stopped holding
+	Value      *float64   `json:"value,omitempty"`       // the last computed value of the expression
+	State      string     `json:"state"`
+	Rule       Rule       `json:"rule"`
+}
+
+// Notification is the body of the webhook request, it carries the alerts that fired or resolved.
+type Notification struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+type ruleState struct {
+	samples []sample
+	alert   Alert
+}
+
+// Engine samples the metrics of the rules every interval and moves the alerts between the states:
+// inactive or resolved to pending when the condition holds, pending to firing after the For duration,
+// firing to resolved when it stops holding. A missing metric leaves the alert as it is,
+// so the storage must not hide the stale metrics: their last values are evaluated.
+// The alerts the webhook did not receive are queued and sent again with the next round.
+type Engine struct {
+	storage repository.Storage
+	client  *http.Client
+	log     *zap.Logger
+	now     func() time.Time
+	webhook string
+	rules   []*ruleState
+	queued  []Alert
+	policy  retry.Policy
+	mutex   sync.RWMutex
+}
+
+// NewEngine creates the engine, an empty webhook disables the notifications.
+func NewEngine(s repository.Storage, rules []Rule, webhook string, log *zap.Logger) *Engine {
+	states := make([]*ruleState, 0, len(rules))
+	for _, r := range rules {
+		states = append(states, &ruleState{alert: Alert{Rule: r, State: StateInactive}})
+	}
+
+	return &Engine{
+		storage: s,
+		client:  &http.Client{Timeout: webhookTimeout},
+		log:     log,
+		now:     time.Now,
+		webhook: webhook,
+		rules:   states,
+		policy:  webhookPolicy,
+	}
+}
+
+// Run evaluates the rules every interval until the context is done.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Evaluate(ctx)
+		}
+	}
+}
+
+// Evaluate runs a single round and sends the alerts that fired or resolved in it.
+func (e *Engine) Evaluate(ctx context.Context) {
+	changed := make([]Alert, 0)
+	for _, rs := range e.rules {
+		r := rs.alert.Rule
+		m, err := e.storage.Find(ctx, r.Metric, r.Type)
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				e.log.Error("alert metric read failed", zap.String("rule", r.Name), zap.Error(err))
+			}
+			continue
+		}
+
+		value := 0.0
+		switch {
+		case m.Delta != nil:
+			value = float64(*m.Delta)
+		case m.Value != nil:
+			value = *m.Value
+		}
+
+		if a, ok := e.step(rs, value); ok {
+			changed = append(changed, a)
+		}
+	}
+
+	if len(changed) > 0 || len(e.queued) > 0 {
+		e.notify(ctx, changed)
+	}
+}
+
+// step adds the sample and moves the alert, it returns the alert when it fired or resolved.
+func (e *Engine) step(rs *ruleState, value float64) (Alert, bool) {
+	now := e.now()
+	c := rs.alert.Rule.cond
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	rs.samples = append(rs.samples, sample{time: now, value: value})
+	// the last sample before the window stays as the base of the increase
+	start := now.Add(-c.window)
+	for len(rs.samples) > 1 && !rs.samples[1].time.After(start) {
+		rs.samples = rs.samples[1:]
+	}
+
+	computed, ok := c.compute(rs.samples, now)
+	if !ok {
+		return Alert{}, false
+	}
+
+	a := &rs.alert
+	a.Value = &computed
+
+	if !c.holds(computed) {
+		a.ActiveAt = nil
+		switch a.State {
+		case StateFiring:
+			a.State = StateResolved
+			a.ResolvedAt = &now
+			return *a, true
+		case StatePending:
+			a.State = StateInactive
+		}
+		return Alert{}, false
+	}
+
+	switch a.State {
+	case StateInactive, StateResolved:
+		a.State = StatePending
+		a.ActiveAt = &now
+		a.FiredAt = nil
+		a.ResolvedAt = nil
+	}
+
+	if a.State == StatePending && now.Sub(*a.ActiveAt) >= a.Rule.For {
+		a.State = StateFiring
+		a.FiredAt = &now
+		return *a, true
+	}
+
+	return Alert{}, false
+}
+
+// Alerts returns the state of every rule in the order of the rules file.
+func (e *Engine) Alerts() []Alert {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	alerts := make([]Alert, 0, len(e.rules))
+	for _, rs := range e.rules {
+		alerts = append(alerts, rs.alert)
+	}
+
+	return alerts
+}
+
+// notify sends the changed alerts after the queued ones, so the webhook gets them in order.
+// The alerts stay queued while the webhook is unavailable, a rejected request is dropped.
+func (e *Engine) notify(ctx context.Context, alerts []Alert) {
+	for _, a := range alerts {
+		e.log.Info("alert "+a.State, zap.String("rule", a.Rule.Name), zap.Float64p("value", a.Value))
+	}
+
+	if e.webhook == "" {
+		return
+	}
+
+	e.queued = append(e.queued, alerts...)
+	if over := len(e.queued) - maxQueued; over > 0 {
+		e.log.Warn("alert notifications dropped", zap.Int("count", over))
+		e.queued = e.queued[over:]
+	}
+
+	n := Notification{Alerts: e.queued}
+	canRetry := retry.Any(retry.IsConnRefused, retry.IsTimeout, retry.IsHTTPRetryable)
+	err := retry.New(func() error { return e.send(ctx, n) }, canRetry, webhookAttempts).WithPolicy(e.policy).RunContext(ctx)
+	if err != nil && canRetry(err) {
+		e.log.Error("alert webhook failed, notifications queued", zap.Error(err), zap.Int("queued", len(e.queued)))
+		return
+	}
+
+	if err != nil {
+		e.log.Error("alert webhook failed", zap.Error(err))
+	}
+	e.queued = nil
+}
+
+func (e *Engine) send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("alert notification marshal failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("alert notification request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("alert notification send failed: %w", err)
+	}
+
+	if err := resp.Body.Close(); err != nil {
+		return fmt.Errorf("alert notification send failed: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("alert notification send failed: %w", &retry.StatusError{
+			Code:  resp.StatusCode,
+			After: retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		})
+	}
+
+	return nil
+}
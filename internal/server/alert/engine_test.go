@@ -0,0 +1,149 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/retry"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEngine(t *testing.T) {
+	var mutex sync.Mutex
+	received := make([]Alert, 0)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, n.Alerts...)
+	}))
+	defer hook.Close()
+
+	rule := Rule{Name: "HeapAllocHigh", Metric: "HeapAlloc", Type: "gauge", Expr: "value > 100", For: time.Minute}
+	require.NoError(t, rule.compile())
+
+	ctx := context.Background()
+	storage := repository.NewMemory()
+	e := NewEngine(storage, []Rule{rule}, hook.URL, zap.NewNop())
+
+	now := time.Unix(0, 0)
+	e.now = func() time.Time { return now }
+
+	set := func(v float64) {
+		require.NoError(t, storage.Save(ctx, model.Metric{ID: "HeapAlloc", MType: "gauge", Value: &v}))
+	}
+
+	steps := []struct {
+		value float64
+		after time.Duration
+		state string
+	}{
+		{value: 50, state: StateInactive},
+		{value: 150, after: 10 * time.Second, state: StatePending},
+		{value: 150, after: 30 * time.Second, state: StatePending},
+		{value: 150, after: 30 * time.Second, state: StateFiring},
+		{value: 150, after: 10 * time.Second, state: StateFiring},
+		{value: 50, after: 10 * time.Second, state: StateResolved},
+		{value: 150, after: 10 * time.Second, state: StatePending},
+		{value: 50, after: 10 * time.Second, state: StateInactive},
+	}
+
+	for _, s := range steps {
+		now = now.Add(s.after)
+		set(s.value)
+		e.Evaluate(ctx)
+		require.Equal(t, s.state, e.Alerts()[0].State)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, received, 2)
+	require.Equal(t, StateFiring, received[0].State)
+	require.Equal(t, StateResolved, received[1].State)
+	require.InDelta(t, 50, *received[1].Value, 1e-9)
+
+	t.Run("missing metric keeps the state", func(t *testing.T) {
+		missing := Rule{Name: "Other", Metric: "Other", Type: "gauge", Expr: "value > 1"}
+		require.NoError(t, missing.compile())
+
+		e := NewEngine(storage, []Rule{missing}, "", zap.NewNop())
+		e.Evaluate(ctx)
+		require.Equal(t, StateInactive, e.Alerts()[0].State)
+	})
+}
+
+func TestEngineNotifyRetry(t *testing.T) {
+	var mutex sync.Mutex
+	failures := 0
+	received := make([]Alert, 0)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var n Notification
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+		received = append(received, n.Alerts...)
+	}))
+	defer hook.Close()
+
+	rule := Rule{Name: "HeapAllocHigh", Metric: "HeapAlloc", Type: "gauge", Expr: "value > 100"}
+	require.NoError(t, rule.compile())
+
+	ctx := context.Background()
+	storage := repository.NewMemory()
+	e := NewEngine(storage, []Rule{rule}, hook.URL, zap.NewNop())
+	e.policy = retry.Policy{}
+
+	set := func(v float64) {
+		require.NoError(t, storage.Save(ctx, model.Metric{ID: "HeapAlloc", MType: "gauge", Value: &v}))
+	}
+	failed := func(n int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failures = n
+	}
+	states := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		out := make([]string, 0, len(received))
+		for _, a := range received {
+			out = append(out, a.State)
+		}
+		return out
+	}
+
+	t.Run("failed send is retried", func(t *testing.T) {
+		failed(webhookAttempts - 1)
+		set(150)
+		e.Evaluate(ctx)
+		require.Equal(t, []string{StateFiring}, states())
+	})
+
+	t.Run("undelivered alerts are sent with the next round", func(t *testing.T) {
+		failed(webhookAttempts)
+		set(50)
+		e.Evaluate(ctx)
+		require.Equal(t, []string{StateFiring}, states())
+
+		e.Evaluate(ctx)
+		require.Equal(t, []string{StateFiring, StateResolved}, states())
+
+		e.Evaluate(ctx)
+		require.Equal(t, []string{StateFiring, StateResolved}, states())
+	})
+}
@@ -0,0 +1,242 @@
+// Package alert evaluates the threshold rules against the storage and notifies about the firing ones.
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrBadRule = errors.New("alert rule is invalid")
+
+// functions of the expressions, all but value take a window.
+const (
+	funcValue    = "value"
+	funcIncrease = "increase"
+	funcRate     = "rate"
+	funcAvg      = "avg"
+	funcMin      = "min"
+	funcMax      = "max"
+)
+
+var exprPattern = regexp.MustCompile(`^\s*(\w+)\s*(?:\(\s*(\w+)\s*\))?\s*(>=|<=|==|!=|>|<)\s*(\S+)\s*$`)
+
+// Rule fires when the expression over the metric holds for the For duration. The expression is
+// "<function> <operator> <threshold>": value is the current value, increase(window), rate(window),
+// avg(window), min(window) and max(window) are taken over the values sampled during the window,
+// e.g. "value > 1e9" or "increase(5m) <= 0".
+type Rule struct {
+	Name        string `yaml:"name" json:"name"`
+	Metric      string `yaml:"metric" json:"metric"`
+	Type        string `yaml:"type" json:"type"`
+	Expr        string `yaml:"expr" json:"expr"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	cond        condition
+	For         time.Duration `yaml:"for" json:"for" swaggertype:"string" example:"5m0s"`
+}
+
+type condition struct {
+	function  string
+	operator  string
+	window    time.Duration
+	threshold float64
+}
+
+// MarshalJSON writes the For duration as a string, like it is given in the rules file.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type plain Rule
+	data, err := json.Marshal(struct {
+		For string `json:"for"`
+		plain
+	}{plain: plain(r), For: r.For.String()})
+	if err != nil {
+		return nil, fmt.Errorf("alert rule marshal failed: %w", err)
+	}
+
+	return data, nil
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	aux := struct {
+		*plain
+		For string `json:"for"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("alert rule unmarshal failed: %w", err)
+	}
+
+	if aux.For == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(aux.For)
+	if err != nil {
+		return fmt.Errorf("alert rule unmarshal failed: %w", err)
+	}
+	r.For = d
+
+	return nil
+}
+
+// rulesFile is the format of the rules file, JSON is read as YAML.
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads and checks the rules file.
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("alert rules read failed: %w", err)
+	}
+
+	var f rulesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadRule, err)
+	}
+
+	names := make(map[string]struct{}, len(f.Rules))
+	for i := range f.Rules {
+		if err := f.Rules[i].compile(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := names[f.Rules[i].Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrBadRule, f.Rules[i].Name)
+		}
+		names[f.Rules[i].Name] = struct{}{}
+	}
+
+	return f.Rules, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" || r.Metric == "" {
+		return fmt.Errorf("%w: name and metric are required", ErrBadRule)
+	}
+
+	if r.Type != "gauge" && r.Type != "counter" {
+		return fmt.Errorf("%w: %s: unknown type %q", ErrBadRule, r.Name, r.Type)
+	}
+
+	m := exprPattern.FindStringSubmatch(r.Expr)
+	if m == nil {
+		return fmt.Errorf("%w: %s: expression %q", ErrBadRule, r.Name, r.Expr)
+	}
+
+	c := condition{function: m[1], operator: m[3]}
+	switch c.function {
+	case funcValue:
+		if m[2] != "" {
+			return fmt.Errorf("%w: %s: value takes no window", ErrBadRule, r.Name)
+		}
+	case funcIncrease, funcRate, funcAvg, funcMin, funcMax:
+		window, err := time.ParseDuration(m[2])
+		if err != nil || window <= 0 {
+			return fmt.Errorf("%w: %s: window %q", ErrBadRule, r.Name, m[2])
+		}
+		c.window = window
+	default:
+		return fmt.Errorf("%w: %s: unknown function %q", ErrBadRule, r.Name, c.function)
+	}
+
+	threshold, err := strconv.ParseFloat(m[4], 64)
+	if err != nil {
+		return fmt.Errorf("%w: %s: threshold %q", ErrBadRule, r.Name, m[4])
+	}
+	c.threshold = threshold
+
+	r.cond = c
+	r.Expr = strings.TrimSpace(r.Expr)
+
+	return nil
+}
+
+// holds compares the computed value with the threshold.
+func (c condition) holds(v float64) bool {
+	switch c.operator {
+	case ">":
+		return v > c.threshold
+	case ">=":
+		return v >= c.threshold
+	case "<":
+		return v < c.threshold
+	case "<=":
+		return v <= c.threshold
+	case "==":
+		return v == c.threshold
+	default:
+		return v != c.threshold
+	}
+}
+
+type sample struct {
+	time  time.Time
+	value float64
+}
+
+// compute returns the value of the function over the samples, the oldest first.
+// A window function needs a sample at least as old as the window, so a fresh rule does not fire on a part of it.
+func (c condition) compute(samples []sample, now time.Time) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	last := samples[len(samples)-1]
+	if c.function == funcValue {
+		return last.value, true
+	}
+
+	start := now.Add(-c.window)
+	if samples[0].time.After(start) {
+		return 0, false
+	}
+
+	// the last sample before the window is the base of the increase
+	base := samples[0]
+	in := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		if s.time.After(start) {
+			in = append(in, s.value)
+		} else {
+			base = s
+		}
+	}
+
+	switch c.function {
+	case funcIncrease:
+		return last.value - base.value, true
+	case funcRate:
+		return (last.value - base.value) / last.time.Sub(base.time).Seconds(), last.time.After(base.time)
+	}
+
+	if len(in) == 0 {
+		return 0, false
+	}
+
+	result := in[0]
+	sum := 0.0
+	for _, v := range in {
+		sum += v
+		switch c.function {
+		case funcMin:
+			result = min(result, v)
+		case funcMax:
+			result = max(result, v)
+		}
+	}
+
+	if c.function == funcAvg {
+		return sum / float64(len(in)), true
+	}
+
+	return result, true
+}
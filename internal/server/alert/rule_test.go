@@ -0,0 +1,106 @@
+package alert
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("yaml", func(t *testing.T) {
+		rules, err := Load(write("rules.yaml", `
+rules:
+  - name: HeapAllocHigh
+    metric: HeapAlloc
+    type: gauge
+    expr: value > 1e9
+    for: 1m
+  - name: PollCountStalled
+    metric: PollCount
+    type: counter
+    expr: increase(5m) <= 0
+`))
+		require.NoError(t, err)
+		require.Len(t, rules, 2)
+		require.Equal(t, time.Minute, rules[0].For)
+		require.Equal(t, condition{function: funcIncrease, operator: "<=", window: 5 * time.Minute}, rules[1].cond)
+
+		data, err := json.Marshal(rules[0])
+		require.NoError(t, err)
+		require.JSONEq(t, `{"name":"HeapAllocHigh","metric":"HeapAlloc","type":"gauge","expr":"value > 1e9","for":"1m0s"}`, string(data))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rules, err := Load(write("rules.json", `{"rules": [{"name": "a", "metric": "Alloc", "type": "gauge", "expr": "avg(1m) < 5", "for": "30s"}]}`))
+		require.NoError(t, err)
+		require.Equal(t, 30*time.Second, rules[0].For)
+	})
+
+	bad := []struct {
+		name string
+		rule string
+	}{
+		{name: "unknown function", rule: `{name: a, metric: m, type: gauge, expr: "sum(1m) > 1"}`},
+		{name: "value with window", rule: `{name: a, metric: m, type: gauge, expr: "value(1m) > 1"}`},
+		{name: "no window", rule: `{name: a, metric: m, type: gauge, expr: "rate > 1"}`},
+		{name: "bad threshold", rule: `{name: a, metric: m, type: gauge, expr: "value > x"}`},
+		{name: "bad type", rule: `{name: a, metric: m, type: histogram, expr: "value > 1"}`},
+		{name: "no metric", rule: `{name: a, type: gauge, expr: "value > 1"}`},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(write("bad.yaml", "rules:\n  - "+tt.rule+"\n"))
+			require.ErrorIs(t, err, ErrBadRule)
+		})
+	}
+
+	t.Run("duplicate name", func(t *testing.T) {
+		rule := `{name: a, metric: m, type: gauge, expr: "value > 1"}`
+		_, err := Load(write("dup.yaml", "rules:\n  - "+rule+"\n  - "+rule+"\n"))
+		require.ErrorIs(t, err, ErrBadRule)
+	})
+}
+
+func TestCompute(t *testing.T) {
+	now := time.Unix(1000, 0)
+	samples := []sample{
+		{time: now.Add(-90 * time.Second), value: 10},
+		{time: now.Add(-60 * time.Second), value: 20},
+		{time: now.Add(-30 * time.Second), value: 25},
+		{time: now, value: 40},
+	}
+
+	tests := []struct {
+		name string
+		cond condition
+		want float64
+		ok   bool
+	}{
+		{name: "value", cond: condition{function: funcValue}, want: 40, ok: true},
+		{name: "increase", cond: condition{function: funcIncrease, window: time.Minute}, want: 20, ok: true},
+		{name: "rate", cond: condition{function: funcRate, window: time.Minute}, want: 20.0 / 60, ok: true},
+		{name: "avg", cond: condition{function: funcAvg, window: time.Minute}, want: 32.5, ok: true},
+		{name: "min", cond: condition{function: funcMin, window: time.Minute}, want: 25, ok: true},
+		{name: "max", cond: condition{function: funcMax, window: time.Minute}, want: 40, ok: true},
+		{name: "window not covered", cond: condition{function: funcMax, window: 2 * time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.cond.compute(samples, now)
+			require.Equal(t, tt.ok, ok)
+			require.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
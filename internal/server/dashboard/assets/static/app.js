@@ -0,0 +1,108 @@
+(function () {
+	"use strict";
+
+	const search = document.getElementById("search");
+	const refresh = document.getElementById("refresh");
+	const width = 120;
+	const height = 24;
+	let timer = null;
+
+	function rows() {
+		return Array.from(document.querySelectorAll("tbody tr[data-name]"));
+	}
+
+	function filter() {
+		const query = search.value.trim().toLowerCase();
+		rows().forEach(function (row) {
+			row.hidden = query !== "" && !row.dataset.name.toLowerCase().includes(query);
+		});
+		localStorage.setItem("search", search.value);
+	}
+
+	function sort(th) {
+		const table = th.closest("table");
+		const tbody = table.querySelector("tbody");
+		const index = Array.from(th.parentNode.children).indexOf(th);
+		const asc = !th.classList.contains("asc");
+		const numeric = th.dataset.sort === "value";
+
+		table.querySelectorAll("th").forEach(function (h) {
+			h.classList.remove("asc", "desc");
+		});
+		th.classList.add(asc ? "asc" : "desc");
+
+		const list = Array.from(tbody.rows);
+		list.sort(function (a, b) {
+			const x = a.cells[index].textContent.trim();
+			const y = b.cells[index].textContent.trim();
+			const order = numeric ? parseFloat(x) - parseFloat(y) : x.localeCompare(y);
+			return asc ? order : -order;
+		});
+		list.forEach(function (row) {
+			tbody.appendChild(row);
+		});
+	}
+
+	function sparkline(points) {
+		if (!points || points.length < 2) {
+			return "";
+		}
+
+		const values = points.map(function (p) { return p.value; });
+		const low = Math.min.apply(null, values);
+		const span = (Math.max.apply(null, values) - low) || 1;
+		const step = width / (values.length - 1);
+		const coords = values.map(function (v, i) {
+			return (i * step).toFixed(1) + "," + (height - (v - low) / span * height).toFixed(1);
+		});
+
+		return '<svg class="sparkline" viewBox="0 0 ' + width + " " + height + '" width="' + width +
+			'" height="' + height + '"><polyline points="' + coords.join(" ") + '"/></svg>';
+	}
+
+	function update() {
+		fetch("/dashboard/api/metrics", { headers: { Accept: "application/json" } })
+			.then(function (res) { return res.json(); })
+			.then(function (items) {
+				const known = new Map();
+				rows().forEach(function (row) {
+					known.set(row.dataset.type + "/" + row.dataset.name, row);
+				});
+
+				// a new metric needs a row of its own and a hidden one leaves, the page is rendered again
+				if (items.length !== known.size ||
+					items.some(function (i) { return !known.has((i.type || "") + "/" + i.id); })) {
+					location.reload();
+					return;
+				}
+
+				items.forEach(function (i) {
+					const row = known.get((i.type || "") + "/" + i.id);
+					row.querySelector(".value").textContent = i.value;
+					row.classList.toggle("stale", Boolean(i.stale));
+					row.querySelector(".spark").innerHTML = sparkline(i.history);
+				});
+			})
+			.catch(function () {});
+	}
+
+	function schedule() {
+		clearInterval(timer);
+		const seconds = parseInt(refresh.value, 10);
+		if (seconds > 0) {
+			timer = setInterval(update, seconds * 1000);
+		}
+		localStorage.setItem("refresh", refresh.value);
+	}
+
+	search.value = localStorage.getItem("search") || "";
+	refresh.value = localStorage.getItem("refresh") || "0";
+	search.addEventListener("input", filter);
+	refresh.addEventListener("change", schedule);
+	document.querySelectorAll("th[data-sort]").forEach(function (th) {
+		th.addEventListener("click", function () { sort(th); });
+	});
+
+	filter();
+	schedule();
+})();
@@ -0,0 +1,170 @@
+// Package dashboard renders the built-in web dashboard of the server, its assets are embedded into the binary.
+package dashboard
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sparkWidth  = 120
+	sparkHeight = 24
+	pageWidth   = 640
+	pageHeight  = 160
+)
+
+//go:embed assets
+var assets embed.FS
+
+// templates are parsed once, the pages only execute them.
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"sparkline": func(points []Point) Spark { return Sparkline(points, sparkWidth, sparkHeight) },
+	"chart":     func(points []Point) Spark { return Sparkline(points, pageWidth, pageHeight) },
+}).ParseFS(assets, "assets/*.html"))
+
+// Item is a metric row of the dashboard.
+type Item struct {
+	Name    string  `json:"id"`
+	Type    string  `json:"type,omitempty"` // empty when the storage does not tell the types apart
+	Value   string  `json:"value"`
+	History []Point `json:"history,omitempty"`
+	Stale   bool    `json:"stale,omitempty"` // nobody wrote the metric for the staleness TTL
+}
+
+// Link is the path of the detail page, empty for the metrics of unknown type.
+func (i Item) Link() string {
+	if i.Type == "" {
+		return ""
+	}
+
+	return "/dashboard/metric/" + url.PathEscape(i.Type) + "/" + url.PathEscape(i.Name)
+}
+
+// Group is a section of the dashboard with the metrics of a single type.
+type Group struct {
+	Type  string
+	Title string
+	Items []Item
+}
+
+// Groups splits the items by type and sorts them by name, the counters go first.
+func Groups(items []Item) []Group {
+	byType := make(map[string][]Item)
+	for _, i := range items {
+		byType[i.Type] = append(byType[i.Type], i)
+	}
+
+	types := make([]string, 0, len(byType))
+	for t := range byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	groups := make([]Group, 0, len(types))
+	for _, t := range types {
+		list := byType[t]
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+		title := "Metrics"
+		if t != "" {
+			title = strings.ToUpper(t[:1]) + t[1:] + "s"
+		}
+		groups = append(groups, Group{Type: t, Title: title, Items: list})
+	}
+
+	return groups
+}
+
+// Index renders the list of the metrics.
+func Index(w io.Writer, items []Item) error {
+	data := struct {
+		Title  string
+		Groups []Group
+	}{
+		Title:  "Metrics",
+		Groups: Groups(items),
+	}
+
+	if err := templates.ExecuteTemplate(w, "index.html", data); err != nil {
+		return fmt.Errorf("dashboard index execute failed: %w", err)
+	}
+
+	return nil
+}
+
+// Metric renders the detail page of a metric, the points are listed from the newest.
+func Metric(w io.Writer, item Item) error {
+	recent := make([]Point, len(item.History))
+	for i, p := range item.History {
+		recent[len(recent)-1-i] = p
+	}
+
+	data := struct {
+		Recent []Point
+		Item   Item
+	}{
+		Item:   item,
+		Recent: recent,
+	}
+
+	if err := templates.ExecuteTemplate(w, "metric.html", data); err != nil {
+		return fmt.Errorf("dashboard metric execute failed: %w", err)
+	}
+
+	return nil
+}
+
+// Static serves the scripts and the styles under the prefix.
+func Static(prefix string) http.Handler {
+	static, err := fs.Sub(assets, "assets/static")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix(prefix, http.FileServer(http.FS(static)))
+}
+
+// Spark is a line of points scaled to the box of an inline SVG.
+type Spark struct {
+	Points string
+	Width  int
+	Height int
+}
+
+// Sparkline scales the points to the box, fewer than two points make an empty line.
+func Sparkline(points []Point, width, height int) Spark {
+	spark := Spark{Width: width, Height: height}
+	if len(points) < 2 {
+		return spark
+	}
+
+	low, high := points[0].Value, points[0].Value
+	for _, p := range points {
+		low = min(low, p.Value)
+		high = max(high, p.Value)
+	}
+
+	span := high - low
+	if span == 0 {
+		span = 1
+	}
+
+	coords := make([]string, 0, len(points))
+	step := float64(width) / float64(len(points)-1)
+	for i, p := range points {
+		x := float64(i) * step
+		y := float64(height) - (p.Value-low)/span*float64(height)
+		coords = append(coords, strconv.FormatFloat(x, 'f', 1, 64)+","+strconv.FormatFloat(y, 'f', 1, 64))
+	}
+	spark.Points = strings.Join(coords, " ")
+
+	return spark
+}
@@ -0,0 +1,84 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	value, delta := 1.0, int64(5)
+	h := NewHistory(2)
+
+	for i := range 3 {
+		v := value + float64(i)
+		h.Notify(context.Background(), []model.Metric{
+			{ID: "Alloc", MType: "gauge", Value: &v},
+			{ID: "PollCount", MType: "counter", Delta: &delta},
+		})
+	}
+
+	alloc := h.Points("gauge", "Alloc")
+	require.Len(t, alloc, 2)
+	require.InDelta(t, 2, alloc[0].Value, 1e-9)
+	require.InDelta(t, 3, alloc[1].Value, 1e-9)
+
+	require.InDelta(t, 5, h.Points("counter", "PollCount")[1].Value, 1e-9)
+	require.Empty(t, h.Points("counter", "Alloc"))
+}
+
+func TestGroups(t *testing.T) {
+	groups := Groups([]Item{
+		{Name: "b", Type: "gauge"},
+		{Name: "a", Type: "gauge"},
+		{Name: "c", Type: "counter"},
+	})
+
+	require.Len(t, groups, 2)
+	require.Equal(t, "Counters", groups[0].Title)
+	require.Equal(t, "Gauges", groups[1].Title)
+	require.Equal(t, "a", groups[1].Items[0].Name)
+	require.Equal(t, "/dashboard/metric/gauge/a", groups[1].Items[0].Link())
+}
+
+func TestSparkline(t *testing.T) {
+	require.Empty(t, Sparkline([]Point{{Value: 1}}, 10, 10).Points)
+
+	spark := Sparkline([]Point{{Value: 0}, {Value: 5}, {Value: 10}}, 10, 10)
+	require.Equal(t, "0.0,10.0 5.0,5.0 10.0,0.0", spark.Points)
+}
+
+func TestPages(t *testing.T) {
+	item := Item{Name: "Alloc", Type: "gauge", Value: "2", History: []Point{
+		{Time: time.Unix(0, 0), Value: 1},
+		{Time: time.Unix(1, 0), Value: 2},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, Index(&buf, []Item{item}))
+	require.Contains(t, buf.String(), `<a href="/dashboard/metric/gauge/Alloc">Alloc</a>`)
+	require.Contains(t, buf.String(), `<polyline points="0.0,24.0 120.0,0.0"/>`)
+
+	buf.Reset()
+	require.NoError(t, Metric(&buf, item))
+	require.Contains(t, buf.String(), "<h1>Alloc</h1>")
+	require.Contains(t, buf.String(), "Recent values")
+
+	buf.Reset()
+	item.Stale = true
+	require.NoError(t, Index(&buf, []Item{item}))
+	require.Contains(t, buf.String(), `<tr data-name="Alloc" data-type="gauge" class="stale"`)
+
+	t.Run("static assets", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Static("/static/").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/app.js", http.NoBody))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "/dashboard/api/metrics")
+	})
+}
@@ -0,0 +1,83 @@
+package dashboard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// maxSeries bounds the memory of the history, the series saved after the limit is reached have none.
+const maxSeries = 10000
+
+// Point is a saved value of a metric: the value of a gauge or the increment of a counter.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+type seriesKey struct {
+	mType string
+	name  string
+}
+
+// History keeps the last points of every metric for the sparklines, it is a storage notifier,
+// so the points are the writes the server received since it started.
+type History struct {
+	series map[seriesKey][]Point
+	now    func() time.Time
+	mutex  sync.RWMutex
+	size   int
+}
+
+// NewHistory keeps up to size points of a metric.
+func NewHistory(size int) *History {
+	return &History{
+		series: make(map[seriesKey][]Point),
+		now:    time.Now,
+		size:   size,
+	}
+}
+
+func (h *History) Notify(_ context.Context, elems []model.Metric) {
+	now := h.now()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, m := range elems {
+		p := Point{Time: now}
+		switch {
+		case m.Delta != nil:
+			p.Value = float64(*m.Delta)
+		case m.Value != nil:
+			p.Value = *m.Value
+		default:
+			continue
+		}
+
+		key := seriesKey{mType: m.MType, name: m.ID}
+		points, ok := h.series[key]
+		if !ok && len(h.series) >= maxSeries {
+			continue
+		}
+
+		if len(points) >= h.size {
+			points = append(points[:0], points[len(points)-h.size+1:]...)
+		}
+		h.series[key] = append(points, p)
+	}
+}
+
+// Points returns a copy of the points of the metric, the oldest first.
+func (h *History) Points(mType, name string) []Point {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	points := h.series[seriesKey{mType: mType, name: name}]
+	out := make([]Point, len(points))
+	copy(out, points)
+
+	return out
+}
@@ -0,0 +1,106 @@
+// Package forward passes the saved metrics on to the downstream HTTP endpoints, e.g. the /updates/ of another server.
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrBadDestination = errors.New("forward destination is invalid")
+
+// drop policies of a full queue.
+const (
+	DropNewest = "newest"
+	DropOldest = "oldest"
+)
+
+const (
+	defaultQueue   = 100
+	defaultRetries = 3
+	defaultTimeout = 5 * time.Second
+)
+
+// Destination is an endpoint receiving the batches as a JSON array of metrics, like the /updates/ of the server.
+type Destination struct {
+	Name    string        `yaml:"name"`
+	URL     string        `yaml:"url"`
+	Key     string        `yaml:"key"`     // secret signing the body into the HashSHA256 header, empty to send unsigned
+	Drop    string        `yaml:"drop"`    // what to drop when the queue is full: the newest batch or the oldest one
+	Timeout time.Duration `yaml:"timeout"` // deadline of a single attempt
+	Queue   int           `yaml:"queue"`   // number of batches waiting for the delivery
+	Retries uint          `yaml:"retries"` // number of attempts of a batch
+}
+
+// destinationsFile is the format of the forwarding file, JSON is read as YAML.
+type destinationsFile struct {
+	Destinations []Destination `yaml:"destinations"`
+}
+
+// Load reads the forwarding file and fills the defaults.
+func Load(path string) ([]Destination, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("forward destinations read failed: %w", err)
+	}
+
+	var f destinationsFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadDestination, err)
+	}
+
+	names := make(map[string]struct{}, len(f.Destinations))
+	for i := range f.Destinations {
+		if err := f.Destinations[i].check(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := names[f.Destinations[i].Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrBadDestination, f.Destinations[i].Name)
+		}
+		names[f.Destinations[i].Name] = struct{}{}
+	}
+
+	return f.Destinations, nil
+}
+
+func (d *Destination) check() error {
+	u, err := url.Parse(d.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url %q", ErrBadDestination, d.URL)
+	}
+
+	if d.Name == "" {
+		d.Name = d.URL
+	}
+
+	switch d.Drop {
+	case "":
+		d.Drop = DropNewest
+	case DropNewest, DropOldest:
+	default:
+		return fmt.Errorf("%w: %s: unknown drop policy %q", ErrBadDestination, d.Name, d.Drop)
+	}
+
+	if d.Queue < 0 || d.Timeout < 0 {
+		return fmt.Errorf("%w: %s: queue and timeout can not be negative", ErrBadDestination, d.Name)
+	}
+
+	if d.Queue == 0 {
+		d.Queue = defaultQueue
+	}
+
+	if d.Timeout == 0 {
+		d.Timeout = defaultTimeout
+	}
+
+	if d.Retries == 0 {
+		d.Retries = defaultRetries
+	}
+
+	return nil
+}
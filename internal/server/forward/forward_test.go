@@ -0,0 +1,169 @@
+package forward
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		err  error
+		name string
+		file string
+	}{
+		{
+			name: "yaml with defaults",
+			file: `destinations:
+  - url: http://central:8080/updates/
+  - name: archive
+    url: https://archive/updates/
+    key: secret
+    drop: oldest
+    queue: 10
+    retries: 5
+    timeout: 1s
+`,
+		},
+		{name: "json", file: `{"destinations": [{"url": "http://central:8080/updates/"}, {"name": "archive", "url": "https://archive/updates/", "key": "secret", "drop": "oldest", "queue": 10, "retries": 5, "timeout": "1s"}]}`},
+		{name: "bad url", file: `destinations: [{url: "central:8080"}]`, err: ErrBadDestination},
+		{name: "bad drop policy", file: `destinations: [{url: "http://central", drop: all}]`, err: ErrBadDestination},
+		{name: "duplicate name", file: `destinations: [{url: "http://central"}, {url: "http://central"}]`, err: ErrBadDestination},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "forward.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.file), 0o600))
+
+			destinations, err := Load(path)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, []Destination{
+				{
+					Name:    "http://central:8080/updates/",
+					URL:     "http://central:8080/updates/",
+					Drop:    DropNewest,
+					Timeout: defaultTimeout,
+					Queue:   defaultQueue,
+					Retries: defaultRetries,
+				},
+				{
+					Name:    "archive",
+					URL:     "https://archive/updates/",
+					Key:     "secret",
+					Drop:    DropOldest,
+					Timeout: time.Second,
+					Queue:   10,
+					Retries: 5,
+				},
+			}, destinations)
+		})
+	}
+}
+
+func TestForwarder(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := 0
+	received := make([]model.Metric, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		h := hmac.New(sha256.New, []byte("secret"))
+		_, err = h.Write(body)
+		require.NoError(t, err)
+		require.Equal(t, hex.EncodeToString(h.Sum(nil)), r.Header.Get("HashSHA256"))
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// the first attempt fails, so the batch is delivered by the retry
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch []model.Metric
+		require.NoError(t, json.Unmarshal(body, &batch))
+		received = append(received, batch...)
+	}))
+	defer srv.Close()
+
+	f := New([]Destination{{Name: "central", URL: srv.URL, Key: "secret", Drop: DropNewest, Queue: 10, Retries: 2, Timeout: time.Second}}, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+
+	delta := int64(5)
+	batch := []model.Metric{{ID: "PollCount", MType: "counter", Delta: &delta}}
+	f.Notify(ctx, batch)
+	batch[0].ID = "Reused"
+
+	require.Eventually(t, func() bool { return f.Status()[0].Sent == 1 }, time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	require.Equal(t, []model.Metric{{ID: "PollCount", MType: "counter", Delta: &delta}}, received)
+	require.Equal(t, 2, attempts)
+	mutex.Unlock()
+
+	cancel()
+	<-done
+	require.Equal(t, Status{Name: "central", URL: srv.URL, Drop: DropNewest, Sent: 1}, f.Status()[0])
+}
+
+func TestForwarderDrop(t *testing.T) {
+	value := func(v float64) []model.Metric {
+		return []model.Metric{{ID: "Alloc", MType: "gauge", Value: &v}}
+	}
+
+	tests := []struct {
+		name  string
+		drop  string
+		first float64
+	}{
+		{name: "newest batch is dropped", drop: DropNewest, first: 1},
+		{name: "oldest batch is dropped", drop: DropOldest, first: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no worker runs, so the queue fills up
+			f := New([]Destination{{URL: "http://central", Drop: tt.drop, Queue: 2}}, zap.NewNop())
+			for i := range 3 {
+				f.Notify(context.Background(), value(float64(i+1)))
+			}
+
+			d := f.destinations[0]
+			require.Equal(t, int64(1), d.dropped.Load())
+			require.Equal(t, 2, f.Status()[0].Queued)
+			require.InDelta(t, tt.first, *(<-d.queue)[0].Value, 0)
+		})
+	}
+}
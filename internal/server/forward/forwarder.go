@@ -0,0 +1,191 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/retry"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"go.uber.org/zap"
+)
+
+// Status is the delivery state of a destination, the counters are batches since the server started.
+type Status struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Drop    string `json:"drop"`
+	Queued  int    `json:"queued"`
+	Sent    int64  `json:"sent"`
+	Failed  int64  `json:"failed"`  // given up after the retries
+	Dropped int64  `json:"dropped"` // did not fit into the full queue
+}
+
+type destination struct {
+	queue   chan []model.Metric
+	client  *http.Client
+	config  Destination
+	sent    atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+}
+
+// Forwarder is a storage notifier that queues every saved batch for each destination,
+// the batches are delivered in the order they were saved by a worker of the destination.
+type Forwarder struct {
+	log          *zap.Logger
+	destinations []*destination
+}
+
+func New(destinations []Destination, log *zap.Logger) *Forwarder {
+	f := &Forwarder{log: log, destinations: make([]*destination, 0, len(destinations))}
+	for _, d := range destinations {
+		f.destinations = append(f.destinations, &destination{
+			queue:  make(chan []model.Metric, d.Queue),
+			client: &http.Client{Timeout: d.Timeout},
+			config: d,
+		})
+	}
+
+	return f
+}
+
+// Notify queues the batch without waiting, the full queue of a destination drops a batch by its policy.
+func (f *Forwarder) Notify(_ context.Context, elems []model.Metric) {
+	// the caller may reuse the slice once the save returns
+	batch := make([]model.Metric, len(elems))
+	copy(batch, elems)
+
+	for _, d := range f.destinations {
+		d.push(batch)
+	}
+}
+
+func (d *destination) push(batch []model.Metric) {
+	select {
+	case d.queue <- batch:
+		return
+	default:
+	}
+
+	if d.config.Drop == DropOldest {
+		select {
+		case <-d.queue:
+			d.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case d.queue <- batch:
+			return
+		default:
+		}
+	}
+
+	d.dropped.Add(1)
+}
+
+// Run delivers the queued batches until the context is done, the batches still queued then are lost.
+func (f *Forwarder) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, d := range f.destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.work(ctx, d)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (f *Forwarder) work(ctx context.Context, d *destination) {
+	log := f.log.With(zap.String("destination", d.config.Name))
+	canRetry := retry.Any(retry.IsConnRefused, retry.IsTimeout, retry.IsHTTPRetryable)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-d.queue:
+			err := retry.New(func() error { return d.send(ctx, batch) }, canRetry, d.config.Retries).RunContext(ctx)
+			if err != nil {
+				d.failed.Add(1)
+				log.Error("forward batch failed", zap.Int("metrics", len(batch)), zap.Error(err))
+				continue
+			}
+			d.sent.Add(1)
+		}
+	}
+}
+
+func (d *destination) send(ctx context.Context, batch []model.Metric) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("forward marshal failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("forward request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if d.config.Key != "" {
+		h := hmac.New(sha256.New, []byte(d.config.Key))
+		if _, err := h.Write(body); err != nil {
+			return fmt.Errorf("forward sign failed: %w", err)
+		}
+		req.Header.Set("HashSHA256", hex.EncodeToString(h.Sum(nil)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("forward send failed: %w", err)
+	}
+
+	// the body is drained, so the connection is kept for the next batch
+	_, err = io.Copy(io.Discard, resp.Body)
+	if cErr := resp.Body.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("forward response read failed: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &retry.StatusError{
+			Code:  resp.StatusCode,
+			After: retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	return nil
+}
+
+// Status returns the state of every destination in the order of the forwarding file.
+func (f *Forwarder) Status() []Status {
+	statuses := make([]Status, 0, len(f.destinations))
+	for _, d := range f.destinations {
+		statuses = append(statuses, Status{
+			Name:    d.config.Name,
+			URL:     d.config.URL,
+			Drop:    d.config.Drop,
+			Queued:  len(d.queue),
+			Sent:    d.sent.Load(),
+			Failed:  d.failed.Load(),
+			Dropped: d.dropped.Load(),
+		})
+	}
+
+	return statuses
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/arefev/mtrcstore/internal/breaker"
+	"github.com/arefev/mtrcstore/internal/server/forward"
+	"github.com/arefev/mtrcstore/internal/server/relay"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.uber.org/zap"
+)
+
+// Snapshot godoc
+//
+//	@Tags		Admin
+//	@Summary	Write storage snapshot to the disk
+//	@ID			snapshotMetric
+//	@Accept		text/html
+//	@Produce	text/html
+//	@Success	200
+//	@Failure	500	{object}	Problem
+//	@Failure	501	{object}	Problem
+//	@Router		/admin/snapshot [post]
+func (h *MetricHandlers) Snapshot(w http.ResponseWriter, r *http.Request) {
+	s, ok := repository.As[repository.Snapshotter](h.Storage)
+	if !ok {
+		h.writeProblem(w, r, fmt.Errorf("%w: storage does not support snapshots", errNotImplemented))
+		return
+	}
+
+	if err := s.Snapshot(r.Context()); err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	if _, err := w.Write([]byte("Snapshot saved!")); err != nil {
+		h.log.Error("handler Snapshot: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// Limits godoc
+//
+//	@Tags		Admin
+//	@Summary	Get configured limits and number of rejected writes
+//	@ID			limitsMetric
+//	@Accept		application/json
+//	@Produce	application/json
+//	@Success	200
+//	@Failure	500	{object}	Problem
+//	@Failure	501	{object}	Problem
+//	@Router		/admin/limits [get]
+func (h *MetricHandlers) Limits(w http.ResponseWriter, r *http.Request) {
+	l, ok := repository.As[repository.LimitReporter](h.Storage)
+	if !ok {
+		h.writeProblem(w, r, fmt.Errorf("%w: storage has no limits", errNotImplemented))
+		return
+	}
+
+	data := struct {
+		Rejections map[string]int64  `json:"rejections"`
+		Limits     repository.Limits `json:"limits"`
+		Series     int               `json:"series"`
+	}{
+		Rejections: l.Rejections(),
+		Limits:     l.Limits(),
+		Series:     l.Series(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.log.Error("handler Limits: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// Breakers godoc
+//
+//	@Tags		Admin
+//	@Summary	Get state of the circuit breakers protecting the storage
+//	@ID			breakersMetric
+//	@Accept		application/json
+//	@Produce	application/json
+//	@Success	200	{array}		breaker.Status
+//	@Failure	500	{object}	Problem
+//	@Router		/admin/breakers [get]
+func (h *MetricHandlers) Breakers(w http.ResponseWriter, r *http.Request) {
+	statuses := []breaker.Status{}
+	if b, ok := repository.As[repository.BreakerReporter](h.Storage); ok {
+		statuses = append(statuses, b.Breakers()...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		h.log.Error("handler Breakers: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// Export godoc
+//
+//	@Tags		Admin
+//	@Summary	Stream all metrics as NDJSON
+//	@ID			exportMetrics
+//	@Produce	application/x-ndjson
+//	@Success	200
+//	@Failure	500	{object}	Problem
+//	@Failure	501	{object}	Problem
+//	@Failure	503	{object}	Problem
+//	@Router		/admin/export [get]
+func (h *MetricHandlers) Export(w http.ResponseWriter, r *http.Request) {
+	if _, ok := repository.As[repository.Lister](h.Storage); !ok {
+		h.writeProblem(w, r, fmt.Errorf("%w: storage can not list metrics", errNotImplemented))
+		return
+	}
+
+	// the body is written as the metrics are encoded, so a failure midway can only be logged
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if _, err := repository.Export(r.Context(), h.Storage, w); err != nil {
+		h.log.Error("handler Export failed", zap.Error(err))
+	}
+}
+
+// Import godoc
+//
+//	@Tags			Admin
+//	@Summary		Load metrics written by the export
+//	@Description	Counters are added to the existing values.
+//	@ID				importMetrics
+//	@Accept			application/x-ndjson
+//	@Produce		application/json
+//	@Success		200	{object}	repository.ImportResult
+//	@Failure		400	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Failure		503	{object}	Problem
+//	@Router			/admin/import [post]
+func (h *MetricHandlers) Import(w http.ResponseWriter, r *http.Request) {
+	res, err := repository.Import(r.Context(), h.Storage, r.Body)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.log.Error("handler Import: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// Forward godoc
+//
+//	@Tags		Admin
+//	@Summary	Get delivery state of the forwarding destinations
+//	@ID			forwardMetrics
+//	@Produce	application/json
+//	@Success	200	{array}		forward.Status
+//	@Failure	500	{object}	Problem
+//	@Failure	501	{object}	Problem
+//	@Router		/admin/forward [get]
+func (h *MetricHandlers) Forward(w http.ResponseWriter, r *http.Request) {
+	if h.Forwarder == nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: forwarding is not configured", errNotImplemented))
+		return
+	}
+
+	statuses := []forward.Status{}
+	statuses = append(statuses, h.Forwarder.Status()...)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		h.log.Error("handler Forward: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// Relay godoc
+//
+//	@Tags		Admin
+//	@Summary	Get state of the relay to the upstream server
+//	@ID			relayMetrics
+//	@Produce	application/json
+//	@Success	200	{object}	relay.Status
+//	@Failure	500	{object}	Problem
+//	@Failure	501	{object}	Problem
+//	@Router		/admin/relay [get]
+func (h *MetricHandlers) RelayStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.relayStatus()
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		h.log.Error("handler RelayStatus: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *MetricHandlers) relayStatus() (relay.Status, error) {
+	if h.Relay == nil {
+		return relay.Status{}, fmt.Errorf("%w: relay mode is off", errNotImplemented)
+	}
+
+	return h.Relay.Status(), nil
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/arefev/mtrcstore/internal/server/alert"
+	"go.uber.org/zap"
+)
+
+// Alerts godoc
+//
+//	@Tags		Info
+//	@Summary	Get state of the alert rules
+//	@ID			alerts
+//	@Produce	application/json
+//	@Param		state	query		string	false	"alert state [inactive, pending, firing, resolved]"
+//	@Success	200		{array}		alert.Alert
+//	@Failure	500		{object}	Problem
+//	@Failure	501		{object}	Problem
+//	@Router		/alerts [get]
+func (h *MetricHandlers) Alerts(w http.ResponseWriter, r *http.Request) {
+	if h.Alerting == nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: alert rules are not configured", errNotImplemented))
+		return
+	}
+
+	alerts := h.Alerting.Alerts()
+	if state := r.URL.Query().Get("state"); state != "" {
+		filtered := make([]alert.Alert, 0, len(alerts))
+		for _, a := range alerts {
+			if a.State == state {
+				filtered = append(filtered, a)
+			}
+		}
+		alerts = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(alerts); err != nil {
+		h.log.Error("handler Alerts: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/arefev/mtrcstore/internal/server/dashboard"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.uber.org/zap"
+)
+
+// Get godoc
+//
+//	@Tags		Info
+//	@Summary	Get metrics dashboard
+//	@ID			getMetric
+//	@Accept		text/html
+//	@Produce	text/html
+//	@Success	200
+//	@Failure	500
+//	@Router		/ [get]
+func (h *MetricHandlers) Get(w http.ResponseWriter, r *http.Request) {
+	items, err := h.dashboardItems(r.Context())
+	if err != nil {
+		h.log.Error("handler Get failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := dashboard.Index(w, items); err != nil {
+		h.log.Error("handler Get failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// MetricPage godoc
+//
+//	@Tags		Info
+//	@Summary	Get dashboard page of a metric
+//	@ID			metricPage
+//	@Produce	text/html
+//	@Param		type	path	string	true	"metric type [counter, gauge]"
+//	@Param		name	path	string	true	"metric name"
+//	@Success	200
+//	@Failure	400	{object}	Problem
+//	@Failure	404	{object}	Problem
+//	@Failure	500	{object}	Problem
+//	@Router		/dashboard/metric/{type}/{name} [get]
+func (h *MetricHandlers) MetricPage(w http.ResponseWriter, r *http.Request) {
+	mType, err := h.getType(r)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	metric, err := h.Storage.Find(r.Context(), r.PathValue("name"), mType)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := dashboard.Metric(w, h.dashboardItem(metric)); err != nil {
+		h.log.Error("handler MetricPage failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// DashboardData godoc
+//
+//	@Tags		Info
+//	@Summary	Get metrics with their history for the dashboard refresh
+//	@ID			dashboardData
+//	@Produce	application/json
+//	@Success	200	{array}		dashboard.Item
+//	@Failure	500	{object}	Problem
+//	@Router		/dashboard/api/metrics [get]
+func (h *MetricHandlers) DashboardData(w http.ResponseWriter, r *http.Request) {
+	items, err := h.dashboardItems(r.Context())
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		h.log.Error("handler DashboardData: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// dashboardItems lists the metrics with their types when the storage can,
+// otherwise the dashboard shows the untyped values of Get.
+func (h *MetricHandlers) dashboardItems(ctx context.Context) ([]dashboard.Item, error) {
+	l, ok := repository.As[repository.Lister](h.Storage)
+	if !ok {
+		list := h.Storage.Get(ctx)
+		items := make([]dashboard.Item, 0, len(list))
+		for name, value := range list {
+			items = append(items, dashboard.Item{Name: name, Value: value})
+		}
+		return items, nil
+	}
+
+	list, err := l.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dashboard list failed: %w", err)
+	}
+
+	sr, tracked := repository.As[repository.StaleReporter](h.Storage)
+	hide := tracked && sr.Staleness().Hide
+
+	items := make([]dashboard.Item, 0, len(list))
+	for _, m := range list {
+		item := h.dashboardItem(m)
+		if item.Stale && hide {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (h *MetricHandlers) dashboardItem(m model.Metric) dashboard.Item {
+	item := dashboard.Item{Name: m.ID, Type: m.MType, Stale: h.stale(m)}
+	switch m.MType {
+	case repository.CounterName:
+		item.Value = m.DeltaString()
+	default:
+		item.Value = m.ValueString()
+	}
+
+	if h.History != nil {
+		item.History = h.History.Points(m.MType, m.ID)
+	}
+
+	return item
+}
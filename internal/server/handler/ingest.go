@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+
+	"github.com/arefev/mtrcstore/internal/proto/prompb"
+	"github.com/arefev/mtrcstore/internal/server/ingest"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/klauspost/compress/snappy"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+const (
+	// maxIngestBody bounds the body of the foreign protocol requests as it is read, after the gzip decoding.
+	maxIngestBody = 8 << 20
+	// maxRemoteWriteSize bounds the remote_write request after the snappy decoding,
+	// the size is declared by the request, so it is checked before the memory is allocated.
+	maxRemoteWriteSize = 32 << 20
+)
+
+// OTLP godoc
+//
+//	@Tags		Update
+//	@Summary	Receive OpenTelemetry metrics over OTLP/HTTP
+//	@ID			otlpMetrics
+//	@Accept		application/x-protobuf,application/json
+//	@Produce	application/x-protobuf,application/json
+//	@Success	200
+//	@Failure	400	{object}	Problem
+//	@Failure	413	{object}	Problem
+//	@Failure	415	{object}	Problem
+//	@Failure	500	{object}	Problem
+//	@Failure	503	{object}	Problem
+//	@Router		/v1/metrics [post]
+func (h *MetricHandlers) OTLP(w http.ResponseWriter, r *http.Request) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != contentTypeProtobuf && contentType != contentTypeJSON) {
+		h.writeProblem(w, r, fmt.Errorf("%w: %q", errUnsupportedMedia, r.Header.Get("Content-Type")))
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	req := &colmetrics.ExportMetricsServiceRequest{}
+	if contentType == contentTypeJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, req)
+	} else {
+		err = protobuf.Unmarshal(body, req)
+	}
+	if err != nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidBody, err))
+		return
+	}
+
+	resp, err := h.otlp.Export(r.Context(), h.Storage, req)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	var out []byte
+	if contentType == contentTypeJSON {
+		out, err = protojson.Marshal(resp)
+	} else {
+		out, err = protobuf.Marshal(resp)
+	}
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(out); err != nil {
+		h.log.Error("handler OTLP: response writer failed", zap.Error(err))
+	}
+}
+
+// RemoteWrite godoc
+//
+//	@Tags		Update
+//	@Summary	Receive samples from Prometheus remote_write
+//	@ID			remoteWrite
+//	@Accept		application/x-protobuf
+//	@Produce	application/json
+//	@Success	204
+//	@Failure	400	{object}	Problem
+//	@Failure	413	{object}	Problem
+//	@Failure	415	{object}	Problem
+//	@Failure	500	{object}	Problem
+//	@Failure	503	{object}	Problem
+//	@Router		/api/v1/write [post]
+func (h *MetricHandlers) RemoteWrite(w http.ResponseWriter, r *http.Request) {
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "snappy" {
+		h.writeProblem(w, r, fmt.Errorf("%w: content encoding %q", errUnsupportedMedia, encoding))
+		return
+	}
+
+	compressed, err := readBody(w, r)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidBody, err))
+		return
+	}
+
+	if size > maxRemoteWriteSize {
+		h.writeProblem(w, r, fmt.Errorf("%w: %d bytes decoded, max %d", errTooLarge, size, maxRemoteWriteSize))
+		return
+	}
+
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidBody, err))
+		return
+	}
+
+	req := &prompb.WriteRequest{}
+	if err := protobuf.Unmarshal(body, req); err != nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidBody, err))
+		return
+	}
+
+	elems, rejections, batch := h.prometheus.Metrics(req)
+	results, err := repository.MassSavePartial(r.Context(), h.Storage, elems)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+	batch.Commit(results)
+
+	for _, res := range results {
+		if res.Status == model.ResultRejected {
+			rejections = append(rejections, ingest.Rejection{Name: res.ID, Err: errors.New(res.Reason)})
+		}
+	}
+
+	// the accepted series are saved, a client error keeps Prometheus from resending the rejected ones
+	if len(rejections) > 0 {
+		h.writeProblem(w, r, fmt.Errorf(
+			"%w: %d of %d series rejected, %s: %w",
+			repository.ErrInvalid, len(rejections), len(req.GetTimeseries()), rejections[0].Name, rejections[0].Err,
+		))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InfluxWrite godoc
+//
+//	@Tags		Update
+//	@Summary	Receive points in the InfluxDB line protocol
+//	@ID			influxWrite
+//	@Accept		text/plain
+//	@Produce	application/json
+//	@Param		precision	query	string	false	"unit of the timestamps [ns, us, ms, s, m, h]"
+//	@Param		counters	query	string	false	"integer fields are [cumulative, delta] counters, gauges by default"
+//	@Success	204
+//	@Failure	400	{object}	Problem
+//	@Failure	413	{object}	Problem
+//	@Failure	500	{object}	Problem
+//	@Failure	503	{object}	Problem
+//	@Router		/write [post]
+func (h *MetricHandlers) InfluxWrite(w http.ResponseWriter, r *http.Request) {
+	precision := r.URL.Query().Get("precision")
+	if err := ingest.CheckPrecision(precision); err != nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidValue, err))
+		return
+	}
+
+	counters := r.URL.Query().Get("counters")
+	if counters != "" && counters != ingest.CountersCumulative && counters != ingest.CountersDelta {
+		h.writeProblem(w, r, fmt.Errorf("%w: counters %q", errInvalidValue, counters))
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	elems, lines, lineErrs, batch := h.influx.Metrics(body, precision, counters)
+	results, err := repository.MassSavePartial(r.Context(), h.Storage, elems)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+	batch.Commit(results)
+
+	for i, res := range results {
+		if res.Status == model.ResultRejected {
+			lineErrs = append(lineErrs, ingest.LineError{Line: lines[i], Error: res.ID + ": " + res.Reason})
+		}
+	}
+
+	// the valid lines are saved as InfluxDB does on a partial write
+	if len(lineErrs) > 0 {
+		sort.SliceStable(lineErrs, func(i, j int) bool { return lineErrs[i].Line < lineErrs[j].Line })
+		h.writeProblem(w, r, &linesError{
+			err:   fmt.Errorf("%w: partial write, %d lines rejected", errInvalidBody, len(lineErrs)),
+			lines: lineErrs,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readBody reads the body of a foreign protocol request up to maxIngestBody.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBody))
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return nil, fmt.Errorf("%w: max %d bytes", errTooLarge, maxErr.Limit)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidBody, err)
+	}
+
+	return body, nil
+}
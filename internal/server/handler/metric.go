@@ -2,13 +2,19 @@ package handler
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"github.com/arefev/mtrcstore/internal/server/alert"
+	"github.com/arefev/mtrcstore/internal/server/dashboard"
+	"github.com/arefev/mtrcstore/internal/server/forward"
+	"github.com/arefev/mtrcstore/internal/server/ingest"
 	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/relay"
 	"github.com/arefev/mtrcstore/internal/server/repository"
-	"github.com/arefev/mtrcstore/internal/server/service"
+	"github.com/arefev/mtrcstore/internal/server/stats"
+	"github.com/arefev/mtrcstore/internal/server/stream"
 	"go.uber.org/zap"
 )
 
@@ -25,15 +31,30 @@ import (
 //	@Tag.name			Update
 //	@Tag.description	"Group of requests to update metrics"
 
+//	@Tag.name			Admin
+//	@Tag.description	"Group of requests to manage the storage"
+
 type MetricHandlers struct {
-	Storage repository.Storage
-	log     *zap.Logger
+	Storage    repository.Storage
+	Stats      *stats.Registry    // operational metrics of the server, nil disables them
+	Hub        *stream.Hub        // live stream of the saved metrics, nil disables it
+	History    *dashboard.History // points of the dashboard sparklines, nil disables them
+	Alerting   *alert.Engine      // alert rules, nil when none are configured
+	Forwarder  *forward.Forwarder // downstream destinations of the saved metrics, nil when none are configured
+	Relay      *relay.Relay       // upstream server of the saved metrics, nil when the relay mode is off
+	otlp       *ingest.OTLP
+	prometheus *ingest.Prometheus
+	influx     *ingest.Influx
+	log        *zap.Logger
 }
 
 func NewMetricHandlers(s repository.Storage, log *zap.Logger) *MetricHandlers {
 	m := MetricHandlers{
-		Storage: s,
-		log:     log,
+		Storage:    s,
+		otlp:       ingest.NewOTLP(),
+		prometheus: ingest.NewPrometheus(),
+		influx:     ingest.NewInflux(),
+		log:        log,
 	}
 	return &m
 }
@@ -49,13 +70,15 @@ func NewMetricHandlers(s repository.Storage, log *zap.Logger) *MetricHandlers {
 //	@Param		name	path	string	true	"metric name"
 //	@Param		value	path	number	true	"metric value"
 //	@Success	200
-//	@Failure	400
-//	@Failure	500
+//	@Failure	400	{object}	Problem
+//	@Failure	422	{object}	Problem
+//	@Failure	500	{object}	Problem
+//	@Failure	503	{object}	Problem
 //	@Router		/update/{type}/{name}/{value} [post]
 func (h *MetricHandlers) Update(w http.ResponseWriter, r *http.Request) {
 	mType, err := h.getType(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, err)
 		return
 	}
 
@@ -63,7 +86,7 @@ func (h *MetricHandlers) Update(w http.ResponseWriter, r *http.Request) {
 	mValue, err := strconv.ParseFloat(r.PathValue("value"), 64)
 
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidValue, err))
 		return
 	}
 
@@ -81,7 +104,7 @@ func (h *MetricHandlers) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.Storage.Save(r.Context(), metric); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, err)
 		return
 	}
 
@@ -102,23 +125,28 @@ func (h *MetricHandlers) Update(w http.ResponseWriter, r *http.Request) {
 //	@Param		type	path		string	true	"metric type [counter, gauge]"
 //	@Param		name	path		string	true	"metric name"
 //	@Success	200		{string}	number	"metric's value, for example 200.4"
-//	@Failure	400
-//	@Failure	404
-//	@Failure	500
+//	@Failure	400		{object}	Problem
+//	@Failure	404		{object}	Problem
+//	@Failure	500		{object}	Problem
+//	@Failure	503		{object}	Problem
 //	@Router		/value/{type}/{name} [get]
 func (h *MetricHandlers) Find(w http.ResponseWriter, r *http.Request) {
 	mType, err := h.getType(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, err)
 		return
 	}
 
 	metric, err := h.Storage.Find(r.Context(), r.PathValue("name"), mType)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		h.writeProblem(w, r, err)
 		return
 	}
 
+	if h.stale(metric) {
+		w.Header().Set(staleHeader, "true")
+	}
+
 	var value string
 	switch mType {
 	case repository.CounterName:
@@ -143,8 +171,10 @@ func (h *MetricHandlers) Find(w http.ResponseWriter, r *http.Request) {
 //	@Produce	application/json
 //	@Param		metric	body		model.Metric	true	"Metric's data"
 //	@Success	200		{object}	model.Metric	"Metric's data"
-//	@Failure	400
-//	@Failure	500
+//	@Failure	400		{object}	Problem
+//	@Failure	422		{object}	Problem
+//	@Failure	500		{object}	Problem
+//	@Failure	503		{object}	Problem
 //	@Router		/update [post]
 func (h *MetricHandlers) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 	var metric model.Metric
@@ -153,17 +183,17 @@ func (h *MetricHandlers) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-type", "application/json")
 
 	if err := d.Decode(&metric); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidBody, err))
 		return
 	}
 
 	if err := h.checkType(metric.MType); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, err)
 		return
 	}
 
 	if err := h.Storage.Save(r.Context(), metric); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, err)
 		return
 	}
 
@@ -184,9 +214,10 @@ func (h *MetricHandlers) UpdateJSON(w http.ResponseWriter, r *http.Request) {
 //	@Produce	application/json
 //	@Param		metric	body		model.Metric	true	"Metric's data"
 //	@Success	200		{object}	model.Metric	"Metric's data"
-//	@Failure	400
-//	@Failure	404
-//	@Failure	500
+//	@Failure	400		{object}	Problem
+//	@Failure	404		{object}	Problem
+//	@Failure	500		{object}	Problem
+//	@Failure	503		{object}	Problem
 //	@Router		/value/ [post]
 func (h *MetricHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 	var metric model.Metric
@@ -195,21 +226,25 @@ func (h *MetricHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-type", "application/json")
 
 	if err := data.Decode(&metric); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidBody, err))
 		return
 	}
 
 	if err := h.checkType(metric.MType); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, err)
 		return
 	}
 
 	value, err := h.Storage.Find(r.Context(), metric.ID, metric.MType)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		h.writeProblem(w, r, err)
 		return
 	}
 
+	if h.stale(value) {
+		w.Header().Set(staleHeader, "true")
+	}
+
 	resp := json.NewEncoder(w)
 	if err := resp.Encode(value); err != nil {
 		h.log.Error("handler FindJson metric: response writer failed", zap.Error(err))
@@ -218,25 +253,6 @@ func (h *MetricHandlers) FindJSON(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Get godoc
-//
-//	@Tags		Info
-//	@Summary	Get metrics list
-//	@ID			getMetric
-//	@Accept		text/html
-//	@Produce	text/html
-//	@Success	200
-//	@Failure	500
-//	@Router		/ [get]
-func (h *MetricHandlers) Get(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
-	if err := service.ListHTML(w, h.Storage.Get(r.Context())); err != nil {
-		h.log.Error("handler Get failed", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-}
-
 func (h *MetricHandlers) getType(r *http.Request) (string, error) {
 	t := r.PathValue("type")
 	return t, h.checkType(t)
@@ -244,7 +260,7 @@ func (h *MetricHandlers) getType(r *http.Request) (string, error) {
 
 func (h *MetricHandlers) checkType(t string) error {
 	if t != repository.CounterName && t != repository.GaugeName {
-		return errors.New("metric's type is invalid")
+		return fmt.Errorf("%w: %q", errInvalidType, t)
 	}
 
 	return nil
@@ -258,11 +274,12 @@ func (h *MetricHandlers) checkType(t string) error {
 //	@Accept		text/html
 //	@Produce	text/html
 //	@Success	200
-//	@Failure	500
+//	@Failure	500	{object}	Problem
+//	@Failure	503	{object}	Problem
 //	@Router		/ping [get]
 func (h *MetricHandlers) Ping(w http.ResponseWriter, r *http.Request) {
 	if err := h.Storage.Ping(r.Context()); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeProblem(w, r, err)
 		return
 	}
 
@@ -275,27 +292,38 @@ func (h *MetricHandlers) Ping(w http.ResponseWriter, r *http.Request) {
 
 // Updates godoc
 //
-//	@Tags		Update
-//	@Summary	Mass update metrics with json format
-//	@ID			updatesMetric
-//	@Accept		application/json
-//	@Produce	application/json
-//	@Param		metric	body	[]model.Metric	true	"Metric's data"
-//	@Success	200
-//	@Failure	400
-//	@Failure	500
-//	@Router		/updates/ [post]
+//	@Tags			Update
+//	@Summary		Mass update metrics with json format
+//	@ID				updatesMetric
+//	@Accept			application/json
+//	@Produce		application/json
+//	@Description	With partial=true the valid metrics are saved and the status of every metric is returned,
+//	@Description	otherwise the batch is saved as a whole or rejected as a whole.
+//	@Param			metric	body		[]model.Metric		true	"Metric's data"
+//	@Param			partial	query		bool				false	"partial success mode"
+//	@Success		200		{object}	model.BatchResult	"status of every metric in the partial success mode"
+//	@Failure		400		{object}	Problem
+//	@Failure		413		{object}	Problem
+//	@Failure		422		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Failure		503		{object}	Problem
+//	@Router			/updates/ [post]
 func (h *MetricHandlers) Updates(w http.ResponseWriter, r *http.Request) {
 	var metrics []model.Metric
 	d := json.NewDecoder(r.Body)
 
 	if err := d.Decode(&metrics); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, fmt.Errorf("%w: %w", errInvalidBody, err))
+		return
+	}
+
+	if partial, _ := strconv.ParseBool(r.URL.Query().Get("partial")); partial {
+		h.updatesPartial(w, r, metrics)
 		return
 	}
 
 	if err := h.Storage.MassSave(r.Context(), metrics); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.writeProblem(w, r, err)
 		return
 	}
 
@@ -305,3 +333,43 @@ func (h *MetricHandlers) Updates(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (h *MetricHandlers) updatesPartial(w http.ResponseWriter, r *http.Request, metrics []model.Metric) {
+	results, err := repository.MassSavePartial(r.Context(), h.Storage, metrics)
+	if err != nil {
+		h.writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(model.NewBatchResult(results)); err != nil {
+		h.log.Error("handler Updates metrics: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// StatsSnapshot godoc
+//
+//	@Tags		Admin
+//	@Summary	Get request, storage and gRPC latencies of the server
+//	@ID			statsMetric
+//	@Accept		application/json
+//	@Produce	application/json
+//	@Success	200	{object}	stats.Snapshot
+//	@Failure	500	{object}	Problem
+//	@Failure	501	{object}	Problem
+//	@Router		/admin/stats [get]
+func (h *MetricHandlers) StatsSnapshot(w http.ResponseWriter, r *http.Request) {
+	if h.Stats == nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: stats are disabled", errNotImplemented))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.Stats.Snapshot()); err != nil {
+		h.log.Error("handler StatsSnapshot: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/arefev/mtrcstore/internal/server/ingest"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	errInvalidType  = errors.New("metric's type is invalid")
+	errInvalidValue = errors.New("metric's value is invalid")
+	errInvalidBody  = errors.New("request body is invalid")
+	errTooLarge     = errors.New("request body is too large")
+
+	errUnsupportedMedia = errors.New("content type is not supported")
+
+	errNotImplemented = errors.New("not implemented")
+)
+
+// Problem is the error response body in the RFC 9457 problem details format.
+type Problem struct {
+	Type   string             `json:"type"`
+	Title  string             `json:"title"`
+	Detail string             `json:"detail,omitempty"`
+	Code   string             `json:"code"`            // machine readable reason of the error
+	Lines  []ingest.LineError `json:"lines,omitempty"` // rejected lines of a line protocol request
+	Status int                `json:"status"`          // HTTP status code
+}
+
+// linesError carries the rejected lines of a line protocol request to the problem.
+type linesError struct {
+	err   error
+	lines []ingest.LineError
+}
+
+func (e *linesError) Error() string {
+	return e.err.Error()
+}
+
+func (e *linesError) Unwrap() error {
+	return e.err
+}
+
+// problemOf maps the error to the response status and the problem code.
+func problemOf(err error) (int, string) {
+	switch {
+	case errors.Is(err, errInvalidType):
+		return http.StatusBadRequest, "invalid_type"
+	case errors.Is(err, errInvalidValue):
+		return http.StatusBadRequest, "invalid_value"
+	case errors.Is(err, errInvalidBody):
+		return http.StatusBadRequest, "invalid_body"
+	case errors.Is(err, errTooLarge):
+		return http.StatusRequestEntityTooLarge, "body_too_large"
+	case errors.Is(err, errUnsupportedMedia):
+		return http.StatusUnsupportedMediaType, "unsupported_media_type"
+	case errors.Is(err, repository.ErrInvalidName):
+		return http.StatusBadRequest, "invalid_name"
+	case errors.Is(err, repository.ErrInvalid):
+		return http.StatusBadRequest, "invalid_metric"
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound, "not_found"
+	case errors.Is(err, repository.ErrBatchLimit):
+		return http.StatusRequestEntityTooLarge, "batch_limit"
+	case errors.Is(err, repository.ErrSeriesLimit):
+		return http.StatusUnprocessableEntity, "series_limit"
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusServiceUnavailable, "unavailable"
+	case errors.Is(err, errNotImplemented):
+		return http.StatusNotImplemented, "not_implemented"
+	default:
+		return http.StatusInternalServerError, "internal"
+	}
+}
+
+// writeProblem writes the error as a problem details response.
+func (h *MetricHandlers) writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := problemOf(err)
+	if status >= http.StatusInternalServerError {
+		h.log.Error("handler request failed", zap.String("URI", r.RequestURI), zap.Error(err))
+	}
+
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Code:   code,
+	}
+
+	var lErr *linesError
+	if errors.As(err, &lErr) {
+		p.Lines = lErr.lines
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		h.log.Error("handler writeProblem: response writer failed", zap.Error(err))
+	}
+}
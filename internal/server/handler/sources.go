@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.uber.org/zap"
+)
+
+// staleHeader flags the value of a metric nobody wrote for the TTL.
+const staleHeader = "X-Metric-Stale"
+
+// Sources godoc
+//
+//	@Tags			Admin
+//	@Summary		Get clients writing metrics and the time of their last write
+//	@Description	A source is silent when it wrote nothing for the staleness TTL.
+//	@ID				sourcesMetric
+//	@Produce		application/json
+//	@Param			silent	query		bool	false	"list only the silent sources"
+//	@Success		200		{array}		repository.Source
+//	@Failure		500		{object}	Problem
+//	@Failure		501		{object}	Problem
+//	@Router			/admin/sources [get]
+func (h *MetricHandlers) Sources(w http.ResponseWriter, r *http.Request) {
+	sr, ok := repository.As[repository.StaleReporter](h.Storage)
+	if !ok {
+		h.writeProblem(w, r, fmt.Errorf("%w: staleness is not tracked", errNotImplemented))
+		return
+	}
+
+	sources := sr.Sources()
+	if r.URL.Query().Get("silent") == "true" {
+		silent := make([]repository.Source, 0, len(sources))
+		for _, s := range sources {
+			if s.Silent {
+				silent = append(silent, s)
+			}
+		}
+		sources = silent
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sources); err != nil {
+		h.log.Error("handler Sources: response writer failed", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// stale reports whether the metric is stale, it is false when the storage does not track the staleness.
+func (h *MetricHandlers) stale(m model.Metric) bool {
+	sr, ok := repository.As[repository.StaleReporter](h.Storage)
+	return ok && sr.Stale(m.ID, m.MType)
+}
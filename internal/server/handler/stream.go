@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/arefev/mtrcstore/internal/server/stream"
+	"go.uber.org/zap"
+)
+
+// streamHeartbeat keeps the idle stream from being closed by the proxies.
+const streamHeartbeat = 15 * time.Second
+
+// streamSigner is implemented by the writer of the sign middleware when the request is signed,
+// the stream is sent in parts, so every event carries the signature of its data.
+type streamSigner interface {
+	Sign(p []byte) (string, error)
+}
+
+// Stream godoc
+//
+//	@Tags			Info
+//	@Summary		Stream metric updates as server-sent events
+//	@Description	Every saved metric is sent as a "metric" event, the counters carry the increment.
+//	@Description	The number of events lost by a slow client is sent as a "dropped" event.
+//	@ID				streamMetrics
+//	@Produce		text/event-stream
+//	@Param			type	query	string	false	"metric type [counter, gauge]"
+//	@Param			name	query	string	false	"regexp of the metric names"
+//	@Success		200
+//	@Failure		400	{object}	Problem
+//	@Failure		501	{object}	Problem
+//	@Router			/stream [get]
+func (h *MetricHandlers) Stream(w http.ResponseWriter, r *http.Request) {
+	if h.Hub == nil {
+		h.writeProblem(w, r, fmt.Errorf("%w: live stream is disabled", errNotImplemented))
+		return
+	}
+
+	filter := stream.Filter{Type: r.URL.Query().Get("type")}
+	if filter.Type != "" && filter.Type != repository.GaugeName && filter.Type != repository.CounterName {
+		h.writeProblem(w, r, fmt.Errorf("%w: %q", errInvalidType, filter.Type))
+		return
+	}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		pattern, err := regexp.Compile(name)
+		if err != nil {
+			h.writeProblem(w, r, fmt.Errorf("%w: name pattern: %w", errInvalidValue, err))
+			return
+		}
+		filter.Name = pattern
+	}
+
+	sub := h.Hub.Subscribe(filter)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		h.log.Error("handler Stream: flush failed", zap.Error(err))
+		return
+	}
+
+	signer, signed := w.(streamSigner)
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var dropped int64
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case m, ok := <-sub.C:
+			if !ok {
+				return
+			}
+
+			if n := sub.Dropped(); n > dropped {
+				dropped = n
+				_, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", n)
+			}
+			if err == nil {
+				err = writeEvent(w, m, signer, signed)
+			}
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			h.log.Debug("handler Stream: client gone", zap.Error(err))
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, m any, signer streamSigner, signed bool) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal event failed: %w", err)
+	}
+
+	// the field is ignored by the EventSource clients and checked by the signed ones
+	hash := ""
+	if signed {
+		sum, err := signer.Sign(data)
+		if err != nil {
+			return fmt.Errorf("sign event failed: %w", err)
+		}
+		hash = "hash: " + sum + "\n"
+	}
+
+	if _, err := fmt.Fprintf(w, "event: metric\n%sdata: %s\n\n", hash, data); err != nil {
+		return fmt.Errorf("write event failed: %w", err)
+	}
+
+	return nil
+}
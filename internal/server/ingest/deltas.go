@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+)
+
+// deltasIdle is how long the last value of a series is kept without the updates,
+// the series of a source that is gone are forgotten, and its next value becomes the base again.
+const deltasIdle = time.Hour
+
+type cumulative struct {
+	seen  time.Time
+	start uint64
+	value float64
+}
+
+// Deltas turns the cumulative counters of the foreign protocols into the deltas the store adds up.
+// The first value of a series is only the base: after the restart of the server or the expiry of the series
+// the total of the source is already in the store. A new start time or a decrease means the source restarted,
+// and the value is taken as a whole.
+// Only the values of the saved series are kept, so the rejected series do not take the memory.
+type Deltas struct {
+	swept time.Time
+	last  map[string]cumulative
+	now   func() time.Time
+	mutex *sync.Mutex
+	idle  time.Duration
+}
+
+func NewDeltas() *Deltas {
+	return &Deltas{
+		last:  make(map[string]cumulative),
+		now:   time.Now,
+		mutex: &sync.Mutex{},
+		idle:  deltasIdle,
+	}
+}
+
+// Batch computes the deltas of one request. Its values become the base of the next request
+// only when they are committed after the save, so the write that failed is counted again when it is retried.
+// The requests of one series are expected one at a time, as the senders of the cumulative values do.
+type Batch struct {
+	deltas *Deltas
+	next   map[string]cumulative
+}
+
+func (d *Deltas) Batch() *Batch {
+	return &Batch{deltas: d, next: make(map[string]cumulative)}
+}
+
+// Delta returns the increase of the series since the previous value, start is the time the source began counting,
+// zero when the protocol does not tell it. The values are rounded, so the fractions are not lost between the calls.
+func (b *Batch) Delta(series string, start uint64, value float64) int64 {
+	prev, ok := b.next[series]
+	if !ok {
+		prev, ok = b.deltas.get(series)
+	}
+	b.next[series] = cumulative{start: start, value: value}
+
+	if !ok {
+		return 0
+	}
+
+	if prev.start != start || value < prev.value {
+		return int64(math.Round(value))
+	}
+
+	return int64(math.Round(value) - math.Round(prev.value))
+}
+
+// Commit keeps the values of the counters the storage accepted.
+func (b *Batch) Commit(results []model.Result) {
+	d := b.deltas
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
+	for _, r := range results {
+		if r.Status != model.ResultAccepted || r.MType != repository.CounterName {
+			continue
+		}
+
+		if c, ok := b.next[r.ID]; ok {
+			c.seen = now
+			d.last[r.ID] = c
+		}
+	}
+
+	if now.Sub(d.swept) < d.idle {
+		return
+	}
+
+	for series, c := range d.last {
+		if now.Sub(c.seen) >= d.idle {
+			delete(d.last, series)
+		}
+	}
+	d.swept = now
+}
+
+func (d *Deltas) get(series string) (cumulative, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	c, ok := d.last[series]
+	if !ok || d.now().Sub(c.seen) >= d.idle {
+		return cumulative{}, false
+	}
+
+	return c, true
+}
@@ -0,0 +1,83 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+// accept reports every metric as saved by the storage.
+func accept(out []model.Metric) []model.Result {
+	results := make([]model.Result, 0, len(out))
+	for _, m := range out {
+		results = append(results, model.Result{ID: m.ID, MType: m.MType, Status: model.ResultAccepted})
+	}
+
+	return results
+}
+
+func TestDeltas(t *testing.T) {
+	t.Run("values of the failed write are counted again", func(t *testing.T) {
+		d := NewDeltas()
+
+		b := d.Batch()
+		require.Equal(t, int64(0), b.Delta("requests", 0, 10))
+		b.Commit(accept([]model.Metric{counter("requests", 0)}))
+
+		// the save failed, so the batch is not committed and the retry gets the same delta
+		for range 2 {
+			b = d.Batch()
+			require.Equal(t, int64(5), b.Delta("requests", 0, 15))
+		}
+
+		b.Commit([]model.Result{{ID: "requests", MType: repository.CounterName, Status: model.ResultRejected}})
+		require.Equal(t, int64(5), d.Batch().Delta("requests", 0, 15))
+	})
+
+	t.Run("only the accepted series are kept", func(t *testing.T) {
+		d := NewDeltas()
+
+		b := d.Batch()
+		b.Delta("kept", 0, 1)
+		b.Delta("rejected", 0, 1)
+		b.Commit([]model.Result{
+			{ID: "kept", MType: repository.CounterName, Status: model.ResultAccepted},
+			{ID: "rejected", MType: repository.CounterName, Status: model.ResultRejected},
+		})
+
+		require.Len(t, d.last, 1)
+		require.Contains(t, d.last, "kept")
+	})
+
+	t.Run("idle series are forgotten", func(t *testing.T) {
+		now := time.Now()
+		d := NewDeltas()
+		d.now = func() time.Time { return now }
+
+		b := d.Batch()
+		b.Delta("gone", 0, 100)
+		b.Commit(accept([]model.Metric{counter("gone", 100)}))
+
+		now = now.Add(deltasIdle)
+		require.Equal(t, int64(0), d.Batch().Delta("gone", 0, 120), "the idle series starts over from the base")
+
+		b = d.Batch()
+		b.Delta("alive", 0, 1)
+		b.Commit(accept([]model.Metric{counter("alive", 1)}))
+		require.Len(t, d.last, 1)
+		require.Contains(t, d.last, "alive")
+	})
+	t.Run("first value is the base and a restart counts as a whole", func(t *testing.T) {
+		d := NewDeltas()
+
+		b := d.Batch()
+		require.Equal(t, int64(0), b.Delta("requests", 100, 1000), "the total is already in the store")
+		require.Equal(t, int64(5), b.Delta("requests", 100, 1005))
+		require.Equal(t, int64(3), b.Delta("requests", 200, 3), "new start time")
+		require.Equal(t, int64(4), b.Delta("requests", 200, 7))
+		require.Equal(t, int64(2), b.Delta("requests", 200, 2), "decrease")
+	})
+}
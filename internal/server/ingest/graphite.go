@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+var ErrBadRule = errors.New("graphite rule is invalid")
+
+// GraphiteRule renames the paths matching the pattern: a pattern node is either a literal or *,
+// the template takes the nodes caught by the stars as $1, $2 and so on.
+type GraphiteRule struct {
+	template string
+	pattern  []string
+}
+
+// ParseGraphiteRules reads the comma separated pattern=template rules,
+// e.g. "servers.*.cpu.*=cpu.$2.host.$1".
+func ParseGraphiteRules(s string) ([]GraphiteRule, error) {
+	rules := make([]GraphiteRule, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		pattern, template, ok := strings.Cut(item, "=")
+		if !ok || pattern == "" || template == "" {
+			return nil, fmt.Errorf("%w: %q", ErrBadRule, item)
+		}
+
+		rules = append(rules, GraphiteRule{pattern: strings.Split(pattern, "."), template: template})
+	}
+
+	return rules, nil
+}
+
+// apply returns the new name of the path when the rule matches it.
+func (r GraphiteRule) apply(nodes []string) (string, bool) {
+	if len(nodes) != len(r.pattern) {
+		return "", false
+	}
+
+	caught := make([]string, 0)
+	for i, p := range r.pattern {
+		switch p {
+		case "*":
+			caught = append(caught, nodes[i])
+		case nodes[i]:
+		default:
+			return "", false
+		}
+	}
+
+	name := r.template
+	// the higher numbers go first, so $1 does not eat the beginning of $10
+	for i := len(caught); i > 0; i-- {
+		name = strings.ReplaceAll(name, "$"+strconv.Itoa(i), caught[i-1])
+	}
+
+	return name, true
+}
+
+// Graphite converts the plaintext protocol lines "<path> <value> <timestamp>" into gauges.
+// The path is renamed by the first matching rule and kept as it is otherwise,
+// the tags of the "<path>;tag=value" form are folded into the name.
+type Graphite struct {
+	rules []GraphiteRule
+}
+
+func NewGraphite(rules []GraphiteRule) *Graphite {
+	return &Graphite{rules: rules}
+}
+
+// Metric converts a single line, the timestamp is only validated as the storage keeps the latest value.
+func (g *Graphite) Metric(line string) (model.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return model.Metric{}, fmt.Errorf("%w: expected path, value and timestamp", ErrLineSyntax)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return model.Metric{}, fmt.Errorf("%w: value %q", ErrBadFieldValue, fields[1])
+	}
+
+	if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+		return model.Metric{}, fmt.Errorf("%w: timestamp %q", ErrLineSyntax, fields[2])
+	}
+
+	path, rest, _ := strings.Cut(fields[0], ";")
+	if path == "" {
+		return model.Metric{}, fmt.Errorf("%w: empty path", ErrLineSyntax)
+	}
+
+	tags := make(map[string]string)
+	if rest != "" {
+		for _, tag := range strings.Split(rest, ";") {
+			k, v, ok := strings.Cut(tag, "=")
+			if !ok || k == "" || v == "" {
+				return model.Metric{}, fmt.Errorf("%w: tag %q", ErrLineSyntax, tag)
+			}
+			tags[k] = v
+		}
+	}
+
+	return gauge(SeriesName(g.name(path), tags), value), nil
+}
+
+func (g *Graphite) name(path string) string {
+	nodes := strings.Split(path, ".")
+	for _, r := range g.rules {
+		if name, ok := r.apply(nodes); ok {
+			return name
+		}
+	}
+
+	return path
+}
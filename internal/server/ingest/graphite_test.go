@@ -0,0 +1,52 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphiteMetric(t *testing.T) {
+	rules, err := ParseGraphiteRules("servers.*.cpu.*=cpu.$2.host.$1, servers.*.mem=mem.host.$1")
+	require.NoError(t, err)
+	g := NewGraphite(rules)
+
+	tests := []struct {
+		name string
+		line string
+		want string
+		err  error
+	}{
+		{name: "rule with two nodes", line: "servers.web1.cpu.idle 97.5 1700000000", want: "cpu.idle.host.web1"},
+		{name: "second rule", line: "servers.web1.mem 1024 1700000000", want: "mem.host.web1"},
+		{name: "no rule", line: "servers.web1.disk.used 3 -1", want: "servers.web1.disk.used"},
+		{name: "tags", line: "load;host=web1;dc=eu 0.5 1700000000", want: "load.dc.eu.host.web1"},
+		{name: "bad value", line: "load abc 1700000000", err: ErrBadFieldValue},
+		{name: "no timestamp", line: "load 1", err: ErrLineSyntax},
+		{name: "bad tag", line: "load;host 1 1700000000", err: ErrLineSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := g.Metric(tt.line)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, m.ID)
+			require.Equal(t, repository.GaugeName, m.MType)
+		})
+	}
+}
+
+func TestParseGraphiteRules(t *testing.T) {
+	rules, err := ParseGraphiteRules("")
+	require.NoError(t, err)
+	require.Empty(t, rules)
+
+	_, err = ParseGraphiteRules("servers.*.cpu")
+	require.ErrorIs(t, err, ErrBadRule)
+}
@@ -0,0 +1,271 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+var (
+	ErrLineSyntax     = errors.New("line protocol syntax error")
+	ErrNoFields       = errors.New("line has no numeric fields")
+	ErrBadPrecision   = errors.New("unknown timestamp precision")
+	ErrBadFieldValue  = errors.New("field value is invalid")
+	errUnquotedString = errors.New("string field is not closed")
+)
+
+// The kinds of the counters the integer fields are taken as, the integers are gauges when none is asked for.
+const (
+	CountersCumulative = "cumulative"
+	CountersDelta      = "delta"
+)
+
+// LineError reports a line of the request that was not saved, the lines are counted from 1.
+type LineError struct {
+	Error string `json:"error"`
+	Line  int    `json:"line"`
+}
+
+// Influx converts the InfluxDB line protocol. Every numeric field becomes the <measurement>.<field> metric
+// with the tags folded into the name: floats, integers and booleans become gauges.
+// The integers become counters only when the request asks for the cumulative or the delta ones.
+// The string fields are skipped.
+type Influx struct {
+	deltas *Deltas
+}
+
+func NewInflux() *Influx {
+	return &Influx{deltas: NewDeltas()}
+}
+
+// point is a parsed line, the integers are kept apart until the kind of the counters is known.
+type point struct {
+	fields    []field
+	timestamp int64
+	line      int
+}
+
+type field struct {
+	name    string
+	value   float64
+	integer int64
+	isInt   bool
+}
+
+// Metrics parses the body, lines holds the line of every metric, so the storage rejections can be reported by line.
+// The storage keeps the latest value, so the points are ordered by their timestamps,
+// and the newest one of a series is applied last. A line without the timestamp is taken at the time of the request.
+// The batch of the cumulative values is committed with the results of the save.
+func (in *Influx) Metrics(body []byte, precision, counters string) ([]model.Metric, []int, []LineError, *Batch) {
+	points := make([]point, 0)
+	errs := make([]LineError, 0)
+	now := time.Now().UnixNano() / int64(precisionUnit(precision))
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(body)+1)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		p, err := parseLine(text, now)
+		if err != nil {
+			errs = append(errs, LineError{Line: n, Error: err.Error()})
+			continue
+		}
+		p.line = n
+		points = append(points, p)
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].timestamp < points[j].timestamp })
+
+	out := make([]model.Metric, 0)
+	lines := make([]int, 0)
+	batch := in.deltas.Batch()
+	for _, p := range points {
+		for _, f := range p.fields {
+			out = append(out, f.metric(batch, counters))
+			lines = append(lines, p.line)
+		}
+	}
+
+	return out, lines, errs, batch
+}
+
+func (f field) metric(b *Batch, counters string) model.Metric {
+	switch {
+	case !f.isInt:
+		return gauge(f.name, f.value)
+	case counters == CountersDelta:
+		return counter(f.name, f.integer)
+	case counters == CountersCumulative:
+		return counter(f.name, b.Delta(f.name, 0, float64(f.integer)))
+	default:
+		return gauge(f.name, float64(f.integer))
+	}
+}
+
+// parseLine parses a line, now is the timestamp of the line that has none.
+func parseLine(text string, now int64) (point, error) {
+	key, rest, ok := cut(text, ' ')
+	if !ok || key == "" {
+		return point{}, fmt.Errorf("%w: no fields", ErrLineSyntax)
+	}
+
+	p := point{timestamp: now}
+	fieldSet, timestamp, _ := cut(rest, ' ')
+	if timestamp = strings.TrimSpace(timestamp); timestamp != "" {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return point{}, fmt.Errorf("%w: timestamp %q", ErrLineSyntax, timestamp)
+		}
+		p.timestamp = ts
+	}
+
+	parts := split(key, ',')
+	measurement := unescape(parts[0])
+	tags := make(map[string]string, len(parts)-1)
+	for _, tag := range parts[1:] {
+		k, v, ok := cut(tag, '=')
+		if !ok || k == "" || v == "" {
+			return point{}, fmt.Errorf("%w: tag %q", ErrLineSyntax, tag)
+		}
+		tags[unescape(k)] = unescape(v)
+	}
+
+	for _, kv := range split(fieldSet, ',') {
+		k, v, ok := cut(kv, '=')
+		if !ok || k == "" || v == "" {
+			return point{}, fmt.Errorf("%w: field %q", ErrLineSyntax, kv)
+		}
+
+		f, skip, err := parseField(SeriesName(measurement+"."+unescape(k), tags), v)
+		if err != nil {
+			return point{}, fmt.Errorf("%w: field %q: %w", ErrBadFieldValue, unescape(k), err)
+		}
+		if !skip {
+			p.fields = append(p.fields, f)
+		}
+	}
+
+	if len(p.fields) == 0 {
+		return point{}, ErrNoFields
+	}
+
+	return p, nil
+}
+
+// parseField parses the value of a field, the string values are skipped.
+func parseField(name, value string) (field, bool, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return field{}, false, errUnquotedString
+		}
+		return field{}, true, nil
+	case strings.HasSuffix(value, "i"), strings.HasSuffix(value, "u"):
+		n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err == nil && n < 0 && strings.HasSuffix(value, "u") {
+			err = strconv.ErrSyntax
+		}
+		if err != nil {
+			return field{}, false, fmt.Errorf("parse integer: %w", err)
+		}
+		return field{name: name, integer: n, isInt: true}, false, nil
+	}
+
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return field{name: name, value: 1}, false, nil
+	case "f", "F", "false", "False", "FALSE":
+		return field{name: name, value: 0}, false, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return field{}, false, fmt.Errorf("parse float: %w", err)
+	}
+
+	return field{name: name, value: f}, false, nil
+}
+
+// CheckPrecision validates the precision parameter of the write request, both v1 and v2 units are accepted.
+func CheckPrecision(precision string) error {
+	switch precision {
+	case "", "ns", "n", "us", "u", "ms", "s", "m", "h":
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrBadPrecision, precision)
+	}
+}
+
+// precisionUnit returns the unit of the timestamps, the precision is checked before.
+func precisionUnit(precision string) time.Duration {
+	switch precision {
+	case "us", "u":
+		return time.Microsecond
+	case "ms":
+		return time.Millisecond
+	case "s":
+		return time.Second
+	case "m":
+		return time.Minute
+	case "h":
+		return time.Hour
+	default:
+		return time.Nanosecond
+	}
+}
+
+// cut splits s around the first separator that is not escaped and not inside a quoted string.
+func cut(s string, sep byte) (string, string, bool) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return s[:i], s[i+1:], true
+		}
+	}
+
+	return s, "", false
+}
+
+func split(s string, sep byte) []string {
+	parts := make([]string, 0)
+	for {
+		part, rest, ok := cut(s, sep)
+		parts = append(parts, part)
+		if !ok {
+			return parts
+		}
+		s = rest
+	}
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfluxMetrics(t *testing.T) {
+	t.Run("fields become metrics", func(t *testing.T) {
+		body := []byte("# comment\n\ncpu,host=a,region=eu usage=0.5,busy=true,name=\"core 1\",ctx=10i 1700000000000000000\n")
+		out, lines, errs, _ := NewInflux().Metrics(body, "", "")
+		require.Empty(t, errs)
+		require.Len(t, out, 3)
+		require.Equal(t, []int{3, 3, 3}, lines)
+
+		require.Equal(t, "cpu.usage.host.a.region.eu", out[0].ID)
+		require.Equal(t, repository.GaugeName, out[0].MType)
+		require.InDelta(t, 0.5, *out[0].Value, 1e-9)
+
+		require.Equal(t, "cpu.busy.host.a.region.eu", out[1].ID)
+		require.InDelta(t, 1, *out[1].Value, 1e-9)
+
+		require.Equal(t, "cpu.ctx.host.a.region.eu", out[2].ID)
+		require.Equal(t, repository.GaugeName, out[2].MType)
+		require.InDelta(t, 10, *out[2].Value, 1e-9)
+	})
+
+	t.Run("cumulative integers send the increase", func(t *testing.T) {
+		in := NewInflux()
+
+		out, _, errs, batch := in.Metrics([]byte("net bytes=100i\nnet bytes=150i"), "", CountersCumulative)
+		require.Empty(t, errs)
+		require.Equal(t, repository.CounterName, out[0].MType)
+		require.Equal(t, int64(0), *out[0].Delta)
+		require.Equal(t, int64(50), *out[1].Delta)
+		batch.Commit(accept(out))
+
+		out, _, _, _ = in.Metrics([]byte("net bytes=170i"), "", CountersCumulative)
+		require.Equal(t, int64(20), *out[0].Delta)
+
+		out, _, _, _ = in.Metrics([]byte("net bytes=7i"), "", CountersDelta)
+		require.Equal(t, int64(7), *out[0].Delta)
+	})
+
+	t.Run("points are ordered by timestamp", func(t *testing.T) {
+		body := []byte("cpu usage=0.9 1700000002\ncpu usage=0.1 1700000001\ncpu usage=0.5")
+		out, lines, errs, _ := NewInflux().Metrics(body, "s", "")
+		require.Empty(t, errs)
+		require.Equal(t, []int{2, 1, 3}, lines)
+		require.InDelta(t, 0.5, *out[2].Value, 1e-9)
+
+		out, lines, errs, _ = NewInflux().Metrics([]byte("net bytes=150i 20\nnet bytes=100i 10"), "", CountersCumulative)
+		require.Empty(t, errs)
+		require.Equal(t, []int{2, 1}, lines)
+		require.Equal(t, int64(0), *out[0].Delta)
+		require.Equal(t, int64(50), *out[1].Delta)
+	})
+
+	t.Run("escaped characters", func(t *testing.T) {
+		out, _, errs, _ := NewInflux().Metrics([]byte(`disk\ io,path=/var\,log value=1`), "", "")
+		require.Empty(t, errs)
+		require.Equal(t, "disk_io.value.path._var_log", out[0].ID)
+	})
+
+	t.Run("errors are reported by line", func(t *testing.T) {
+		body := []byte("ok value=1\nnofields\nbad value=abc\nstr name=\"x\"\nts value=1 noon\ntag,host value=1")
+		out, lines, errs, _ := NewInflux().Metrics(body, "", "")
+		require.Len(t, out, 1)
+		require.Equal(t, []int{1}, lines)
+		require.Len(t, errs, 5)
+
+		got := make([]int, 0, len(errs))
+		for _, e := range errs {
+			got = append(got, e.Line)
+		}
+		require.Equal(t, []int{2, 3, 4, 5, 6}, got)
+	})
+}
+
+func TestCheckPrecision(t *testing.T) {
+	for _, p := range []string{"", "ns", "us", "ms", "s", "m", "h"} {
+		require.NoError(t, CheckPrecision(p))
+	}
+	require.ErrorIs(t, CheckPrecision("d"), ErrBadPrecision)
+}
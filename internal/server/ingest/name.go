@@ -0,0 +1,40 @@
+// The ingest package converts the metrics of the foreign protocols into the metrics of the store.
+package ingest
+
+import (
+	"sort"
+	"strings"
+)
+
+// SeriesName folds the labels into the metric name as sorted ".key.value" pairs,
+// the store keeps a metric by its name only, so every label set becomes a series of its own.
+// The characters the default name pattern does not allow are replaced with "_".
+func SeriesName(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(sanitize(name))
+	for _, key := range keys {
+		b.WriteString(".")
+		b.WriteString(sanitize(key))
+		b.WriteString(".")
+		b.WriteString(sanitize(labels[key]))
+	}
+
+	return b.String()
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == ':', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
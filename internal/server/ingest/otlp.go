@@ -0,0 +1,234 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+var ErrUnsupported = errors.New("metric kind is not supported")
+
+// OTLP converts the OpenTelemetry metric exports:
+// Sum becomes a counter when monotonic and a gauge otherwise, Gauge becomes a gauge,
+// Histogram becomes the <name>.count counter, the <name>.sum gauge and the <name>.bucket.le.<bound> counters.
+type OTLP struct {
+	deltas *Deltas
+}
+
+func NewOTLP() *OTLP {
+	return &OTLP{deltas: NewDeltas()}
+}
+
+// Rejection is a data point that could not be converted.
+type Rejection struct {
+	Err  error
+	Name string
+}
+
+// Export saves the converted metrics in the partial success mode, the points that were rejected
+// by the conversion or by the storage are counted in the partial success of the response.
+func (o *OTLP) Export(
+	ctx context.Context,
+	s repository.Storage,
+	req *colmetrics.ExportMetricsServiceRequest,
+) (*colmetrics.ExportMetricsServiceResponse, error) {
+	elems, rejections, batch := o.Metrics(req)
+
+	results, err := repository.MassSavePartial(ctx, s, elems)
+	if err != nil {
+		return nil, fmt.Errorf("otlp export failed: %w", err)
+	}
+	batch.Commit(results)
+
+	for _, r := range results {
+		if r.Status == model.ResultRejected {
+			rejections = append(rejections, Rejection{Name: r.ID, Err: errors.New(r.Reason)})
+		}
+	}
+
+	resp := &colmetrics.ExportMetricsServiceResponse{}
+	if len(rejections) > 0 {
+		resp.PartialSuccess = &colmetrics.ExportMetricsPartialSuccess{
+			RejectedDataPoints: int64(len(rejections)),
+			ErrorMessage:       fmt.Sprintf("%s: %s", rejections[0].Name, rejections[0].Err.Error()),
+		}
+	}
+
+	return resp, nil
+}
+
+// Metrics converts the export, the points of the unsupported kinds are returned as rejections.
+// The batch of the cumulative values is committed with the results of the save.
+func (o *OTLP) Metrics(req *colmetrics.ExportMetricsServiceRequest) ([]model.Metric, []Rejection, *Batch) {
+	out := make([]model.Metric, 0)
+	rejections := make([]Rejection, 0)
+	batch := o.deltas.Batch()
+
+	for _, rm := range req.GetResourceMetrics() {
+		resource := attributes(rm.GetResource().GetAttributes())
+		service, ok := resource["service.name"]
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				base := map[string]string{}
+				if ok {
+					base["service.name"] = service
+				}
+
+				converted, n := o.metric(batch, m, base)
+				out = append(out, converted...)
+				for range n {
+					rejections = append(rejections, Rejection{
+						Name: m.GetName(),
+						Err:  fmt.Errorf("%w: %s", ErrUnsupported, kind(m)),
+					})
+				}
+			}
+		}
+	}
+
+	return out, rejections, batch
+}
+
+// metric converts the data points of one metric, the number of the points left out is returned.
+func (o *OTLP) metric(b *Batch, m *metrics.Metric, base map[string]string) ([]model.Metric, int) {
+	out := make([]model.Metric, 0)
+
+	switch data := m.GetData().(type) {
+	case *metrics.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			out = append(out, gauge(SeriesName(m.GetName(), labels(base, p.GetAttributes())), number(p)))
+		}
+	case *metrics.Metric_Sum:
+		sum := data.Sum
+		for _, p := range sum.GetDataPoints() {
+			name := SeriesName(m.GetName(), labels(base, p.GetAttributes()))
+			if !sum.GetIsMonotonic() {
+				out = append(out, gauge(name, number(p)))
+				continue
+			}
+			out = append(out, counter(name, o.delta(b, name, sum.GetAggregationTemporality(), p.GetStartTimeUnixNano(), number(p))))
+		}
+	case *metrics.Metric_Histogram:
+		h := data.Histogram
+		for _, p := range h.GetDataPoints() {
+			out = append(out, o.histogram(b, m.GetName(), h.GetAggregationTemporality(), labels(base, p.GetAttributes()), p)...)
+		}
+	case *metrics.Metric_ExponentialHistogram:
+		return out, len(data.ExponentialHistogram.GetDataPoints())
+	case *metrics.Metric_Summary:
+		return out, len(data.Summary.GetDataPoints())
+	default:
+		return out, 1
+	}
+
+	return out, 0
+}
+
+func (o *OTLP) histogram(
+	b *Batch,
+	name string,
+	temporality metrics.AggregationTemporality,
+	l map[string]string,
+	p *metrics.HistogramDataPoint,
+) []model.Metric {
+	start := p.GetStartTimeUnixNano()
+	count := SeriesName(name+".count", l)
+	out := []model.Metric{
+		counter(count, o.delta(b, count, temporality, start, float64(p.GetCount()))),
+		gauge(SeriesName(name+".sum", l), p.GetSum()),
+	}
+
+	bounds := p.GetExplicitBounds()
+	for i, n := range p.GetBucketCounts() {
+		le := "+Inf"
+		if i < len(bounds) {
+			le = strconv.FormatFloat(bounds[i], 'f', -1, 64)
+		}
+
+		bucket := SeriesName(name+".bucket.le."+le, l)
+		out = append(out, counter(bucket, o.delta(b, bucket, temporality, start, float64(n))))
+	}
+
+	return out
+}
+
+// delta takes the delta points as they are and converts the cumulative ones.
+func (o *OTLP) delta(b *Batch, series string, temporality metrics.AggregationTemporality, start uint64, value float64) int64 {
+	if temporality == metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		return int64(math.Round(value))
+	}
+
+	return b.Delta(series, start, value)
+}
+
+func number(p *metrics.NumberDataPoint) float64 {
+	if v, ok := p.GetValue().(*metrics.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+
+	return p.GetAsDouble()
+}
+
+func labels(base map[string]string, attrs []*common.KeyValue) map[string]string {
+	l := make(map[string]string, len(base)+len(attrs))
+	for k, v := range base {
+		l[k] = v
+	}
+	for k, v := range attributes(attrs) {
+		l[k] = v
+	}
+
+	return l
+}
+
+func attributes(attrs []*common.KeyValue) map[string]string {
+	out := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		out[kv.GetKey()] = anyValue(kv.GetValue())
+	}
+
+	return out
+}
+
+func anyValue(v *common.AnyValue) string {
+	switch value := v.GetValue().(type) {
+	case *common.AnyValue_StringValue:
+		return value.StringValue
+	case *common.AnyValue_IntValue:
+		return strconv.FormatInt(value.IntValue, 10)
+	case *common.AnyValue_DoubleValue:
+		return strconv.FormatFloat(value.DoubleValue, 'f', -1, 64)
+	case *common.AnyValue_BoolValue:
+		return strconv.FormatBool(value.BoolValue)
+	default:
+		return ""
+	}
+}
+
+func kind(m *metrics.Metric) string {
+	switch m.GetData().(type) {
+	case *metrics.Metric_ExponentialHistogram:
+		return "exponential histogram"
+	case *metrics.Metric_Summary:
+		return "summary"
+	default:
+		return "empty"
+	}
+}
+
+func gauge(name string, value float64) model.Metric {
+	return model.Metric{ID: name, MType: repository.GaugeName, Value: &value}
+}
+
+func counter(name string, delta int64) model.Metric {
+	return model.Metric{ID: name, MType: repository.CounterName, Delta: &delta}
+}
@@ -0,0 +1,169 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/stretchr/testify/require"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resource "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func export(ms ...*metrics.Metric) *colmetrics.ExportMetricsServiceRequest {
+	return &colmetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metrics.ResourceMetrics{{
+			Resource: &resource.Resource{Attributes: []*common.KeyValue{
+				{Key: "service.name", Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "api"}}},
+				{Key: "host.name", Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "web-1"}}},
+			}},
+			ScopeMetrics: []*metrics.ScopeMetrics{{Metrics: ms}},
+		}},
+	}
+}
+
+func sum(name string, temporality metrics.AggregationTemporality, monotonic bool, value int64) *metrics.Metric {
+	return &metrics.Metric{
+		Name: name,
+		Data: &metrics.Metric_Sum{Sum: &metrics.Sum{
+			AggregationTemporality: temporality,
+			IsMonotonic:            monotonic,
+			DataPoints: []*metrics.NumberDataPoint{{
+				StartTimeUnixNano: 1,
+				Value:             &metrics.NumberDataPoint_AsInt{AsInt: value},
+			}},
+		}},
+	}
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	t.Run("gauge keeps the value and the attributes", func(t *testing.T) {
+		o := NewOTLP()
+		out, rejections, _ := o.Metrics(export(&metrics.Metric{
+			Name: "heap",
+			Data: &metrics.Metric_Gauge{Gauge: &metrics.Gauge{DataPoints: []*metrics.NumberDataPoint{{
+				Attributes: []*common.KeyValue{
+					{Key: "pool", Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: "eden space"}}},
+				},
+				Value: &metrics.NumberDataPoint_AsDouble{AsDouble: 1.5},
+			}}}},
+		}))
+		require.Empty(t, rejections)
+		require.Len(t, out, 1)
+		require.Equal(t, "heap.pool.eden_space.service.name.api", out[0].ID)
+		require.Equal(t, repository.GaugeName, out[0].MType)
+		require.InDelta(t, 1.5, *out[0].Value, 1e-9)
+	})
+
+	t.Run("cumulative sum is sent as the increase", func(t *testing.T) {
+		o := NewOTLP()
+		cumulative := metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+		out, _, batch := o.Metrics(export(sum("requests", cumulative, true, 10)))
+		require.Equal(t, repository.CounterName, out[0].MType)
+		require.Equal(t, int64(0), *out[0].Delta, "the first value is the base")
+		batch.Commit(accept(out))
+
+		out, _, batch = o.Metrics(export(sum("requests", cumulative, true, 15)))
+		require.Equal(t, int64(5), *out[0].Delta)
+		batch.Commit(accept(out))
+
+		out, _, _ = o.Metrics(export(sum("requests", cumulative, true, 3)))
+		require.Equal(t, int64(3), *out[0].Delta, "a decrease means the source restarted")
+	})
+
+	t.Run("delta sum is sent as it is", func(t *testing.T) {
+		o := NewOTLP()
+		delta := metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+		for range 2 {
+			out, _, _ := o.Metrics(export(sum("requests", delta, true, 4)))
+			require.Equal(t, int64(4), *out[0].Delta)
+		}
+
+		double := sum("requests", delta, true, 0)
+		points := double.GetSum().GetDataPoints()
+		points[0].Value = &metrics.NumberDataPoint_AsDouble{AsDouble: 0.9}
+		points = append(points, &metrics.NumberDataPoint{StartTimeUnixNano: 1, Value: &metrics.NumberDataPoint_AsDouble{AsDouble: 2.5}})
+		double.GetSum().DataPoints = points
+
+		out, _, _ := o.Metrics(export(double))
+		require.Equal(t, int64(1), *out[0].Delta, "the fractions are rounded as the cumulative ones")
+		require.Equal(t, int64(3), *out[1].Delta)
+	})
+
+	t.Run("non-monotonic sum becomes a gauge", func(t *testing.T) {
+		o := NewOTLP()
+		out, _, _ := o.Metrics(export(sum("queue", metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, false, -2)))
+		require.Equal(t, repository.GaugeName, out[0].MType)
+		require.InDelta(t, -2, *out[0].Value, 1e-9)
+	})
+
+	t.Run("histogram is split into count, sum and buckets", func(t *testing.T) {
+		o := NewOTLP()
+		out, rejections, _ := o.Metrics(export(&metrics.Metric{
+			Name: "latency",
+			Data: &metrics.Metric_Histogram{Histogram: &metrics.Histogram{
+				AggregationTemporality: metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints: []*metrics.HistogramDataPoint{{
+					Count:          3,
+					Sum:            func() *float64 { v := 0.7; return &v }(),
+					BucketCounts:   []uint64{1, 2},
+					ExplicitBounds: []float64{0.1},
+				}},
+			}},
+		}))
+		require.Empty(t, rejections)
+
+		byName := make(map[string]int64)
+		for _, m := range out {
+			if m.Delta != nil {
+				byName[m.ID] = *m.Delta
+			}
+		}
+		require.Equal(t, map[string]int64{
+			"latency.count.service.name.api":          3,
+			"latency.bucket.le.0.1.service.name.api":  1,
+			"latency.bucket.le._Inf.service.name.api": 2,
+		}, byName)
+	})
+
+	t.Run("summary is rejected", func(t *testing.T) {
+		o := NewOTLP()
+		out, rejections, _ := o.Metrics(export(&metrics.Metric{
+			Name: "rpc",
+			Data: &metrics.Metric_Summary{Summary: &metrics.Summary{
+				DataPoints: []*metrics.SummaryDataPoint{{Count: 1}},
+			}},
+		}))
+		require.Empty(t, out)
+		require.Len(t, rejections, 1)
+		require.ErrorIs(t, rejections[0].Err, ErrUnsupported)
+	})
+}
+
+func TestOTLPExport(t *testing.T) {
+	t.Run("export counts rejected points", func(t *testing.T) {
+		ctx := context.Background()
+		s, err := repository.NewLimited(ctx, repository.NewMemory(), repository.Limits{MaxNameLength: 40})
+		require.NoError(t, err)
+
+		resp, err := NewOTLP().Export(ctx, s, export(
+			sum("requests", metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, 1),
+			sum("a_very_long_metric_name_over_the_limit", metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, 1),
+		))
+		require.NoError(t, err)
+		require.Equal(t, int64(1), resp.GetPartialSuccess().GetRejectedDataPoints())
+
+		m, err := s.Find(ctx, "requests.service.name.api", repository.CounterName)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), *m.Delta)
+	})
+}
+
+func TestSeriesName(t *testing.T) {
+	require.Equal(t, "cpu", SeriesName("cpu", nil))
+	require.Equal(t, "cpu.core.0.host.a_b", SeriesName("cpu", map[string]string{"host": "a/b", "core": "0"}))
+}
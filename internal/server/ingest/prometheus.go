@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/arefev/mtrcstore/internal/proto/prompb"
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+var ErrNoName = errors.New("series has no __name__ label")
+
+const nameLabel = "__name__"
+
+// Prometheus converts the remote_write requests. The series of the counter families,
+// the ones named *_total and the _bucket and _count series of histograms and summaries become counters
+// fed by the increase of their cumulative values, the rest become gauges with the latest sample.
+type Prometheus struct {
+	deltas *Deltas
+}
+
+func NewPrometheus() *Prometheus {
+	return &Prometheus{deltas: NewDeltas()}
+}
+
+// Metrics converts the request, the series without a name are returned as rejections.
+// The batch of the cumulative values is committed with the results of the save.
+func (p *Prometheus) Metrics(req *prompb.WriteRequest) ([]model.Metric, []Rejection, *Batch) {
+	families := make(map[string]prompb.MetricMetadata_MetricType, len(req.GetMetadata()))
+	for _, md := range req.GetMetadata() {
+		families[md.GetMetricFamilyName()] = md.GetType()
+	}
+
+	out := make([]model.Metric, 0, len(req.GetTimeseries()))
+	rejections := make([]Rejection, 0)
+	batch := p.deltas.Batch()
+
+	for _, ts := range req.GetTimeseries() {
+		name, l := seriesLabels(ts.GetLabels())
+		if name == "" {
+			rejections = append(rejections, Rejection{Name: SeriesName("", l), Err: ErrNoName})
+			continue
+		}
+
+		samples := ts.GetSamples()
+		if len(samples) == 0 {
+			continue
+		}
+
+		// the samples of one series may come out of order in a single request
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].GetTimestamp() < samples[j].GetTimestamp()
+		})
+
+		series := SeriesName(name, l)
+		if !isCounter(name, families) {
+			out = append(out, gauge(series, samples[len(samples)-1].GetValue()))
+			continue
+		}
+
+		var delta int64
+		for _, s := range samples {
+			delta += batch.Delta(series, 0, s.GetValue())
+		}
+		out = append(out, counter(series, delta))
+	}
+
+	return out, rejections, batch
+}
+
+func seriesLabels(labels []*prompb.Label) (string, map[string]string) {
+	var name string
+	l := make(map[string]string, len(labels))
+	for _, label := range labels {
+		if label.GetName() == nameLabel {
+			name = label.GetValue()
+			continue
+		}
+		l[label.GetName()] = label.GetValue()
+	}
+
+	return name, l
+}
+
+func isCounter(name string, families map[string]prompb.MetricMetadata_MetricType) bool {
+	if families[name] == prompb.MetricMetadata_COUNTER || strings.HasSuffix(name, "_total") {
+		return true
+	}
+
+	for _, suffix := range []string{"_bucket", "_count"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+
+		switch families[family] {
+		case prompb.MetricMetadata_HISTOGRAM, prompb.MetricMetadata_SUMMARY:
+			return true
+		default:
+			// without the metadata the classic histogram buckets are still recognized by their suffix
+			return suffix == "_bucket"
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/proto/prompb"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func series(name string, samples ...float64) *prompb.TimeSeries {
+	ts := &prompb.TimeSeries{Labels: []*prompb.Label{
+		{Name: "__name__", Value: name},
+		{Name: "job", Value: "node"},
+	}}
+	for i, v := range samples {
+		ts.Samples = append(ts.Samples, &prompb.Sample{Value: v, Timestamp: int64(i)})
+	}
+
+	return ts
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	t.Run("gauge takes the latest sample", func(t *testing.T) {
+		out, rejections, _ := NewPrometheus().Metrics(&prompb.WriteRequest{
+			Timeseries: []*prompb.TimeSeries{series("node_load1", 1, 3, 2)},
+		})
+		require.Empty(t, rejections)
+		require.Len(t, out, 1)
+		require.Equal(t, "node_load1.job.node", out[0].ID)
+		require.Equal(t, repository.GaugeName, out[0].MType)
+		require.InDelta(t, 2, *out[0].Value, 1e-9)
+	})
+
+	t.Run("counter sends the increase", func(t *testing.T) {
+		p := NewPrometheus()
+
+		out, _, batch := p.Metrics(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{series("http_requests_total", 5, 8)}})
+		require.Equal(t, repository.CounterName, out[0].MType)
+		require.Equal(t, int64(3), *out[0].Delta, "the first sample is the base")
+		batch.Commit(accept(out))
+
+		out, _, _ = p.Metrics(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{series("http_requests_total", 10)}})
+		require.Equal(t, int64(2), *out[0].Delta)
+	})
+
+	t.Run("metadata decides the type", func(t *testing.T) {
+		out, _, _ := NewPrometheus().Metrics(&prompb.WriteRequest{
+			Timeseries: []*prompb.TimeSeries{series("rpc_count", 4), series("rpc_sum", 1.5), series("errors", 2)},
+			Metadata: []*prompb.MetricMetadata{
+				{Type: prompb.MetricMetadata_SUMMARY, MetricFamilyName: "rpc"},
+				{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "errors"},
+			},
+		})
+		require.Len(t, out, 3)
+		require.Equal(t, repository.CounterName, out[0].MType)
+		require.Equal(t, repository.GaugeName, out[1].MType)
+		require.Equal(t, repository.CounterName, out[2].MType)
+	})
+
+	t.Run("series without name is rejected", func(t *testing.T) {
+		out, rejections, _ := NewPrometheus().Metrics(&prompb.WriteRequest{
+			Timeseries: []*prompb.TimeSeries{{
+				Labels:  []*prompb.Label{{Name: "job", Value: "node"}},
+				Samples: []*prompb.Sample{{Value: 1}},
+			}},
+		})
+		require.Empty(t, out)
+		require.Len(t, rejections, 1)
+		require.ErrorIs(t, rejections[0].Err, ErrNoName)
+	})
+}
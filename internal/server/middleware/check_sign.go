@@ -12,26 +12,41 @@ import (
 	"go.uber.org/zap"
 )
 
+// signWriter keeps the response until the handler is done,
+// so the HashSHA256 header covers the whole body and is sent before it.
+// A streamed response can not be signed as a whole: once the handler flushes,
+// the body is sent as it is written and the handler signs its parts with Sign.
 type signWriter struct {
 	http.ResponseWriter
+	body      *bytes.Buffer
 	secretKey []byte
+	status    int
+	streaming bool
 }
 
 func NewSignWriter(w http.ResponseWriter, secretKey []byte) *signWriter {
 	return &signWriter{
 		ResponseWriter: w,
 		secretKey:      secretKey,
+		body:           bytes.NewBuffer(nil),
+		status:         http.StatusOK,
 	}
 }
 
+func (s *signWriter) WriteHeader(statusCode int) {
+	s.status = statusCode
+}
+
 func (s *signWriter) Write(p []byte) (int, error) {
-	hash, err := sign(s.secretKey, p)
-	if err != nil {
-		return 0, fmt.Errorf("write failed: %w", err)
+	if s.streaming {
+		n, err := s.ResponseWriter.Write(p)
+		if err != nil {
+			return n, fmt.Errorf("write failed: %w", err)
+		}
+		return n, nil
 	}
 
-	s.Header().Add("HashSHA256", hex.EncodeToString(hash))
-	n, err := s.ResponseWriter.Write(p)
+	n, err := s.body.Write(p)
 	if err != nil {
 		return 0, fmt.Errorf("write failed: %w", err)
 	}
@@ -39,6 +54,54 @@ func (s *signWriter) Write(p []byte) (int, error) {
 	return n, nil
 }
 
+// Sign returns the hex encoded HMAC of the part of a streamed response.
+func (s *signWriter) Sign(p []byte) (string, error) {
+	hash, err := sign(s.secretKey, p)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+// FlushError switches the writer to streaming, the kept body is sent unsigned.
+func (s *signWriter) FlushError() error {
+	if !s.streaming {
+		s.streaming = true
+		s.ResponseWriter.WriteHeader(s.status)
+		if _, err := s.ResponseWriter.Write(s.body.Bytes()); err != nil {
+			return fmt.Errorf("flush failed: %w", err)
+		}
+		s.body.Reset()
+	}
+
+	if err := http.NewResponseController(s.ResponseWriter).Flush(); err != nil {
+		return fmt.Errorf("flush failed: %w", err)
+	}
+
+	return nil
+}
+
+// flush signs the kept body and sends the response.
+func (s *signWriter) flush() error {
+	if s.streaming {
+		return nil
+	}
+
+	hash, err := sign(s.secretKey, s.body.Bytes())
+	if err != nil {
+		return fmt.Errorf("flush failed: %w", err)
+	}
+
+	s.Header().Set("HashSHA256", hex.EncodeToString(hash))
+	s.ResponseWriter.WriteHeader(s.status)
+	if _, err := s.ResponseWriter.Write(s.body.Bytes()); err != nil {
+		return fmt.Errorf("flush failed: %w", err)
+	}
+
+	return nil
+}
+
 func (m *Middleware) CheckSign(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		secretKey := []byte(m.secretKey)
@@ -79,7 +142,11 @@ func (m *Middleware) CheckSign(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(NewSignWriter(w, secretKey), r)
+		sw := NewSignWriter(w, secretKey)
+		next.ServeHTTP(sw, r)
+		if err := sw.flush(); err != nil {
+			m.log.Error("middleware CheckSign: write signed response failed", zap.Error(err))
+		}
 	})
 }
 
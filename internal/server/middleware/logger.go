@@ -31,6 +31,11 @@ func (r *loggingResponseWriter) Write(b []byte) (int, error) {
 	return size, nil
 }
 
+// Unwrap lets http.ResponseController reach the flusher of the wrapped writer.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	if statusCode == 0 {
 		statusCode = http.StatusOK
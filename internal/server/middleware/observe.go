@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/stats"
+	"github.com/go-chi/chi/v5"
+)
+
+// Observe records the latency of every request by the route pattern, so the paths
+// with the metric names in them are counted as a single route.
+func Observe(reg *stats.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			lw := loggingResponseWriter{
+				ResponseWriter: w,
+				responseData:   &responseData{status: http.StatusOK},
+			}
+
+			next.ServeHTTP(&lw, r)
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			reg.ObserveRequest(method(r.Method), route, lw.responseData.status, time.Since(start))
+		})
+	}
+}
+
+// method keeps the labels bounded: the methods made up by the clients are counted as one.
+func method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	default:
+		return "other"
+	}
+}
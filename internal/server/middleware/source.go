@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/arefev/mtrcstore/internal/server/repository"
+)
+
+// Source names the client of the request for the staleness tracking: the agent sends its address
+// in the X-Real-IP header, the other clients are named by the address of the connection.
+func (m *Middleware) Source(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := r.Header.Get("X-Real-IP")
+		if source == "" {
+			source = r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				source = host
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(repository.WithSource(r.Context(), source)))
+	})
+}
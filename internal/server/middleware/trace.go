@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/arefev/mtrcstore/internal/server/middleware")
+
+// Trace starts the server span of the request as a child of the trace context sent by the client,
+// the span covers the rest of the middleware chain and the handler.
+func (m *Middleware) Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		lw := loggingResponseWriter{
+			ResponseWriter: w,
+			responseData:   &responseData{status: http.StatusOK},
+		}
+
+		next.ServeHTTP(&lw, r.WithContext(ctx))
+
+		// the route is known only after the router matched the request
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+
+		status := lw.responseData.status
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("http.response.status_code", status),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -16,3 +16,36 @@ func (m *Metric) ValueString() string {
 func (m *Metric) DeltaString() string {
 	return strconv.Itoa(int(*m.Delta))
 }
+
+const (
+	ResultAccepted = "accepted"
+	ResultRejected = "rejected"
+)
+
+// Result is the outcome of saving a single metric of a batch.
+type Result struct {
+	ID     string `json:"id"`               // metric name
+	MType  string `json:"type"`             // metric type
+	Status string `json:"status"`           // accepted or rejected
+	Reason string `json:"reason,omitempty"` // why the metric was rejected
+}
+
+// BatchResult is the response of a batch update in the partial success mode.
+type BatchResult struct {
+	Results  []Result `json:"results"`
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+}
+
+func NewBatchResult(results []Result) BatchResult {
+	b := BatchResult{Results: results}
+	for _, r := range results {
+		if r.Status == ResultAccepted {
+			b.Accepted++
+		} else {
+			b.Rejected++
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,281 @@
+// Package relay passes the metrics saved by the server on to an upstream server with the sender of the agent.
+package relay
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	agent "github.com/arefev/mtrcstore/internal/agent/model"
+	"github.com/arefev/mtrcstore/internal/agent/service"
+	"github.com/arefev/mtrcstore/internal/retry"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"go.opentelemetry.io/otel/baggage"
+	"go.uber.org/zap"
+)
+
+const (
+	// pathKey is the baggage member with the servers the metrics were relayed by,
+	// the baggage goes with the trace context over both HTTP and gRPC.
+	pathKey = "mtrcstore.relay"
+	// maxBatchSize bounds the request of the batches merged after an outage.
+	maxBatchSize = 1000
+	// sendAttempts is the number of attempts of a request before the batch waits for the next round.
+	sendAttempts = 3
+	// outageWait is the pause between the rounds while the upstream is unavailable.
+	outageWait = 5 * time.Second
+)
+
+// Filter picks the metrics to relay.
+type Filter struct {
+	Name *regexp.Regexp // pattern of the metric names, nil for any name
+	Type string         // gauge or counter, empty for both
+}
+
+func (f Filter) Match(m model.Metric) bool {
+	if f.Type != "" && f.Type != m.MType {
+		return false
+	}
+
+	return f.Name == nil || f.Name.MatchString(m.ID)
+}
+
+// Options configures the relay.
+type Options struct {
+	Filter   Filter
+	ID       string // name of the server in the relay path, it must be unique among the relaying servers
+	Upstream string // address of the upstream server, only shown by the status
+	Buffer   int    // number of batches kept while the upstream is unavailable
+}
+
+// Status is the state of the relay, the counters are since the server started.
+type Status struct {
+	ID       string `json:"id"`
+	Upstream string `json:"upstream"`
+	Buffered int    `json:"buffered"` // batches waiting for the upstream
+	Relayed  int64  `json:"relayed"`  // metrics accepted by the upstream
+	Rejected int64  `json:"rejected"` // metrics rejected by the upstream
+	Dropped  int64  `json:"dropped"`  // batches dropped from the full buffer or failed for good
+	Looped   int64  `json:"looped"`   // batches not relayed because they were relayed by this server before
+}
+
+type batch struct {
+	path    string
+	metrics []agent.Metric
+}
+
+// Relay is a storage notifier that buffers the matching metrics and sends them upstream in the order they were saved.
+// A batch already relayed by this server is not relayed again, so servers relaying to each other do not loop.
+type Relay struct {
+	sender   service.Sender
+	log      *zap.Logger
+	ready    chan struct{}
+	opts     Options
+	queue    []batch
+	policy   retry.Policy
+	wait     time.Duration
+	relayed  atomic.Int64
+	rejected atomic.Int64
+	dropped  atomic.Int64
+	looped   atomic.Int64
+	mutex    sync.Mutex
+}
+
+// New creates the relay, the buffer keeps at least one batch.
+func New(sender service.Sender, opts Options, log *zap.Logger) *Relay {
+	opts.Buffer = max(opts.Buffer, 1)
+
+	return &Relay{
+		sender: sender,
+		log:    log,
+		ready:  make(chan struct{}, 1),
+		queue:  make([]batch, 0),
+		opts:   opts,
+		policy: retry.DefaultPolicy,
+		wait:   outageWait,
+	}
+}
+
+// Path returns the servers the metrics of the context were relayed by.
+func Path(ctx context.Context) []string {
+	value := baggage.FromContext(ctx).Member(pathKey).Value()
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// withPath puts the relay path into the baggage of the context.
+func withPath(ctx context.Context, path string) (context.Context, error) {
+	member, err := baggage.NewMemberRaw(pathKey, path)
+	if err != nil {
+		return ctx, fmt.Errorf("relay path member failed: %w", err)
+	}
+
+	b, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx, fmt.Errorf("relay path baggage failed: %w", err)
+	}
+
+	return baggage.ContextWithBaggage(ctx, b), nil
+}
+
+// Notify queues the matching metrics without waiting, the oldest batch is dropped when the buffer is full.
+func (r *Relay) Notify(ctx context.Context, elems []model.Metric) {
+	path := Path(ctx)
+	if slices.Contains(path, r.opts.ID) {
+		r.looped.Add(1)
+		return
+	}
+
+	metrics := make([]agent.Metric, 0, len(elems))
+	for _, m := range elems {
+		if r.opts.Filter.Match(m) {
+			metrics = append(metrics, agent.Metric{ID: m.ID, MType: m.MType, Delta: m.Delta, Value: m.Value})
+		}
+	}
+
+	if len(metrics) == 0 {
+		return
+	}
+
+	r.push(batch{path: strings.Join(append(path, r.opts.ID), ","), metrics: metrics})
+}
+
+func (r *Relay) push(b batch) {
+	r.mutex.Lock()
+	if len(r.queue) >= r.opts.Buffer {
+		r.queue = r.queue[1:]
+		r.dropped.Add(1)
+	}
+	r.queue = append(r.queue, b)
+	r.mutex.Unlock()
+
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+// requeue returns the batch the upstream did not take to the head of the buffer,
+// it is the oldest one, so it is dropped when the buffer filled up in the meantime.
+func (r *Relay) requeue(b batch) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.queue) >= r.opts.Buffer {
+		r.dropped.Add(1)
+		return
+	}
+	r.queue = append([]batch{b}, r.queue...)
+}
+
+// next takes the oldest batch merged with the following ones of the same path.
+func (r *Relay) next() (batch, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.queue) == 0 {
+		return batch{}, false
+	}
+
+	b := batch{path: r.queue[0].path, metrics: slices.Clone(r.queue[0].metrics)}
+	n := 1
+	for ; n < len(r.queue); n++ {
+		q := r.queue[n]
+		if q.path != b.path || len(b.metrics)+len(q.metrics) > maxBatchSize {
+			break
+		}
+		b.metrics = append(b.metrics, q.metrics...)
+	}
+	r.queue = r.queue[n:]
+
+	return b, true
+}
+
+// Run sends the buffered batches until the context is done, the batches still buffered then are lost.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		b, ok := r.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.ready:
+				continue
+			}
+		}
+
+		err := r.send(ctx, b)
+		switch {
+		case err == nil:
+			continue
+		case ctx.Err() != nil:
+			return
+		case r.sender.CanRetry(err):
+			r.requeue(b)
+			r.log.Warn("relay upstream unavailable", zap.Int("buffered", r.Status().Buffered), zap.Error(err))
+		default:
+			r.log.Error("relay batch failed", zap.Int("metrics", len(b.metrics)), zap.Error(err))
+			r.dropped.Add(1)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.wait):
+		}
+	}
+}
+
+func (r *Relay) send(ctx context.Context, b batch) error {
+	ctx, err := withPath(ctx, b.path)
+	if err != nil {
+		return err
+	}
+
+	var results []agent.Result
+	action := func() error {
+		var err error
+		results, err = r.sender.Request(ctx, b.metrics)
+		return err
+	}
+
+	if err := retry.New(action, r.sender.CanRetry, sendAttempts).WithPolicy(r.policy).RunContext(ctx); err != nil {
+		return fmt.Errorf("relay send failed: %w", err)
+	}
+
+	for _, res := range results {
+		if res.Status == agent.ResultRejected {
+			r.rejected.Add(1)
+			r.log.Warn("relay metric rejected", zap.String("id", res.ID), zap.String("reason", res.Reason))
+			continue
+		}
+		r.relayed.Add(1)
+	}
+
+	return nil
+}
+
+func (r *Relay) Status() Status {
+	r.mutex.Lock()
+	buffered := len(r.queue)
+	r.mutex.Unlock()
+
+	return Status{
+		ID:       r.opts.ID,
+		Upstream: r.opts.Upstream,
+		Buffered: buffered,
+		Relayed:  r.relayed.Load(),
+		Rejected: r.rejected.Load(),
+		Dropped:  r.dropped.Load(),
+		Looped:   r.looped.Load(),
+	}
+}
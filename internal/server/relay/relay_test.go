@@ -0,0 +1,147 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	agent "github.com/arefev/mtrcstore/internal/agent/model"
+	"github.com/arefev/mtrcstore/internal/retry"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errUnavailable = errors.New("upstream unavailable")
+
+type fakeSender struct {
+	paths   [][]string
+	sent    [][]agent.Metric
+	mutex   sync.Mutex
+	fail    int
+	invalid bool
+}
+
+func (s *fakeSender) Request(ctx context.Context, data []agent.Metric) ([]agent.Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.invalid {
+		return nil, errors.New("bad request")
+	}
+
+	if s.fail > 0 {
+		s.fail--
+		return nil, errUnavailable
+	}
+
+	s.paths = append(s.paths, Path(ctx))
+	s.sent = append(s.sent, data)
+
+	results := make([]agent.Result, 0, len(data))
+	for _, m := range data {
+		results = append(results, agent.Result{ID: m.ID, MType: m.MType, Status: agent.ResultAccepted})
+	}
+
+	return results, nil
+}
+
+func (s *fakeSender) CanRetry(err error) bool {
+	return errors.Is(err, errUnavailable)
+}
+
+func (s *fakeSender) batches() [][]agent.Metric {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sent
+}
+
+func gauge(name string, v float64) model.Metric {
+	return model.Metric{ID: name, MType: "gauge", Value: &v}
+}
+
+func newRelay(sender *fakeSender, opts Options) *Relay {
+	r := New(sender, opts, zap.NewNop())
+	r.policy = retry.Policy{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+	r.wait = 10 * time.Millisecond
+	return r
+}
+
+func TestRelay(t *testing.T) {
+	t.Run("matching metrics are buffered during the outage and relayed in order", func(t *testing.T) {
+		sender := &fakeSender{fail: 4}
+		r := newRelay(sender, Options{
+			ID:     "eu",
+			Buffer: 10,
+			Filter: Filter{Name: regexp.MustCompile(`^Alloc`), Type: "gauge"},
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r.Notify(ctx, []model.Metric{gauge("Alloc", 1), gauge("Sys", 1)})
+		r.Notify(ctx, []model.Metric{gauge("AllocBytes", 2)})
+
+		done := make(chan struct{})
+		go func() {
+			r.Run(ctx)
+			close(done)
+		}()
+
+		require.Eventually(t, func() bool { return r.Status().Relayed == 2 }, time.Second, 5*time.Millisecond)
+		cancel()
+		<-done
+
+		sent := sender.batches()
+		require.Len(t, sent, 1)
+		require.Equal(t, []string{"Alloc", "AllocBytes"}, []string{sent[0][0].ID, sent[0][1].ID})
+		require.Equal(t, [][]string{{"eu"}}, sender.paths)
+		require.Equal(t, Status{ID: "eu", Relayed: 2, Buffered: 0}, r.Status())
+	})
+
+	t.Run("metrics relayed by this server before are not relayed again", func(t *testing.T) {
+		r := newRelay(&fakeSender{}, Options{ID: "eu", Buffer: 10})
+
+		ctx, err := withPath(context.Background(), "us,eu")
+		require.NoError(t, err)
+		r.Notify(ctx, []model.Metric{gauge("Alloc", 1)})
+
+		ctx, err = withPath(context.Background(), "us")
+		require.NoError(t, err)
+		r.Notify(ctx, []model.Metric{gauge("Alloc", 1)})
+
+		require.Equal(t, int64(1), r.Status().Looped)
+		b, ok := r.next()
+		require.True(t, ok)
+		require.Equal(t, "us,eu", b.path)
+	})
+
+	t.Run("oldest batch is dropped from the full buffer", func(t *testing.T) {
+		r := newRelay(&fakeSender{}, Options{ID: "eu", Buffer: 2})
+		for i := range 3 {
+			r.Notify(context.Background(), []model.Metric{gauge("Alloc", float64(i))})
+		}
+
+		require.Equal(t, int64(1), r.Status().Dropped)
+		b, ok := r.next()
+		require.True(t, ok)
+		require.Len(t, b.metrics, 2)
+		require.InDelta(t, 1.0, *b.metrics[0].Value, 0)
+	})
+
+	t.Run("batch rejected by the upstream is dropped", func(t *testing.T) {
+		r := newRelay(&fakeSender{invalid: true}, Options{ID: "eu", Buffer: 2})
+		r.Notify(context.Background(), []model.Metric{gauge("Alloc", 1)})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Run(ctx)
+
+		require.Eventually(t, func() bool { return r.Status().Dropped == 1 }, time.Second, 5*time.Millisecond)
+		require.Zero(t, r.Status().Buffered)
+	})
+}
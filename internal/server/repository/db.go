@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/arefev/mtrcstore/internal/breaker"
 	"github.com/arefev/mtrcstore/internal/retry"
 	"github.com/arefev/mtrcstore/internal/server/model"
 	"github.com/jackc/pgerrcode"
@@ -14,6 +15,10 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -22,9 +27,12 @@ const (
 	timeCancel = 15 * time.Second
 )
 
+var tracer = otel.Tracer("github.com/arefev/mtrcstore/internal/server/repository")
+
 type databaseRep struct {
-	db  *sqlx.DB
-	log *zap.Logger
+	db      *sqlx.DB
+	log     *zap.Logger
+	breaker *breaker.Breaker
 }
 
 func NewDatabaseRep(dsn string, log *zap.Logger) (*databaseRep, error) {
@@ -43,6 +51,59 @@ func NewDatabaseRep(dsn string, log *zap.Logger) (*databaseRep, error) {
 	return rep, nil
 }
 
+// WithBreaker makes the storage fail fast while the database is down instead of retrying every call.
+func (rep *databaseRep) WithBreaker(s breaker.Settings) *databaseRep {
+	s.Name = "database"
+	s.IsFailure = rep.isUnavailable
+	s.OnStateChange = func(name string, from, to breaker.State) {
+		rep.log.Warn(
+			"circuit breaker state changed",
+			zap.String("name", name),
+			zap.Stringer("from", from),
+			zap.Stringer("to", to),
+		)
+	}
+	rep.breaker = breaker.New(s)
+
+	return rep
+}
+
+// Breakers returns the state of the breaker for the status endpoint.
+func (rep *databaseRep) Breakers() []breaker.Status {
+	if rep.breaker == nil {
+		return nil
+	}
+
+	return []breaker.Status{rep.breaker.Status()}
+}
+
+// PoolStats returns the state of the connection pool for the stats endpoint.
+func (rep *databaseRep) PoolStats() sql.DBStats {
+	return rep.db.Stats()
+}
+
+// run repeats the action while the errors can be retried, the breaker rejects the call right away when it is open.
+// The whole call including the retries is traced as one span named after the operation.
+func (rep *databaseRep) run(ctx context.Context, operation string, action retry.Action) error {
+	ctx, span := tracer.Start(ctx, "db "+operation, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", operation),
+	)
+
+	err := rep.breaker.Do(func() error {
+		return retry.New(action, rep.canRetry, retryCount).RunContext(ctx)
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, operation+" failed")
+	}
+
+	return err
+}
+
 func (rep *databaseRep) connect(dsn string) error {
 	db, err := sqlx.Connect("pgx", dsn)
 	if err != nil {
@@ -68,7 +129,7 @@ func (rep *databaseRep) bootstrap() error {
 		return rep.createTableMetrics(ctx)
 	}
 
-	if err := retry.New(action, rep.canRetry, retryCount).Run(); err != nil {
+	if err := retry.New(action, rep.canRetry, retryCount).RunContext(ctx); err != nil {
 		return fmt.Errorf("bootstrap failed: %w", err)
 	}
 
@@ -97,6 +158,10 @@ func (rep *databaseRep) createTableMetrics(ctx context.Context) error {
 }
 
 func (rep *databaseRep) Save(ctx context.Context, m model.Metric) error {
+	if err := validate(m); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, timeCancel)
 	defer cancel()
 
@@ -108,7 +173,7 @@ func (rep *databaseRep) Save(ctx context.Context, m model.Metric) error {
 		action = func() error {
 			return rep.update(ctx, m, metric)
 		}
-	case errors.Is(err, sql.ErrNoRows):
+	case errors.Is(err, ErrNotFound):
 		action = func() error {
 			return rep.create(ctx, m)
 		}
@@ -116,8 +181,8 @@ func (rep *databaseRep) Save(ctx context.Context, m model.Metric) error {
 		return fmt.Errorf("rep db Save failed: %w", err)
 	}
 
-	if err := retry.New(action, rep.canRetry, retryCount).Run(); err != nil {
-		return fmt.Errorf("rep db Save failed: %w", err)
+	if err := rep.run(ctx, "Save", action); err != nil {
+		return fmt.Errorf("rep db Save failed: %w", rep.classify(err))
 	}
 
 	return nil
@@ -128,6 +193,12 @@ func (rep *databaseRep) MassSave(ctx context.Context, elems []model.Metric) erro
 		return nil
 	}
 
+	for _, m := range elems {
+		if err := validate(m); err != nil {
+			return err
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, timeCancel)
 	defer cancel()
 
@@ -185,9 +256,9 @@ func (rep *databaseRep) MassSave(ctx context.Context, elems []model.Metric) erro
 		return tx.Commit()
 	}
 
-	if err := retry.New(action, rep.canRetry, retryCount).Run(); err != nil {
+	if err := rep.run(ctx, "MassSave", action); err != nil {
 		rep.log.Error("rep db mass save commit failed", zap.Error(err))
-		return fmt.Errorf("rep db mass save commit failed: %w", err)
+		return fmt.Errorf("rep db mass save commit failed: %w", rep.classify(err))
 	}
 
 	return nil
@@ -251,27 +322,23 @@ func (rep *databaseRep) Find(ctx context.Context, id string, mType string) (mode
 		return rep.db.GetContext(ctx, &metric, query, mType, id)
 	}
 
-	if err := retry.New(action, rep.canRetry, retryCount).Run(); err != nil {
-		rep.log.Error("rep db Get failed", zap.Error(err))
-		return model.Metric{}, fmt.Errorf("rep db Find failed: %w", err)
+	err := rep.run(ctx, "Find", action)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return model.Metric{}, fmt.Errorf("%w: rep db Find failed: %w", ErrNotFound, err)
+	case err != nil:
+		rep.log.Error("rep db Find failed", zap.Error(err))
+		return model.Metric{}, fmt.Errorf("rep db Find failed: %w", rep.classify(err))
 	}
 
 	return metric, nil
 }
 
 func (rep *databaseRep) Get(ctx context.Context) map[string]string {
-	ctx, cancel := context.WithTimeout(ctx, timeCancel)
-	defer cancel()
 	list := make(map[string]string)
 
-	query := "SELECT type, name, value, delta FROM metrics ORDER BY type, name ASC"
-	metrics := []model.Metric{}
-
-	action := func() error {
-		return rep.db.SelectContext(ctx, &metrics, query)
-	}
-
-	if err := retry.New(action, rep.canRetry, retryCount).Run(); err != nil {
+	metrics, err := rep.List(ctx)
+	if err != nil {
 		rep.log.Error("rep db Get failed", zap.Error(err))
 		return map[string]string{}
 	}
@@ -288,6 +355,24 @@ func (rep *databaseRep) Get(ctx context.Context) map[string]string {
 	return list
 }
 
+func (rep *databaseRep) List(ctx context.Context) ([]model.Metric, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeCancel)
+	defer cancel()
+
+	query := "SELECT type, name, value, delta FROM metrics ORDER BY type, name ASC"
+	metrics := []model.Metric{}
+
+	action := func() error {
+		return rep.db.SelectContext(ctx, &metrics, query)
+	}
+
+	if err := rep.run(ctx, "List", action); err != nil {
+		return nil, fmt.Errorf("rep db List failed: %w", rep.classify(err))
+	}
+
+	return metrics, nil
+}
+
 func (rep *databaseRep) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, timeCancel)
 	defer cancel()
@@ -296,14 +381,27 @@ func (rep *databaseRep) Ping(ctx context.Context) error {
 		return rep.db.PingContext(ctx)
 	}
 
-	if err := retry.New(action, rep.canRetry, retryCount).Run(); err != nil {
+	if err := rep.run(ctx, "Ping", action); err != nil {
 		rep.log.Error("ping DB failed", zap.Error(err))
-		return fmt.Errorf("Ping DB failed: %w", err)
+		return fmt.Errorf("Ping DB failed: %w", rep.classify(err))
 	}
 
 	return nil
 }
 
+// classify marks the connection problems as ErrUnavailable.
+func (rep *databaseRep) classify(err error) error {
+	if rep.isUnavailable(err) || errors.Is(err, breaker.ErrOpen) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+func (rep *databaseRep) isUnavailable(err error) bool {
+	return rep.canRetry(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, sql.ErrConnDone)
+}
+
 func (rep *databaseRep) canRetry(err error) bool {
 	var connError *pgconn.ConnectError
 	var pgError *pgconn.PgError
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+var (
+	// ErrNotFound is returned when the storage does not keep the requested metric.
+	ErrNotFound = errors.New("metric not found")
+	// ErrInvalid is returned when the metric can not be stored because of its content.
+	ErrInvalid = errors.New("metric is invalid")
+	// ErrUnavailable is returned when the storage backend can not serve the request at the moment.
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+// validate checks that the metric has a known type and a value of this type.
+func validate(m model.Metric) error {
+	switch m.MType {
+	case CounterName:
+		if m.Delta == nil {
+			return fmt.Errorf("%w: counter has not value", ErrInvalid)
+		}
+	case GaugeName:
+		if m.Value == nil {
+			return fmt.Errorf("%w: gauge has not value", ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalid, m.MType)
+	}
+
+	return nil
+}
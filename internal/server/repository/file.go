@@ -3,26 +3,45 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/arefev/mtrcstore/internal/server/model"
 	"go.uber.org/zap"
 )
 
+// file keeps the metrics in memory and persists them with a wal and periodic snapshots.
+// writeMutex serializes the writes, so the wal order matches the memory order
+// and no write slips in between a snapshot and the wal reset.
 type file struct {
-	memory
+	observer        SnapshotObserver
 	log             *zap.Logger
+	wal             *wal
+	writeMutex      *sync.Mutex
+	cancel          context.CancelFunc
+	done            chan struct{}
 	fileStoragePath string
-	storeInterval   int
-	filePermission  fs.FileMode
-	restore         bool
-	storeByEvent    bool
+	memory
+	storeInterval  int
+	filePermission fs.FileMode
+	restore        bool
+	storeByEvent   bool
+}
+
+// fileSnapshot is the format of the storage file,
+// Seq is the last wal record included into the state, the records up to it are skipped by the replay.
+type fileSnapshot struct {
+	memoryState
+	Seq uint64 `json:",omitempty"`
 }
 
-func NewFile(intrvl int, filePath string, restore bool, log *zap.Logger) *file {
+// NewFile opens the storage, the wal is required: without it the writes could not be made durable.
+func NewFile(intrvl int, filePath string, restore bool, log *zap.Logger) (*file, error) {
 	const filePermission fs.FileMode = 0o644
 
 	f := file{
@@ -32,39 +51,143 @@ func NewFile(intrvl int, filePath string, restore bool, log *zap.Logger) *file {
 		storeInterval:   intrvl,
 		restore:         restore,
 		storeByEvent:    intrvl == 0,
+		writeMutex:      &sync.Mutex{},
 		log:             log,
 	}
 
+	w, err := openWAL(f.walPath(), filePermission)
+	if err != nil {
+		return nil, fmt.Errorf("file storage init failed: %w", err)
+	}
+	f.wal = w
+
 	if restore {
 		f.load()
+		return &f, nil
 	}
 
-	return &f
+	// the old snapshot stays until the first new one, so the new records must follow its sequence
+	snap, err := readSnapshot(f.fileStoragePath)
+	if err != nil {
+		log.Error("worker read snapshot failed", zap.Error(err))
+	}
+	f.wal.seq = snap.Seq
+
+	if err := f.wal.reset(); err != nil {
+		return nil, errors.Join(fmt.Errorf("file storage init failed: %w", err), f.wal.close())
+	}
+
+	return &f, nil
+}
+
+// WithObserver reports the duration of every snapshot to the observer.
+func (f *file) WithObserver(o SnapshotObserver) *file {
+	f.observer = o
+	return f
 }
 
+func (f *file) walPath() string {
+	return f.fileStoragePath + ".wal"
+}
+
+// load restores the last snapshot and replays the records saved after it.
 func (f *file) load() {
-	file, err := os.OpenFile(f.fileStoragePath, os.O_RDONLY|os.O_CREATE, f.filePermission)
+	snap, err := readSnapshot(f.fileStoragePath)
 	if err != nil {
-		f.log.Error("worker open file failed", zap.Error(err))
-		return
+		f.log.Error("worker read snapshot failed", zap.Error(err))
 	}
+	f.loadState(snap.memoryState)
 
-	r := json.NewDecoder(file)
+	count, err := f.wal.replay(snap.Seq, func(m model.Metric) error {
+		return f.memory.Save(context.Background(), m)
+	})
+	if err != nil {
+		f.log.Error("worker replay wal failed", zap.Error(err), zap.Int("replayed", count))
+	}
 
-	if err := r.Decode(&f); err != nil {
-		f.log.Error("worker decode data failed", zap.Error(err))
-		return
+	f.log.Info("worker data loaded", zap.Int("wal records", count))
+}
+
+// readSnapshot decodes the storage file, a missing or empty file is an empty snapshot.
+func readSnapshot(path string) (_ fileSnapshot, err error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileSnapshot{}, nil
+	}
+
+	if err != nil {
+		return fileSnapshot{}, fmt.Errorf("open snapshot failed: %w", err)
+	}
+
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close snapshot failed: %w", closeErr))
+		}
+	}()
+
+	snap := fileSnapshot{}
+	if err := json.NewDecoder(file).Decode(&snap); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fileSnapshot{}, nil
+		}
+		return fileSnapshot{}, fmt.Errorf("decode snapshot failed: %w", err)
 	}
 
-	f.log.Info("worker data loaded")
+	return snap, nil
 }
 
-func (f *file) WorkerRun() *file {
-	go f.worker()
+// LoadFile reads the state of a file storage without changing it, for the tools that only export it.
+// The storage itself is not opened: it resets the wal and writes a snapshot on close.
+// The invalid tail of the wal is skipped, as the restore of the storage drops it.
+func LoadFile(filePath string, log *zap.Logger) (*memory, error) {
+	snap, err := readSnapshot(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("file storage load failed: %w", err)
+	}
+
+	m := NewMemory()
+	m.loadState(snap.memoryState)
+
+	w, err := os.Open(filePath + ".wal")
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("file storage load failed: %w", err)
+	}
+
+	defer func() {
+		if err := w.Close(); err != nil {
+			log.Error("close wal failed", zap.Error(err))
+		}
+	}()
+
+	res, err := readWAL(w, snap.Seq, func(metric model.Metric) error {
+		return m.Save(context.Background(), metric)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("file storage load failed: %w", err)
+	}
+
+	if res.tail != nil {
+		log.Warn("wal tail skipped", zap.Error(res.tail), zap.Int64("offset", res.offset))
+	}
+
+	return m, nil
+}
+
+// WorkerRun starts the periodic snapshots, the worker stops when ctx is done or the storage is closed.
+func (f *file) WorkerRun(ctx context.Context) *file {
+	ctx, f.cancel = context.WithCancel(ctx)
+	f.done = make(chan struct{})
+	go f.worker(ctx)
 	return f
 }
 
-func (f *file) worker() {
+func (f *file) worker(ctx context.Context) {
+	defer close(f.done)
+
 	f.log.Info(
 		"worker running with params",
 		zap.Int("interval in seconds", f.storeInterval),
@@ -77,72 +200,148 @@ func (f *file) worker() {
 		return
 	}
 
-	start := time.Now()
+	ticker := time.NewTicker(time.Duration(f.storeInterval) * time.Second)
+	defer ticker.Stop()
+
 	for {
-		period := int(time.Since(start).Seconds())
-		if period > f.storeInterval {
+		select {
+		case <-ctx.Done():
+			f.log.Info("worker stopped")
+			return
+		case <-ticker.C:
 			f.write()
-			start = time.Now()
 		}
 	}
 }
 
 func (f *file) write() {
-	file, err := os.OpenFile(f.fileStoragePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.filePermission)
-	if err != nil {
-		f.log.Error("worker open file failed", zap.Error(err))
+	if err := f.snapshot(); err != nil {
+		f.log.Error("worker write snapshot failed", zap.Error(err))
 		return
 	}
 
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			f.log.Error("worker close file failed", zap.Error(err))
-			return
-		}
-	}()
+	f.log.Info("worker data saved by worker")
+}
 
-	wr := json.NewEncoder(file)
-	if err := wr.Encode(f); err != nil {
-		f.log.Error("worker encode data failed", zap.Error(err))
-		return
+// snapshot atomically replaces the storage file with the current state and empties the wal.
+func (f *file) snapshot() error {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	return f.snapshotLocked()
+}
+
+// Snapshot writes the current state on demand, for example from the admin endpoint.
+func (f *file) Snapshot(_ context.Context) error {
+	if err := f.snapshot(); err != nil {
+		return err
 	}
 
-	f.log.Info("worker data saved by worker")
+	f.log.Info("worker data saved on demand")
+
+	return nil
 }
 
+func (f *file) snapshotLocked() (err error) {
+	if f.observer != nil {
+		defer func(start time.Time) {
+			f.observer.ObserveSnapshot(err, time.Since(start))
+		}(time.Now())
+	}
+
+	// the writes wait for writeMutex, so the state includes exactly the records up to the last sequence
+	snap := fileSnapshot{memoryState: f.copyState(), Seq: f.wal.seq}
+	err = writeAtomic(f.fileStoragePath, f.filePermission, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(snap)
+	})
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	if err := f.wal.reset(); err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	return nil
+}
+
+// Save logs the metric before it is applied, so a failed write changes nothing and can be retried.
 func (f *file) Save(ctx context.Context, m model.Metric) error {
+	if err := validate(m); err != nil {
+		return err
+	}
+
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	if err := f.wal.append(m); err != nil {
+		return fmt.Errorf("%w: file save failed: %w", ErrUnavailable, err)
+	}
+
 	if err := f.memory.Save(ctx, m); err != nil {
 		return err
 	}
 
-	return f.writeEvent()
+	f.writeEvent()
+
+	return nil
 }
 
-func (f *file) writeEvent() error {
-	if !f.storeByEvent {
-		return nil
+// MassSave logs the whole batch before it is applied, like Save.
+func (f *file) MassSave(ctx context.Context, elems []model.Metric) error {
+	for _, m := range elems {
+		if err := validate(m); err != nil {
+			return fmt.Errorf("mass save failed: %w", err)
+		}
 	}
 
-	file, err := os.OpenFile(f.fileStoragePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.filePermission)
-	if err != nil {
-		return fmt.Errorf("worker open file failed: %w", err)
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	if err := f.wal.append(elems...); err != nil {
+		return fmt.Errorf("%w: file mass save failed: %w", ErrUnavailable, err)
 	}
 
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			f.log.Error("worker close file failed", zap.Error(err))
-			return
-		}
-	}()
+	if err := f.memory.MassSave(ctx, elems); err != nil {
+		return err
+	}
 
-	wr := json.NewEncoder(file)
-	if err := wr.Encode(f); err != nil {
-		return fmt.Errorf("worker encode data failed: %w", err)
+	f.writeEvent()
+
+	return nil
+}
+
+// writeEvent snapshots after every write in the event mode. The write is in the wal already,
+// so a failed snapshot is only logged: failing the write would make the client repeat it.
+func (f *file) writeEvent() {
+	if !f.storeByEvent {
+		return
+	}
+
+	if err := f.snapshotLocked(); err != nil {
+		f.log.Error("worker write by event failed", zap.Error(err))
+		return
 	}
 
 	f.log.Info("worker data written by event")
+}
+
+// Close stops the worker and flushes the state to the disk before closing the wal.
+func (f *file) Close() error {
+	if f.cancel != nil {
+		f.cancel()
+		<-f.done
+	}
+
+	if err := f.snapshot(); err != nil {
+		return fmt.Errorf("file close flush failed: %w", err)
+	}
+
+	f.log.Info("worker data flushed on close")
+
+	if err := f.wal.close(); err != nil {
+		return fmt.Errorf("file close failed: %w", err)
+	}
 
 	return nil
 }
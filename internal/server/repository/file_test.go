@@ -5,11 +5,14 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/arefev/mtrcstore/internal/server/logger"
 	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,6 +22,8 @@ func TestFileSave(t *testing.T) {
 		cLog, err := logger.Build("debug")
 		require.NoError(t, err)
 
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+
 		var delta int64 = 1
 		mtrc := model.Metric{
 			Delta: &delta,
@@ -26,7 +31,13 @@ func TestFileSave(t *testing.T) {
 			MType: "counter",
 		}
 
-		rep := NewFile(1, "./storage_test.json", false, cLog)
+		rep, err := NewFile(1, path, false, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, rep.Close())
+		}()
+
 		err = rep.Save(ctx, mtrc)
 		require.NoError(t, err)
 
@@ -42,6 +53,8 @@ func TestFileWrite(t *testing.T) {
 		cLog, err := logger.Build("debug")
 		require.NoError(t, err)
 
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+
 		var delta int64 = 1
 		mtrc := model.Metric{
 			Delta: &delta,
@@ -49,7 +62,13 @@ func TestFileWrite(t *testing.T) {
 			MType: "counter",
 		}
 
-		rep := NewFile(1, "./storage_test.json", false, cLog)
+		rep, err := NewFile(1, path, false, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, rep.Close())
+		}()
+
 		err = rep.Save(ctx, mtrc)
 		require.NoError(t, err)
 
@@ -59,9 +78,6 @@ func TestFileWrite(t *testing.T) {
 		saved, err := rep.findCounter("PollCounter")
 		require.NoError(t, err)
 		require.Equal(t, mtrc.Delta, saved.Delta)
-
-		err = os.Remove("./storage_test.json")
-		require.NoError(t, err)
 	})
 }
 
@@ -72,6 +88,8 @@ func TestFileWorker(t *testing.T) {
 		cLog, err := logger.Build("debug")
 		require.NoError(t, err)
 
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+
 		var delta int64 = 3
 		mtrc := model.Metric{
 			Delta: &delta,
@@ -79,22 +97,25 @@ func TestFileWorker(t *testing.T) {
 			MType: "counter",
 		}
 
-		rep := NewFile(1, "./storage_test.json", false, cLog)
-		rep.WorkerRun()
+		rep, err := NewFile(1, path, false, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, rep.Close())
+		}()
+
+		rep.WorkerRun(ctx)
 		err = rep.Save(ctx, mtrc)
 		require.NoError(t, err)
 
 		time.Sleep(time.Second * 3)
 
-		file, err := os.OpenFile("./storage_test.json", os.O_RDONLY|os.O_CREATE, filePermission)
+		file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, filePermission)
 		require.NoError(t, err)
 
 		data, err := io.ReadAll(file)
 		require.NoError(t, err)
 		require.Contains(t, string(data), `"PollCounter":3`)
-
-		err = os.Remove("./storage_test.json")
-		require.NoError(t, err)
 	})
 }
 
@@ -105,6 +126,8 @@ func TestFileEvent(t *testing.T) {
 		cLog, err := logger.Build("debug")
 		require.NoError(t, err)
 
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+
 		var delta int64 = 4
 		mtrc := model.Metric{
 			Delta: &delta,
@@ -112,18 +135,438 @@ func TestFileEvent(t *testing.T) {
 			MType: "counter",
 		}
 
-		rep := NewFile(0, "./storage_test.json", false, cLog)
+		rep, err := NewFile(0, path, false, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, rep.Close())
+		}()
+
 		err = rep.Save(ctx, mtrc)
 		require.NoError(t, err)
 
-		file, err := os.OpenFile("./storage_test.json", os.O_RDONLY|os.O_CREATE, filePermission)
+		file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, filePermission)
 		require.NoError(t, err)
 
 		data, err := io.ReadAll(file)
 		require.NoError(t, err)
 		require.Contains(t, string(data), `"PollCounter":4`)
+	})
+}
+
+func TestFileRecoveryFromWAL(t *testing.T) {
+	t.Run("file restores metrics saved after the last snapshot", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage.json")
+
+		var delta int64 = 2
+		var value = 1.5
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		err = rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+		require.NoError(t, err)
+
+		require.NoError(t, rep.snapshot())
+
+		err = rep.MassSave(ctx, []model.Metric{
+			{ID: "PollCounter", MType: "counter", Delta: &delta},
+			{ID: "Alloc", MType: "gauge", Value: &value},
+		})
+		require.NoError(t, err)
+
+		// simulate a crash: the wal is closed without the final snapshot
+		require.NoError(t, rep.wal.close())
+
+		restored, err := NewFile(300, path, true, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, restored.Close())
+		}()
+
+		counter, err := restored.findCounter("PollCounter")
+		require.NoError(t, err)
+		require.Equal(t, int64(4), *counter.Delta)
+
+		gauge, err := restored.findGauge("Alloc")
+		require.NoError(t, err)
+		require.Equal(t, value, *gauge.Value)
+	})
+
+	t.Run("file drops torn wal record", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage.json")
+
+		var delta int64 = 1
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		for range 3 {
+			err = rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+			require.NoError(t, err)
+		}
+		// simulate a crash: the wal is closed without the final snapshot
+		require.NoError(t, rep.wal.close())
+
+		info, err := os.Stat(path + ".wal")
+		require.NoError(t, err)
+		validSize := info.Size()
+
+		wal, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0o644)
+		require.NoError(t, err)
+		_, err = wal.WriteString(`{"delta":100,"id":"PollCou`)
+		require.NoError(t, err)
+		require.NoError(t, wal.Close())
+
+		restored, err := NewFile(300, path, true, cLog)
+
+		require.NoError(t, err)
+		counter, err := restored.findCounter("PollCounter")
+		require.NoError(t, err)
+		require.Equal(t, int64(3), *counter.Delta)
+
+		info, err = os.Stat(path + ".wal")
+		require.NoError(t, err)
+		require.Equal(t, validSize, info.Size())
+
+		err = restored.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+		require.NoError(t, err)
+		require.NoError(t, restored.wal.close())
+
+		again, err := NewFile(300, path, true, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, again.Close())
+		}()
+
+		counter, err = again.findCounter("PollCounter")
+		require.NoError(t, err)
+		require.Equal(t, int64(4), *counter.Delta)
+	})
+
+	t.Run("file replays wal when snapshot is truncated", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage.json")
+		err = os.WriteFile(path, []byte(`{"Gauge":{"Alloc":1`), 0o644)
+		require.NoError(t, err)
+
+		var delta int64 = 5
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		err = rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+		require.NoError(t, err)
+		require.NoError(t, rep.wal.close())
+
+		restored, err := NewFile(300, path, true, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, restored.Close())
+		}()
+
+		counter, err := restored.findCounter("PollCounter")
+		require.NoError(t, err)
+		require.Equal(t, delta, *counter.Delta)
+
+		_, err = restored.findGauge("Alloc")
+		require.Error(t, err)
+	})
+
+	t.Run("file skips wal records already in the snapshot", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage.json")
+
+		var delta int64 = 2
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		err = rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+		require.NoError(t, err)
+
+		// simulate a crash between the snapshot rename and the wal reset
+		log, err := os.ReadFile(path + ".wal")
+		require.NoError(t, err)
+		require.NoError(t, rep.snapshot())
+		require.NoError(t, os.WriteFile(path+".wal", log, 0o644))
+		require.NoError(t, rep.wal.close())
+
+		restored, err := NewFile(300, path, true, cLog)
+		require.NoError(t, err)
+
+		counter, err := restored.findCounter("PollCounter")
+		require.NoError(t, err)
+		require.Equal(t, int64(2), *counter.Delta)
+
+		err = restored.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+		require.NoError(t, err)
+		require.NoError(t, restored.wal.close())
+
+		again, err := NewFile(300, path, true, cLog)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, again.Close())
+		}()
 
-		err = os.Remove("./storage_test.json")
+		counter, err = again.findCounter("PollCounter")
 		require.NoError(t, err)
+		require.Equal(t, int64(4), *counter.Delta)
+	})
+
+	t.Run("file does not apply the write the wal failed", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage.json")
+
+		var delta int64 = 2
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		require.NoError(t, rep.wal.close())
+
+		err = rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+		require.ErrorIs(t, err, ErrUnavailable)
+		err = rep.MassSave(ctx, []model.Metric{{ID: "PollCounter", MType: "counter", Delta: &delta}})
+		require.ErrorIs(t, err, ErrUnavailable)
+
+		_, err = rep.findCounter("PollCounter")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("file fails without wal", func(t *testing.T) {
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		_, err = NewFile(300, filepath.Join(t.TempDir(), "missing", "storage.json"), false, cLog)
+		require.Error(t, err)
+	})
+
+	t.Run("file snapshot is atomic and empties wal", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "storage.json")
+
+		var value = 2.5
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, rep.Close())
+		}()
+
+		err = rep.Save(ctx, model.Metric{ID: "Alloc", MType: "gauge", Value: &value})
+		require.NoError(t, err)
+		require.NoError(t, rep.snapshot())
+
+		info, err := os.Stat(path + ".wal")
+		require.NoError(t, err)
+		require.Zero(t, info.Size())
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"Alloc":2.5`)
+	})
+}
+
+func TestFileClose(t *testing.T) {
+	t.Run("file close stops worker and flushes data", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+
+		var delta int64 = 7
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		rep.WorkerRun(ctx)
+		err = rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta})
+		require.NoError(t, err)
+
+		require.NoError(t, rep.Close())
+
+		select {
+		case <-rep.done:
+		default:
+			t.Fatal("worker is still running")
+		}
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"PollCounter":7`)
+	})
+
+	t.Run("file worker stops with context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+
+		rep, err := NewFile(300, path, false, cLog)
+
+		require.NoError(t, err)
+
+		rep.WorkerRun(ctx)
+		cancel()
+
+		select {
+		case <-rep.done:
+		case <-time.After(time.Second):
+			t.Fatal("worker is not stopped by context")
+		}
+
+		require.NoError(t, rep.Close())
+	})
+}
+
+func TestFileSnapshot(t *testing.T) {
+	t.Run("file snapshot on demand success", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+
+		var value = 3.5
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, rep.Close())
+		}()
+
+		err = rep.Save(ctx, model.Metric{ID: "Alloc", MType: "gauge", Value: &value})
+		require.NoError(t, err)
+
+		var s Snapshotter = rep
+		require.NoError(t, s.Snapshot(ctx))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(data), `"Alloc":3.5`)
+	})
+}
+
+func TestFileConcurrency(t *testing.T) {
+	t.Run("file concurrent writes and snapshots", func(t *testing.T) {
+		const (
+			writers = 4
+			iters   = 200
+		)
+
+		ctx := context.Background()
+		cLog, err := logger.Build("error")
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "storage_test.json")
+		rep, err := NewFile(300, path, false, cLog)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var delta int64 = 1
+				for range iters {
+					err := rep.Save(ctx, model.Metric{ID: "PollCount", MType: CounterName, Delta: &delta})
+					assert.NoError(t, err)
+				}
+			}()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				assert.NoError(t, rep.snapshot())
+			}
+		}()
+
+		wg.Wait()
+		// simulate a crash: the wal is closed without the final snapshot
+		require.NoError(t, rep.wal.close())
+
+		restored, err := NewFile(300, path, true, cLog)
+
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, restored.Close())
+		}()
+
+		saved, err := restored.findCounter("PollCount")
+		require.NoError(t, err)
+		require.Equal(t, int64(writers*iters), *saved.Delta)
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	ctx := context.Background()
+	cLog, err := logger.Build("debug")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	var delta int64 = 2
+	rep, err := NewFile(300, path, false, cLog)
+	require.NoError(t, err)
+	require.NoError(t, rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta}))
+
+	// a crash between the snapshot rename and the wal reset leaves the snapshotted records in the wal
+	log, err := os.ReadFile(path + ".wal")
+	require.NoError(t, err)
+	require.NoError(t, rep.snapshot())
+	require.NoError(t, os.WriteFile(path+".wal", log, 0o644))
+	require.NoError(t, rep.Save(ctx, model.Metric{ID: "PollCounter", MType: "counter", Delta: &delta}))
+	require.NoError(t, rep.wal.close())
+
+	wal, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = wal.WriteString(`{"delta":100,"id":"PollCou`)
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	snapshot, err := os.ReadFile(path)
+	require.NoError(t, err)
+	log, err = os.ReadFile(path + ".wal")
+	require.NoError(t, err)
+
+	loaded, err := LoadFile(path, cLog)
+	require.NoError(t, err)
+
+	counter, err := loaded.findCounter("PollCounter")
+	require.NoError(t, err)
+	require.Equal(t, int64(4), *counter.Delta)
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, snapshot, got)
+	got, err = os.ReadFile(path + ".wal")
+	require.NoError(t, err)
+	require.Equal(t, log, got)
+
+	t.Run("missing file is empty", func(t *testing.T) {
+		loaded, err := LoadFile(filepath.Join(t.TempDir(), "none.json"), cLog)
+		require.NoError(t, err)
+
+		_, err = loaded.findCounter("PollCounter")
+		require.Error(t, err)
 	})
 }
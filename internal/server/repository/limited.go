@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+var (
+	ErrInvalidName = fmt.Errorf("%w: name is not allowed", ErrInvalid)
+	ErrSeriesLimit = errors.New("metric series limit exceeded")
+	ErrBatchLimit  = errors.New("metric batch limit exceeded")
+)
+
+// Limits restricts what clients can write into the storage, a zero value disables the limit.
+type Limits struct {
+	NamePattern    string `json:"name_pattern"`    // regular expression the metric name must match
+	ReservedPrefix string `json:"reserved_prefix"` // names kept for the metrics of the server itself
+	MaxSeries      int    `json:"max_series"`      // number of distinct metric names
+	MaxNameLength  int    `json:"max_name_length"` // length of the metric name in bytes
+	MaxBatchSize   int    `json:"max_batch_size"`  // number of metrics in a single MassSave
+}
+
+// LimitReporter is implemented by storages that count the writes rejected by limits.
+type LimitReporter interface {
+	Limits() Limits
+	Series() int
+	Rejections() map[string]int64
+}
+
+// BatchSize caps the size of the batches a writer collects at the batch limit of the storage,
+// so a full batch is not rejected as a whole.
+func BatchSize(s Storage, size int) int {
+	if l, ok := As[LimitReporter](s); ok && l.Limits().MaxBatchSize > 0 {
+		return min(size, l.Limits().MaxBatchSize)
+	}
+
+	return size
+}
+
+// limited is a storage decorator that validates metric names and
+// protects the wrapped storage from unbounded cardinality.
+// A new series is pending while the writes that reserved it are in flight,
+// the pending series count against MaxSeries, so concurrent writes can not exceed it together.
+type limited struct {
+	Storage
+	names       *regexp.Regexp
+	series      map[string]struct{}
+	pending     map[string]int // new series with the number of the writes holding them
+	mutex       *sync.Mutex
+	limits      Limits
+	invalidName atomic.Int64
+	seriesLimit atomic.Int64
+	batchLimit  atomic.Int64
+}
+
+// NewLimited wraps the storage, the series already kept by the storage are counted against MaxSeries.
+func NewLimited(ctx context.Context, s Storage, l Limits) (*limited, error) {
+	rep := &limited{
+		Storage: s,
+		limits:  l,
+		series:  make(map[string]struct{}),
+		pending: make(map[string]int),
+		mutex:   &sync.Mutex{},
+	}
+
+	if l.NamePattern != "" {
+		names, err := regexp.Compile(l.NamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("limited name pattern compile failed: %w", err)
+		}
+		rep.names = names
+	}
+
+	for name := range s.Get(ctx) {
+		if rep.reserved(name) {
+			continue
+		}
+		rep.series[name] = struct{}{}
+	}
+
+	return rep, nil
+}
+
+func (rep *limited) Unwrap() Storage {
+	return rep.Storage
+}
+
+func (rep *limited) Save(ctx context.Context, m model.Metric) error {
+	if err := rep.checkName(m.ID); err != nil {
+		return err
+	}
+
+	added, err := rep.reserve(m)
+	if err != nil {
+		return err
+	}
+
+	if err := rep.Storage.Save(ctx, m); err != nil {
+		rep.release(added)
+		return fmt.Errorf("limited save failed: %w", err)
+	}
+	rep.commit(added)
+
+	return nil
+}
+
+func (rep *limited) MassSave(ctx context.Context, elems []model.Metric) error {
+	if rep.limits.MaxBatchSize > 0 && len(elems) > rep.limits.MaxBatchSize {
+		rep.batchLimit.Add(1)
+		return fmt.Errorf("%w: %d metrics, max %d", ErrBatchLimit, len(elems), rep.limits.MaxBatchSize)
+	}
+
+	for _, m := range elems {
+		if err := rep.checkName(m.ID); err != nil {
+			return err
+		}
+	}
+
+	added, err := rep.reserve(elems...)
+	if err != nil {
+		return err
+	}
+
+	if err := rep.Storage.MassSave(ctx, elems); err != nil {
+		rep.release(added)
+		return fmt.Errorf("limited mass save failed: %w", err)
+	}
+	rep.commit(added)
+
+	return nil
+}
+
+// Validate checks the batch against the limits without saving it,
+// the new series are rejected once the batch would exceed MaxSeries.
+// The accepted new series stay reserved until the release is called,
+// so the following MassSave of the accepted metrics can not run out of series.
+func (rep *limited) Validate(elems []model.Metric) ([]error, func()) {
+	errs := make([]error, len(elems))
+
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+
+	added := make([]string, 0)
+	for i, m := range elems {
+		if err := rep.checkName(m.ID); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		if _, ok := rep.series[m.ID]; ok || slices.Contains(added, m.ID) {
+			continue
+		}
+
+		if !rep.hold(m.ID) {
+			rep.seriesLimit.Add(1)
+			errs[i] = fmt.Errorf("%w: max %d", ErrSeriesLimit, rep.limits.MaxSeries)
+			continue
+		}
+		added = append(added, m.ID)
+	}
+
+	return errs, func() { rep.release(added) }
+}
+
+func (rep *limited) checkName(name string) error {
+	switch {
+	case name == "":
+		rep.invalidName.Add(1)
+		return fmt.Errorf("%w: name is empty", ErrInvalidName)
+	case rep.limits.MaxNameLength > 0 && len(name) > rep.limits.MaxNameLength:
+		rep.invalidName.Add(1)
+		return fmt.Errorf("%w: name is longer than %d", ErrInvalidName, rep.limits.MaxNameLength)
+	case rep.reserved(name):
+		rep.invalidName.Add(1)
+		return fmt.Errorf("%w: prefix %q is reserved", ErrInvalidName, rep.limits.ReservedPrefix)
+	case rep.names != nil && !rep.names.MatchString(name):
+		rep.invalidName.Add(1)
+		return fmt.Errorf("%w: %q does not match %s", ErrInvalidName, name, rep.limits.NamePattern)
+	}
+
+	return nil
+}
+
+func (rep *limited) reserved(name string) bool {
+	return rep.limits.ReservedPrefix != "" && strings.HasPrefix(name, rep.limits.ReservedPrefix)
+}
+
+// reserve holds the new series of the batch, the batch is rejected as a whole
+// when the new series do not fit into the limit.
+func (rep *limited) reserve(elems ...model.Metric) ([]string, error) {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+
+	added := make([]string, 0)
+	for _, m := range elems {
+		if _, ok := rep.series[m.ID]; ok || slices.Contains(added, m.ID) {
+			continue
+		}
+
+		if !rep.hold(m.ID) {
+			rep.releaseLocked(added)
+			rep.seriesLimit.Add(1)
+			return nil, fmt.Errorf("%w: max %d", ErrSeriesLimit, rep.limits.MaxSeries)
+		}
+		added = append(added, m.ID)
+	}
+
+	return added, nil
+}
+
+// hold adds a write to the pending series, a series pending already is held without the limit check.
+func (rep *limited) hold(name string) bool {
+	if _, ok := rep.pending[name]; !ok && rep.limits.MaxSeries > 0 &&
+		len(rep.series)+len(rep.pending) >= rep.limits.MaxSeries {
+		return false
+	}
+
+	rep.pending[name]++
+	return true
+}
+
+// commit turns the series held by a successful write into saved ones.
+func (rep *limited) commit(names []string) {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+
+	for _, name := range names {
+		rep.series[name] = struct{}{}
+		delete(rep.pending, name)
+	}
+}
+
+// release drops the holds of a write that failed or ended,
+// a series saved by another write in the meantime is kept.
+func (rep *limited) release(names []string) {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+
+	rep.releaseLocked(names)
+}
+
+func (rep *limited) releaseLocked(names []string) {
+	for _, name := range names {
+		n, ok := rep.pending[name]
+		switch {
+		case !ok:
+		case n > 1:
+			rep.pending[name] = n - 1
+		default:
+			delete(rep.pending, name)
+		}
+	}
+}
+
+func (rep *limited) Limits() Limits {
+	return rep.limits
+}
+
+func (rep *limited) Series() int {
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+
+	return len(rep.series)
+}
+
+func (rep *limited) Rejections() map[string]int64 {
+	return map[string]int64{
+		"invalid_name": rep.invalidName.Load(),
+		"series_limit": rep.seriesLimit.Load(),
+		"batch_limit":  rep.batchLimit.Load(),
+	}
+}
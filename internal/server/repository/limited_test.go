@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedName(t *testing.T) {
+	var value float64 = 1
+	tests := []struct {
+		err  error
+		name string
+		id   string
+	}{
+		{name: "valid name", id: "Alloc", err: nil},
+		{name: "empty name", id: "", err: ErrInvalidName},
+		{name: "too long name", id: "VeryLongMetricName", err: ErrInvalidName},
+		{name: "forbidden characters", id: "Alloc Sys", err: ErrInvalidName},
+		{name: "reserved prefix", id: "mtrcAlloc", err: ErrInvalidName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rep, err := NewLimited(ctx, NewMemory(), Limits{
+				NamePattern:    `^[A-Za-z]+$`,
+				MaxNameLength:  10,
+				ReservedPrefix: "mtrc",
+			})
+			require.NoError(t, err)
+
+			err = rep.Save(ctx, model.Metric{ID: tt.id, MType: GaugeName, Value: &value})
+			if tt.err == nil {
+				require.NoError(t, err)
+				require.Zero(t, rep.Rejections()["invalid_name"])
+				return
+			}
+
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, int64(1), rep.Rejections()["invalid_name"])
+		})
+	}
+}
+
+func TestLimitedSeries(t *testing.T) {
+	t.Run("limited rejects new series over the limit", func(t *testing.T) {
+		ctx := context.Background()
+		var value float64 = 1
+
+		mem := NewMemory()
+		err := mem.Save(ctx, model.Metric{ID: "Alloc", MType: GaugeName, Value: &value})
+		require.NoError(t, err)
+
+		rep, err := NewLimited(ctx, mem, Limits{MaxSeries: 2})
+		require.NoError(t, err)
+		require.Equal(t, 1, rep.Series())
+
+		err = rep.Save(ctx, model.Metric{ID: "HeapAlloc", MType: GaugeName, Value: &value})
+		require.NoError(t, err)
+
+		err = rep.Save(ctx, model.Metric{ID: "Alloc", MType: GaugeName, Value: &value})
+		require.NoError(t, err)
+
+		err = rep.MassSave(ctx, []model.Metric{
+			{ID: "Alloc", MType: GaugeName, Value: &value},
+			{ID: "Sys", MType: GaugeName, Value: &value},
+		})
+		require.ErrorIs(t, err, ErrSeriesLimit)
+		require.Equal(t, 2, rep.Series())
+		require.Equal(t, int64(1), rep.Rejections()["series_limit"])
+
+		_, err = mem.Find(ctx, "Sys", GaugeName)
+		require.Error(t, err)
+	})
+
+	t.Run("limited releases series of failed write", func(t *testing.T) {
+		ctx := context.Background()
+
+		rep, err := NewLimited(ctx, NewMemory(), Limits{MaxSeries: 1})
+		require.NoError(t, err)
+
+		err = rep.Save(ctx, model.Metric{ID: "PollCount", MType: CounterName})
+		require.Error(t, err)
+		require.Zero(t, rep.Series())
+	})
+
+	t.Run("limited keeps series saved by a concurrent write", func(t *testing.T) {
+		ctx := context.Background()
+		var value float64 = 1
+
+		rep, err := NewLimited(ctx, NewMemory(), Limits{MaxSeries: 1})
+		require.NoError(t, err)
+
+		// two writes reserve the same new series, the first one fails and the second one succeeds
+		failed, err := rep.reserve(model.Metric{ID: "Alloc", MType: GaugeName})
+		require.NoError(t, err)
+		require.NoError(t, rep.Save(ctx, model.Metric{ID: "Alloc", MType: GaugeName, Value: &value}))
+		rep.release(failed)
+		require.Equal(t, 1, rep.Series())
+
+		err = rep.Save(ctx, model.Metric{ID: "Sys", MType: GaugeName, Value: &value})
+		require.ErrorIs(t, err, ErrSeriesLimit)
+	})
+
+	t.Run("limited holds validated series until release", func(t *testing.T) {
+		ctx := context.Background()
+		var value float64 = 1
+
+		rep, err := NewLimited(ctx, NewMemory(), Limits{MaxSeries: 1})
+		require.NoError(t, err)
+
+		errs, release := rep.Validate([]model.Metric{{ID: "Alloc", MType: GaugeName, Value: &value}})
+		require.Equal(t, []error{nil}, errs)
+
+		err = rep.Save(ctx, model.Metric{ID: "Sys", MType: GaugeName, Value: &value})
+		require.ErrorIs(t, err, ErrSeriesLimit)
+
+		require.NoError(t, rep.MassSave(ctx, []model.Metric{{ID: "Alloc", MType: GaugeName, Value: &value}}))
+		release()
+		require.Equal(t, 1, rep.Series())
+
+		_, release = rep.Validate([]model.Metric{{ID: "Sys", MType: GaugeName, Value: &value}})
+		release()
+		require.Empty(t, rep.pending)
+	})
+}
+
+func TestLimitedBatch(t *testing.T) {
+	t.Run("limited rejects too large batch", func(t *testing.T) {
+		ctx := context.Background()
+		var delta int64 = 1
+
+		rep, err := NewLimited(ctx, NewMemory(), Limits{MaxBatchSize: 1})
+		require.NoError(t, err)
+
+		err = rep.MassSave(ctx, []model.Metric{
+			{ID: "PollCount", MType: CounterName, Delta: &delta},
+			{ID: "PollCount", MType: CounterName, Delta: &delta},
+		})
+		require.ErrorIs(t, err, ErrBatchLimit)
+		require.Equal(t, int64(1), rep.Rejections()["batch_limit"])
+	})
+
+	t.Run("batch size is capped at the limit", func(t *testing.T) {
+		rep, err := NewLimited(context.Background(), NewMemory(), Limits{MaxBatchSize: 10})
+		require.NoError(t, err)
+
+		require.Equal(t, 10, BatchSize(NewNotified(rep), 1000))
+		require.Equal(t, 5, BatchSize(rep, 5))
+		require.Equal(t, 1000, BatchSize(NewMemory(), 1000))
+	})
+}
+
+func TestLimitedAs(t *testing.T) {
+	t.Run("decorated storage capabilities are found", func(t *testing.T) {
+		ctx := context.Background()
+
+		rep, err := NewLimited(ctx, NewMemory(), Limits{})
+		require.NoError(t, err)
+
+		_, ok := As[LimitReporter](rep)
+		require.True(t, ok)
+
+		_, ok = As[Snapshotter](rep)
+		require.False(t, ok)
+	})
+
+	t.Run("limited pattern compile error", func(t *testing.T) {
+		_, err := NewLimited(context.Background(), NewMemory(), Limits{NamePattern: "("})
+		require.Error(t, err)
+	})
+}
@@ -2,8 +2,9 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"strconv"
 	"sync"
 
@@ -15,6 +16,9 @@ const (
 	GaugeName   string = "gauge"
 )
 
+// shardCount is the number of independently locked parts of the memory storage.
+const shardCount = 32
+
 type gauge float64
 type counter int64
 
@@ -26,50 +30,75 @@ func (c counter) String() string {
 	return strconv.Itoa(int(c))
 }
 
-type memory struct {
+// memoryState is a point-in-time copy of the memory storage, it is also the format of the file snapshot.
+type memoryState struct {
 	Gauge   map[string]gauge
 	Counter map[string]counter
-	mutex   *sync.Mutex
+}
+
+type shard struct {
+	gauge   map[string]gauge
+	counter map[string]counter
+	mutex   sync.RWMutex
+}
+
+// memory keeps the metrics in shards selected by the metric name,
+// so writers of different metrics do not wait for each other.
+type memory struct {
+	shards []*shard
 }
 
 func NewMemory() *memory {
-	m := sync.Mutex{}
+	shards := make([]*shard, shardCount)
+	for i := range shards {
+		shards[i] = &shard{
+			gauge:   make(map[string]gauge),
+			counter: make(map[string]counter),
+		}
+	}
+
 	return &memory{
-		Gauge:   make(map[string]gauge),
-		Counter: make(map[string]counter),
-		mutex:   &m,
+		shards: shards,
 	}
 }
 
+func (s *memory) shard(name string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
 func (s *memory) Close() error {
 	return nil
 }
 
 func (s *memory) Save(_ context.Context, m model.Metric) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	if err := validate(m); err != nil {
+		return err
+	}
+
+	sh := s.shard(m.ID)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
 
 	switch m.MType {
 	case CounterName:
-		if m.Delta == nil {
-			return errors.New("counter has not value")
-		}
-		s.Counter[m.ID] += counter(*m.Delta)
+		sh.counter[m.ID] += counter(*m.Delta)
 	default:
-		if m.Value == nil {
-			return errors.New("gauge has not value")
-		}
-
-		s.Gauge[m.ID] = gauge(*m.Value)
+		sh.gauge[m.ID] = gauge(*m.Value)
 	}
 
 	return nil
 }
 
 func (s *memory) findGauge(name string) (model.Metric, error) {
-	val, ok := s.Gauge[name]
+	sh := s.shard(name)
+	sh.mutex.RLock()
+	val, ok := sh.gauge[name]
+	sh.mutex.RUnlock()
+
 	if !ok {
-		return model.Metric{}, fmt.Errorf("gauge with name %s not found", name)
+		return model.Metric{}, fmt.Errorf("%w: gauge with name %s", ErrNotFound, name)
 	}
 
 	value := float64(val)
@@ -83,9 +112,13 @@ func (s *memory) findGauge(name string) (model.Metric, error) {
 }
 
 func (s *memory) findCounter(name string) (model.Metric, error) {
-	val, ok := s.Counter[name]
+	sh := s.shard(name)
+	sh.mutex.RLock()
+	val, ok := sh.counter[name]
+	sh.mutex.RUnlock()
+
 	if !ok {
-		return model.Metric{}, fmt.Errorf("counter with name %s not found", name)
+		return model.Metric{}, fmt.Errorf("%w: counter with name %s", ErrNotFound, name)
 	}
 
 	value := int64(val)
@@ -107,28 +140,149 @@ func (s *memory) Find(_ context.Context, id string, mType string) (model.Metric,
 }
 
 func (s *memory) Get(_ context.Context) map[string]string {
-	all := make(map[string]string)
-	for name, val := range s.Gauge {
+	state := s.copyState()
+
+	all := make(map[string]string, len(state.Gauge)+len(state.Counter))
+	for name, val := range state.Gauge {
 		all[name] = val.String()
 	}
 
-	for name, val := range s.Counter {
+	for name, val := range state.Counter {
 		all[name] = val.String()
 	}
 
 	return all
 }
 
+// List returns the counters and then the gauges, both sorted by name.
+func (s *memory) List(_ context.Context) ([]model.Metric, error) {
+	state := s.copyState()
+
+	list := make([]model.Metric, 0, len(state.Gauge)+len(state.Counter))
+	for name, val := range state.Counter {
+		delta := int64(val)
+		list = append(list, model.Metric{ID: name, MType: CounterName, Delta: &delta})
+	}
+
+	for name, val := range state.Gauge {
+		value := float64(val)
+		list = append(list, model.Metric{ID: name, MType: GaugeName, Value: &value})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].MType != list[j].MType {
+			return list[i].MType < list[j].MType
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	return list, nil
+}
+
+// copyState returns a consistent copy of all the shards:
+// every shard is read locked before the first one is copied.
+func (s *memory) copyState() memoryState {
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+	}
+
+	defer func() {
+		for _, sh := range s.shards {
+			sh.mutex.RUnlock()
+		}
+	}()
+
+	state := memoryState{
+		Gauge:   make(map[string]gauge),
+		Counter: make(map[string]counter),
+	}
+
+	for _, sh := range s.shards {
+		for name, val := range sh.gauge {
+			state.Gauge[name] = val
+		}
+
+		for name, val := range sh.counter {
+			state.Counter[name] = val
+		}
+	}
+
+	return state
+}
+
+// loadState replaces the content of the storage with the state.
+func (s *memory) loadState(state memoryState) {
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+	}
+
+	defer func() {
+		for _, sh := range s.shards {
+			sh.mutex.Unlock()
+		}
+	}()
+
+	for _, sh := range s.shards {
+		sh.gauge = make(map[string]gauge)
+		sh.counter = make(map[string]counter)
+	}
+
+	for name, val := range state.Gauge {
+		s.shard(name).gauge[name] = val
+	}
+
+	for name, val := range state.Counter {
+		s.shard(name).counter[name] = val
+	}
+}
+
 func (s *memory) Ping(_ context.Context) error {
 	return nil
 }
 
-func (s *memory) MassSave(ctx context.Context, elems []model.Metric) error {
+// MassSave applies the whole batch or nothing: the metrics are validated first
+// and then written while all the affected shards are locked, so readers never see a part of the batch.
+func (s *memory) MassSave(_ context.Context, elems []model.Metric) error {
 	for _, m := range elems {
-		if err := s.Save(ctx, m); err != nil {
+		if err := validate(m); err != nil {
 			return fmt.Errorf("mass save failed: %w", err)
 		}
 	}
 
+	locked := s.lockShards(elems)
+	defer func() {
+		for _, sh := range locked {
+			sh.mutex.Unlock()
+		}
+	}()
+
+	for _, m := range elems {
+		sh := s.shard(m.ID)
+		switch m.MType {
+		case CounterName:
+			sh.counter[m.ID] += counter(*m.Delta)
+		default:
+			sh.gauge[m.ID] = gauge(*m.Value)
+		}
+	}
+
 	return nil
 }
+
+// lockShards locks the shards of the metrics in the order of the shards slice to avoid deadlocks.
+func (s *memory) lockShards(elems []model.Metric) []*shard {
+	used := make(map[*shard]struct{}, len(elems))
+	for _, m := range elems {
+		used[s.shard(m.ID)] = struct{}{}
+	}
+
+	locked := make([]*shard, 0, len(used))
+	for _, sh := range s.shards {
+		if _, ok := used[sh]; ok {
+			sh.mutex.Lock()
+			locked = append(locked, sh)
+		}
+	}
+
+	return locked
+}
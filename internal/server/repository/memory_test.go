@@ -2,9 +2,12 @@ package repository
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -271,4 +274,109 @@ func TestMemoryMassSave(t *testing.T) {
 		_, ok := saved[gauge.ID]
 		require.Equal(t, ok, false)
 	})
+
+	t.Run("memory mass save applies nothing when one metric is invalid", func(t *testing.T) {
+		ctx := context.Background()
+
+		var value float64 = 1
+		mtrs := []model.Metric{
+			{ID: "GaugeTest", MType: "gauge", Value: &value},
+			{ID: "CounterTest", MType: "counter"},
+		}
+
+		rep := NewMemory()
+		err := rep.MassSave(ctx, mtrs)
+		require.ErrorIs(t, err, ErrInvalid)
+		require.Empty(t, rep.Get(ctx))
+	})
+}
+
+func TestMemoryConcurrency(t *testing.T) {
+	t.Run("memory concurrent writes and reads", func(t *testing.T) {
+		const (
+			writers = 8
+			readers = 4
+			iters   = 1000
+		)
+
+		ctx := context.Background()
+		rep := NewMemory()
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+
+		for r := range readers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var last int64
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+
+					if r%2 == 0 {
+						_ = rep.Get(ctx)
+					}
+
+					state := rep.copyState()
+					current := int64(state.Counter["PollCount"])
+					assert.GreaterOrEqual(t, current, last)
+					last = current
+
+					_, _ = rep.Find(ctx, "Gauge"+strconv.Itoa(r), GaugeName)
+				}
+			}()
+		}
+
+		var writersWg sync.WaitGroup
+		for w := range writers {
+			writersWg.Add(1)
+			go func() {
+				defer writersWg.Done()
+				var delta int64 = 1
+				for i := range iters {
+					value := float64(i)
+					err := rep.MassSave(ctx, []model.Metric{
+						{ID: "PollCount", MType: CounterName, Delta: &delta},
+						{ID: "Gauge" + strconv.Itoa(w), MType: GaugeName, Value: &value},
+					})
+					assert.NoError(t, err)
+				}
+			}()
+		}
+
+		writersWg.Wait()
+		close(stop)
+		wg.Wait()
+
+		saved, err := rep.Find(ctx, "PollCount", CounterName)
+		require.NoError(t, err)
+		require.Equal(t, int64(writers*iters), *saved.Delta)
+
+		all := rep.Get(ctx)
+		require.Len(t, all, writers+1)
+	})
+}
+
+func TestMemoryLoadState(t *testing.T) {
+	t.Run("memory load state replaces content", func(t *testing.T) {
+		ctx := context.Background()
+
+		var value float64 = 1
+		rep := NewMemory()
+		err := rep.Save(ctx, model.Metric{ID: "Old", MType: GaugeName, Value: &value})
+		require.NoError(t, err)
+
+		rep.loadState(memoryState{
+			Gauge:   map[string]gauge{"Alloc": 2},
+			Counter: map[string]counter{"PollCount": 3},
+		})
+
+		state := rep.copyState()
+		require.Equal(t, map[string]gauge{"Alloc": 2}, state.Gauge)
+		require.Equal(t, map[string]counter{"PollCount": 3}, state.Counter)
+	})
 }
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// Notifier receives the metrics after they are saved. It is called on the write path,
+// so it must not block: a slow consumer has to queue or drop the metrics on its own.
+type Notifier interface {
+	Notify(ctx context.Context, elems []model.Metric)
+}
+
+// notified is a storage decorator that passes the saved metrics to the notifiers,
+// the counters carry the increment as it was written, not the resulting value.
+type notified struct {
+	Storage
+	notifiers []Notifier
+}
+
+// NewNotified wraps the storage, a failed write notifies nobody.
+func NewNotified(s Storage, n ...Notifier) *notified {
+	return &notified{
+		Storage:   s,
+		notifiers: n,
+	}
+}
+
+func (rep *notified) Unwrap() Storage {
+	return rep.Storage
+}
+
+func (rep *notified) notify(ctx context.Context, elems []model.Metric) {
+	for _, n := range rep.notifiers {
+		n.Notify(ctx, elems)
+	}
+}
+
+func (rep *notified) Save(ctx context.Context, m model.Metric) error {
+	if err := rep.Storage.Save(ctx, m); err != nil {
+		return err
+	}
+
+	rep.notify(ctx, []model.Metric{m})
+	return nil
+}
+
+func (rep *notified) MassSave(ctx context.Context, elems []model.Metric) error {
+	if err := rep.Storage.MassSave(ctx, elems); err != nil {
+		return err
+	}
+
+	rep.notify(ctx, elems)
+	return nil
+}
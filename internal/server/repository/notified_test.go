@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+type notes struct {
+	saved []model.Metric
+}
+
+func (n *notes) Notify(_ context.Context, elems []model.Metric) {
+	n.saved = append(n.saved, elems...)
+}
+
+func TestNotified(t *testing.T) {
+	ctx := context.Background()
+	value := 1.0
+	m := model.Metric{ID: "Alloc", MType: GaugeName, Value: &value}
+
+	n := &notes{}
+	rep := NewNotified(NewMemory(), n)
+
+	require.NoError(t, rep.Save(ctx, m))
+	require.NoError(t, rep.MassSave(ctx, []model.Metric{m, m}))
+	require.Len(t, n.saved, 3)
+
+	t.Run("failed write notifies nobody", func(t *testing.T) {
+		require.Error(t, rep.MassSave(ctx, []model.Metric{m, {ID: "Broken", MType: GaugeName}}))
+		require.Len(t, n.saved, 3)
+	})
+
+	t.Run("notified keeps the decorators reachable", func(t *testing.T) {
+		_, ok := As[Lister](rep)
+		require.True(t, ok)
+	})
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// StorageObserver receives the duration of every storage call.
+type StorageObserver interface {
+	ObserveStorage(backend, method string, d time.Duration)
+}
+
+// SnapshotObserver receives the duration and the result of every snapshot written to the disk.
+type SnapshotObserver interface {
+	ObserveSnapshot(err error, d time.Duration)
+}
+
+// PoolReporter is implemented by storages backed by a database connection pool.
+type PoolReporter interface {
+	PoolStats() sql.DBStats
+}
+
+// observed is a storage decorator that measures the latency of the wrapped storage.
+type observed struct {
+	Storage
+	observer StorageObserver
+	backend  string
+}
+
+// NewObserved wraps the storage, the calls are reported under the backend name.
+func NewObserved(s Storage, backend string, o StorageObserver) *observed {
+	return &observed{
+		Storage:  s,
+		observer: o,
+		backend:  backend,
+	}
+}
+
+func (rep *observed) Unwrap() Storage {
+	return rep.Storage
+}
+
+func (rep *observed) observe(method string, start time.Time) {
+	rep.observer.ObserveStorage(rep.backend, method, time.Since(start))
+}
+
+func (rep *observed) Save(ctx context.Context, m model.Metric) error {
+	defer rep.observe("Save", time.Now())
+	return rep.Storage.Save(ctx, m)
+}
+
+func (rep *observed) MassSave(ctx context.Context, elems []model.Metric) error {
+	defer rep.observe("MassSave", time.Now())
+	return rep.Storage.MassSave(ctx, elems)
+}
+
+func (rep *observed) Find(ctx context.Context, id string, mType string) (model.Metric, error) {
+	defer rep.observe("Find", time.Now())
+	return rep.Storage.Find(ctx, id, mType)
+}
+
+func (rep *observed) Get(ctx context.Context) map[string]string {
+	defer rep.observe("Get", time.Now())
+	return rep.Storage.Get(ctx)
+}
+
+func (rep *observed) Ping(ctx context.Context) error {
+	defer rep.observe("Ping", time.Now())
+	return rep.Storage.Ping(ctx)
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/logger"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	calls     []string
+	snapshots []error
+	mutex     sync.Mutex
+}
+
+func (r *recorder) ObserveStorage(backend, method string, _ time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.calls = append(r.calls, backend+" "+method)
+}
+
+func (r *recorder) ObserveSnapshot(err error, _ time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.snapshots = append(r.snapshots, err)
+}
+
+func TestObserved(t *testing.T) {
+	t.Run("observed reports every call", func(t *testing.T) {
+		ctx := context.Background()
+		var value float64 = 1
+		m := model.Metric{ID: "Alloc", MType: GaugeName, Value: &value}
+
+		r := &recorder{}
+		rep := NewObserved(NewMemory(), "memory", r)
+
+		require.NoError(t, rep.Save(ctx, m))
+		require.NoError(t, rep.MassSave(ctx, []model.Metric{m}))
+		_, err := rep.Find(ctx, "Alloc", GaugeName)
+		require.NoError(t, err)
+		rep.Get(ctx)
+		require.NoError(t, rep.Ping(ctx))
+
+		require.Equal(t, []string{
+			"memory Save", "memory MassSave", "memory Find", "memory Get", "memory Ping",
+		}, r.calls)
+	})
+
+	t.Run("observed keeps the decorators reachable", func(t *testing.T) {
+		ctx := context.Background()
+		l, err := NewLimited(ctx, NewMemory(), Limits{})
+		require.NoError(t, err)
+
+		rep := NewObserved(l, "memory", &recorder{})
+		_, ok := As[LimitReporter](rep)
+		require.True(t, ok)
+	})
+
+	t.Run("file reports snapshots", func(t *testing.T) {
+		ctx := context.Background()
+		cLog, err := logger.Build("debug")
+		require.NoError(t, err)
+
+		r := &recorder{}
+		rep, err := NewFile(1, filepath.Join(t.TempDir(), "storage_test.json"), false, cLog)
+		require.NoError(t, err)
+		rep.WithObserver(r)
+		defer func() {
+			require.NoError(t, rep.Close())
+		}()
+
+		require.NoError(t, rep.Snapshot(ctx))
+		require.Equal(t, []error{nil}, r.snapshots)
+	})
+}
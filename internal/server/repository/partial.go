@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// Validator is implemented by storage decorators that reject metrics before they reach the storage,
+// it returns the error of every metric of the batch, nil for the accepted ones.
+// The accepted metrics keep their place in the limits of the decorator until the release is called.
+type Validator interface {
+	Validate(elems []model.Metric) ([]error, func())
+}
+
+// Check runs the validation of every storage in the chain of decorators for the batch,
+// a metric rejected by one storage is not passed to the next one.
+// The release must be called once the accepted metrics are saved or given up.
+func Check(s Storage, elems []model.Metric) ([]error, func()) {
+	releases := make([]func(), 0)
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+
+	errs := make([]error, len(elems))
+	for i, m := range elems {
+		errs[i] = validate(m)
+	}
+
+	for s != nil {
+		if v, ok := s.(Validator); ok {
+			index := make([]int, 0, len(elems))
+			valid := make([]model.Metric, 0, len(elems))
+			for i, m := range elems {
+				if errs[i] == nil {
+					index = append(index, i)
+					valid = append(valid, m)
+				}
+			}
+
+			validated, r := v.Validate(valid)
+			releases = append(releases, r)
+			for i, err := range validated {
+				errs[index[i]] = err
+			}
+		}
+
+		u, ok := s.(Unwrapper)
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+
+	return errs, release
+}
+
+// MassSavePartial saves the valid metrics of the batch and reports the status of every metric.
+// The valid metrics are still saved with a single MassSave, so they are applied all together or not at all.
+// An error is returned only when the batch can not be processed as a whole.
+func MassSavePartial(ctx context.Context, s Storage, elems []model.Metric) ([]model.Result, error) {
+	results := make([]model.Result, len(elems))
+	valid := make([]model.Metric, 0, len(elems))
+	accepted := make([]int, 0, len(elems))
+
+	errs, release := Check(s, elems)
+	defer release()
+
+	for i, m := range elems {
+		results[i] = model.Result{ID: m.ID, MType: m.MType, Status: model.ResultAccepted}
+		if err := errs[i]; err != nil {
+			results[i].Status = model.ResultRejected
+			results[i].Reason = err.Error()
+			continue
+		}
+
+		valid = append(valid, m)
+		accepted = append(accepted, i)
+	}
+
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	err := s.MassSave(ctx, valid)
+	switch {
+	case err == nil:
+		return results, nil
+	case errors.Is(err, ErrInvalid), errors.Is(err, ErrSeriesLimit):
+		for _, i := range accepted {
+			results[i].Status = model.ResultRejected
+			results[i].Reason = err.Error()
+		}
+		return results, nil
+	default:
+		return nil, fmt.Errorf("partial mass save failed: %w", err)
+	}
+}
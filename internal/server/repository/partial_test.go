@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassSavePartial(t *testing.T) {
+	var value float64 = 1
+	var delta int64 = 1
+
+	t.Run("partial save keeps the valid metrics", func(t *testing.T) {
+		ctx := context.Background()
+		rep, err := NewLimited(ctx, NewMemory(), Limits{NamePattern: `^[A-Za-z]+$`, MaxSeries: 2})
+		require.NoError(t, err)
+
+		results, err := MassSavePartial(ctx, rep, []model.Metric{
+			{ID: "Alloc", MType: GaugeName, Value: &value},
+			{ID: "Alloc Sys", MType: GaugeName, Value: &value},
+			{ID: "PollCount", MType: CounterName},
+			{ID: "PollCount", MType: CounterName, Delta: &delta},
+			{ID: "Frees", MType: GaugeName, Value: &value},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 5)
+
+		statuses := make([]string, 0, len(results))
+		for _, r := range results {
+			statuses = append(statuses, r.Status)
+		}
+		require.Equal(t, []string{
+			model.ResultAccepted,
+			model.ResultRejected,
+			model.ResultRejected,
+			model.ResultAccepted,
+			model.ResultRejected,
+		}, statuses)
+		require.NotEmpty(t, results[1].Reason)
+
+		require.Equal(t, map[string]string{"Alloc": "1", "PollCount": "1"}, rep.Get(ctx))
+	})
+
+	t.Run("partial save fails when the batch is too large", func(t *testing.T) {
+		ctx := context.Background()
+		rep, err := NewLimited(ctx, NewMemory(), Limits{MaxBatchSize: 1})
+		require.NoError(t, err)
+
+		_, err = MassSavePartial(ctx, rep, []model.Metric{
+			{ID: "Alloc", MType: GaugeName, Value: &value},
+			{ID: "Frees", MType: GaugeName, Value: &value},
+		})
+		require.ErrorIs(t, err, ErrBatchLimit)
+		require.Empty(t, rep.Get(ctx))
+	})
+}
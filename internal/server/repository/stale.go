@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// maxSources bounds the memory of the source tracking, the sources seen after the limit is reached are not listed.
+const maxSources = 10000
+
+// Staleness configures the detection of the metrics nobody writes anymore.
+type Staleness struct {
+	TTL  time.Duration `json:"ttl"`  // a metric or a source not written for this long is stale
+	Hide bool          `json:"hide"` // stale metrics are not found, otherwise they are only flagged
+}
+
+// Source is a client writing into the storage: an agent, a Graphite connection or a gRPC peer.
+type Source struct {
+	LastSeen time.Time `json:"last_seen"`
+	Name     string    `json:"name"`
+	Writes   int64     `json:"writes"` // number of metrics written since the server started
+	Silent   bool      `json:"silent"` // nothing was written by the source for the TTL
+}
+
+// StaleReporter is implemented by storages that track the time of the last write.
+type StaleReporter interface {
+	Staleness() Staleness
+	Stale(id string, mType string) bool
+	Sources() []Source
+}
+
+type sourceKey struct{}
+
+// WithSource names the client the writes of the context come from.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFrom returns the client named by WithSource, empty for the writes of the server itself.
+func SourceFrom(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+	return source
+}
+
+type metricKey struct {
+	mType string
+	name  string
+}
+
+// stale is a storage decorator that remembers when every metric and every source was written last.
+// The metrics kept by the storage before the server started are taken as written at the start.
+type stale struct {
+	Storage
+	started time.Time
+	seen    map[metricKey]time.Time
+	sources map[string]*Source
+	now     func() time.Time
+	mutex   *sync.RWMutex
+	opts    Staleness
+}
+
+// NewStale wraps the storage, the TTL must be positive.
+func NewStale(s Storage, opts Staleness) (*stale, error) {
+	if opts.TTL <= 0 {
+		return nil, fmt.Errorf("stale ttl must be positive, got %s", opts.TTL)
+	}
+
+	return &stale{
+		Storage: s,
+		started: time.Now(),
+		seen:    make(map[metricKey]time.Time),
+		sources: make(map[string]*Source),
+		now:     time.Now,
+		mutex:   &sync.RWMutex{},
+		opts:    opts,
+	}, nil
+}
+
+func (rep *stale) Unwrap() Storage {
+	return rep.Storage
+}
+
+func (rep *stale) Save(ctx context.Context, m model.Metric) error {
+	if err := rep.Storage.Save(ctx, m); err != nil {
+		return fmt.Errorf("stale save failed: %w", err)
+	}
+
+	rep.touch(SourceFrom(ctx), m)
+	return nil
+}
+
+func (rep *stale) MassSave(ctx context.Context, elems []model.Metric) error {
+	if err := rep.Storage.MassSave(ctx, elems); err != nil {
+		return fmt.Errorf("stale mass save failed: %w", err)
+	}
+
+	rep.touch(SourceFrom(ctx), elems...)
+	return nil
+}
+
+// Find does not find the stale metrics when they are hidden.
+func (rep *stale) Find(ctx context.Context, id string, mType string) (model.Metric, error) {
+	m, err := rep.Storage.Find(ctx, id, mType)
+	if err != nil {
+		return m, err
+	}
+
+	if rep.opts.Hide && rep.Stale(id, mType) {
+		return model.Metric{}, fmt.Errorf("%w: %s %s is stale", ErrNotFound, mType, id)
+	}
+
+	return m, nil
+}
+
+// Unhidden returns the storage under the hiding of the stale metrics, for the readers that need the last value
+// of every metric: the alert on a hidden metric would neither fire nor resolve. Other storages are returned as is.
+func Unhidden(s Storage) Storage {
+	if rep, ok := As[*stale](s); ok && rep.opts.Hide {
+		return rep.Storage
+	}
+
+	return s
+}
+
+// Get drops the names stale under both types when the stale metrics are hidden.
+func (rep *stale) Get(ctx context.Context) map[string]string {
+	all := rep.Storage.Get(ctx)
+	if !rep.opts.Hide {
+		return all
+	}
+
+	for name := range all {
+		if rep.Stale(name, CounterName) && rep.Stale(name, GaugeName) {
+			delete(all, name)
+		}
+	}
+
+	return all
+}
+
+func (rep *stale) touch(source string, elems ...model.Metric) {
+	now := rep.now()
+
+	rep.mutex.Lock()
+	defer rep.mutex.Unlock()
+
+	for _, m := range elems {
+		rep.seen[metricKey{mType: m.MType, name: m.ID}] = now
+	}
+
+	if source == "" {
+		return
+	}
+
+	s, ok := rep.sources[source]
+	if !ok {
+		if len(rep.sources) >= maxSources {
+			return
+		}
+		s = &Source{Name: source}
+		rep.sources[source] = s
+	}
+	s.LastSeen = now
+	s.Writes += int64(len(elems))
+}
+
+func (rep *stale) Staleness() Staleness {
+	return rep.opts
+}
+
+// Stale reports whether the metric was not written for the TTL.
+func (rep *stale) Stale(id string, mType string) bool {
+	rep.mutex.RLock()
+	last, ok := rep.seen[metricKey{mType: mType, name: id}]
+	rep.mutex.RUnlock()
+
+	if !ok {
+		last = rep.started
+	}
+
+	return rep.now().Sub(last) > rep.opts.TTL
+}
+
+// Sources returns the clients that wrote into the storage since the server started, sorted by name.
+func (rep *stale) Sources() []Source {
+	now := rep.now()
+
+	rep.mutex.RLock()
+	defer rep.mutex.RUnlock()
+
+	sources := make([]Source, 0, len(rep.sources))
+	for _, s := range rep.sources {
+		source := *s
+		source.Silent = now.Sub(s.LastSeen) > rep.opts.TTL
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+
+	return sources
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStale(t *testing.T) {
+	var value float64 = 1
+	alloc := model.Metric{ID: "Alloc", MType: GaugeName, Value: &value}
+	sys := model.Metric{ID: "Sys", MType: GaugeName, Value: &value}
+
+	tests := []struct {
+		name string
+		hide bool
+	}{
+		{name: "stale metrics are flagged", hide: false},
+		{name: "stale metrics are hidden", hide: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rep, err := NewStale(NewMemory(), Staleness{TTL: time.Minute, Hide: tt.hide})
+			require.NoError(t, err)
+
+			now := time.Now()
+			rep.now = func() time.Time { return now }
+
+			require.NoError(t, rep.MassSave(WithSource(ctx, "10.0.0.1"), []model.Metric{alloc, sys}))
+			now = now.Add(45 * time.Second)
+			require.NoError(t, rep.Save(WithSource(ctx, "10.0.0.2"), sys))
+			now = now.Add(30 * time.Second)
+
+			require.True(t, rep.Stale("Alloc", GaugeName))
+			require.False(t, rep.Stale("Sys", GaugeName))
+
+			require.Equal(t, []Source{
+				{Name: "10.0.0.1", LastSeen: now.Add(-75 * time.Second), Writes: 2, Silent: true},
+				{Name: "10.0.0.2", LastSeen: now.Add(-30 * time.Second), Writes: 1, Silent: false},
+			}, rep.Sources())
+
+			_, err = rep.Find(ctx, "Alloc", GaugeName)
+			_, found := rep.Get(ctx)["Alloc"]
+			var buf bytes.Buffer
+			n, exportErr := Export(ctx, rep, &buf)
+			require.NoError(t, exportErr)
+
+			if tt.hide {
+				require.ErrorIs(t, err, ErrNotFound)
+				require.False(t, found)
+				require.Equal(t, 1, n)
+				require.JSONEq(t, `{"id":"Sys","type":"gauge","value":1}`, buf.String())
+				return
+			}
+
+			require.NoError(t, err)
+			require.True(t, found)
+			require.Equal(t, 2, n)
+			require.Contains(t, buf.String(), `{"value":1,"id":"Alloc","type":"gauge","stale":true}`)
+		})
+	}
+
+	t.Run("metrics kept before the start are stale after the ttl", func(t *testing.T) {
+		ctx := context.Background()
+		mem := NewMemory()
+		require.NoError(t, mem.Save(ctx, alloc))
+
+		rep, err := NewStale(mem, Staleness{TTL: time.Minute})
+		require.NoError(t, err)
+		require.False(t, rep.Stale("Alloc", GaugeName))
+
+		rep.now = func() time.Time { return rep.started.Add(2 * time.Minute) }
+		require.True(t, rep.Stale("Alloc", GaugeName))
+		require.Empty(t, rep.Sources())
+
+		sr, ok := As[StaleReporter](NewNotified(rep))
+		require.True(t, ok)
+		require.Equal(t, time.Minute, sr.Staleness().TTL)
+	})
+
+	t.Run("unhidden storage finds the stale metrics", func(t *testing.T) {
+		ctx := context.Background()
+		mem := NewMemory()
+		require.NoError(t, mem.Save(ctx, alloc))
+
+		rep, err := NewStale(mem, Staleness{TTL: time.Minute, Hide: true})
+		require.NoError(t, err)
+		rep.now = func() time.Time { return rep.started.Add(2 * time.Minute) }
+
+		s := NewNotified(rep)
+		_, err = s.Find(ctx, "Alloc", GaugeName)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		m, err := Unhidden(s).Find(ctx, "Alloc", GaugeName)
+		require.NoError(t, err)
+		require.InDelta(t, 1, *m.Value, 1e-9)
+
+		require.Equal(t, Storage(mem), Unhidden(mem))
+	})
+
+	t.Run("ttl is required", func(t *testing.T) {
+		_, err := NewStale(NewMemory(), Staleness{})
+		require.Error(t, err)
+	})
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 
+	"github.com/arefev/mtrcstore/internal/breaker"
 	"github.com/arefev/mtrcstore/internal/server/model"
 )
 
@@ -14,3 +15,42 @@ type Storage interface {
 	Ping(ctx context.Context) error
 	Close() error
 }
+
+// Snapshotter is implemented by storages that can persist their state on demand.
+type Snapshotter interface {
+	Snapshot(ctx context.Context) error
+}
+
+// Lister is implemented by storages that can return all the metrics with their types,
+// unlike Get it keeps a gauge and a counter of the same name apart.
+type Lister interface {
+	List(ctx context.Context) ([]model.Metric, error)
+}
+
+// BreakerReporter is implemented by storages protected by circuit breakers.
+type BreakerReporter interface {
+	Breakers() []breaker.Status
+}
+
+// Unwrapper is implemented by storage decorators.
+type Unwrapper interface {
+	Unwrap() Storage
+}
+
+// As finds the first storage in the chain of decorators that implements T.
+func As[T any](s Storage) (T, bool) {
+	for s != nil {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+
+		u, ok := s.(Unwrapper)
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
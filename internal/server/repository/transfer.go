@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// importBatchSize is the number of metrics saved by a single MassSave of the import,
+// fewer when the storage limits the batch size.
+const importBatchSize = 1000
+
+var ErrNotListable = errors.New("storage can not list its metrics")
+
+// ImportResult is the number of the metrics loaded and rejected by Import.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Rejected int `json:"rejected"`
+}
+
+// exportRecord is a line of the export, Import ignores the stale flag.
+type exportRecord struct {
+	model.Metric
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Export writes every metric of the storage as a line of JSON in the format of the /update/ requests.
+// When the storage tracks the staleness, the stale metrics are either skipped or flagged.
+func Export(ctx context.Context, s Storage, w io.Writer) (int, error) {
+	l, ok := As[Lister](s)
+	if !ok {
+		return 0, ErrNotListable
+	}
+
+	list, err := l.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("export failed: %w", err)
+	}
+
+	sr, tracked := As[StaleReporter](s)
+
+	n := 0
+	enc := json.NewEncoder(w)
+	for _, m := range list {
+		record := exportRecord{Metric: m}
+		if tracked {
+			record.Stale = sr.Stale(m.ID, m.MType)
+			if record.Stale && sr.Staleness().Hide {
+				continue
+			}
+		}
+
+		if err := enc.Encode(record); err != nil {
+			return n, fmt.Errorf("export failed: %w", err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// Import loads the lines written by Export in batches, the metrics rejected by the storage
+// are counted and skipped. The counters are added to the existing values,
+// so a repeated import into the same storage doubles them.
+func Import(ctx context.Context, s Storage, r io.Reader) (ImportResult, error) {
+	var res ImportResult
+
+	size := BatchSize(s, importBatchSize)
+	batch := make([]model.Metric, 0, size)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		results, err := MassSavePartial(ctx, s, batch)
+		if err != nil {
+			return fmt.Errorf("import failed: %w", err)
+		}
+
+		for _, r := range results {
+			if r.Status == model.ResultRejected {
+				res.Rejected++
+			} else {
+				res.Imported++
+			}
+		}
+		batch = batch[:0]
+
+		return nil
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for record := 1; ; record++ {
+		var m model.Metric
+		err := dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("%w: import record %d: %w", ErrInvalid, record, err)
+		}
+
+		if batch = append(batch, m); len(batch) == size {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	return res, flush()
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	value, delta := 1.5, int64(3)
+
+	source := NewMemory()
+	require.NoError(t, source.MassSave(ctx, []model.Metric{
+		{ID: "Alloc", MType: GaugeName, Value: &value},
+		{ID: "Alloc", MType: CounterName, Delta: &delta},
+		{ID: "PollCount", MType: CounterName, Delta: &delta},
+	}))
+
+	var buf bytes.Buffer
+	n, err := Export(ctx, source, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, []string{
+		`{"delta":3,"id":"Alloc","type":"counter"}`,
+		`{"delta":3,"id":"PollCount","type":"counter"}`,
+		`{"value":1.5,"id":"Alloc","type":"gauge"}`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+
+	target := NewMemory()
+	res, err := Import(ctx, target, &buf)
+	require.NoError(t, err)
+	require.Equal(t, ImportResult{Imported: 3}, res)
+
+	got, err := target.List(ctx)
+	require.NoError(t, err)
+	want, err := source.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	t.Run("invalid record", func(t *testing.T) {
+		res, err := Import(ctx, NewMemory(), strings.NewReader(`{"id":"a","type":"gauge","value":1}`+"\n{"))
+		require.ErrorIs(t, err, ErrInvalid)
+		require.Equal(t, 0, res.Imported)
+	})
+
+	t.Run("rejected metric", func(t *testing.T) {
+		res, err := Import(ctx, NewMemory(), strings.NewReader(`{"id":"a","type":"gauge"}`))
+		require.NoError(t, err)
+		require.Equal(t, ImportResult{Rejected: 1}, res)
+	})
+
+	t.Run("chunks fit the batch limit", func(t *testing.T) {
+		rep, err := NewLimited(ctx, NewMemory(), Limits{MaxBatchSize: 2})
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		for i := range 5 {
+			fmt.Fprintf(&buf, `{"delta":1,"id":"PollCount%d","type":"counter"}`+"\n", i)
+		}
+
+		res, err := Import(ctx, rep, &buf)
+		require.NoError(t, err)
+		require.Equal(t, ImportResult{Imported: 5}, res)
+	})
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// wal is an append-only log of the metrics saved since the last snapshot.
+// Every record is a single JSON-encoded walRecord terminated by a new line.
+type wal struct {
+	file *os.File
+	path string
+	seq  uint64 // sequence of the last appended record
+}
+
+// walRecord is a metric with its sequence, the sequences grow across the resets of the log.
+// The records written before the sequences were introduced have none and are always replayed.
+type walRecord struct {
+	model.Metric
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+func openWAL(path string, perm fs.FileMode) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return nil, fmt.Errorf("wal open failed: %w", err)
+	}
+
+	return &wal{
+		file: f,
+		path: path,
+	}, nil
+}
+
+// append writes the records with a single write call and flushes them to the disk.
+func (w *wal) append(elems ...model.Metric) error {
+	if w == nil {
+		return errors.New("wal append failed: wal is not opened")
+	}
+
+	if len(elems) == 0 {
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	seq := w.seq
+	for _, m := range elems {
+		seq++
+		if err := enc.Encode(walRecord{Metric: m, Seq: seq}); err != nil {
+			return fmt.Errorf("wal encode record failed: %w", err)
+		}
+	}
+
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("wal write failed: %w", err)
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal sync failed: %w", err)
+	}
+	w.seq = seq
+
+	return nil
+}
+
+// replay calls apply for every record after the sequence in the order they were written,
+// the earlier records are already in the snapshot the sequence comes from.
+// A torn or corrupted record is treated as the end of the log: the file is truncated
+// at the last valid record, so the following appends are not written after the garbage.
+func (w *wal) replay(after uint64, apply func(m model.Metric) error) (int, error) {
+	if w == nil {
+		return 0, errors.New("wal replay failed: wal is not opened")
+	}
+	w.seq = max(w.seq, after)
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("wal seek failed: %w", err)
+	}
+
+	res, err := readWAL(w.file, after, apply)
+	w.seq = max(w.seq, res.seq)
+	if res.tail != nil {
+		return res.count, w.truncate(res.offset, res.tail)
+	}
+
+	return res.count, err
+}
+
+// walRead is the outcome of reading a log, tail is why the records from offset on were not applied.
+type walRead struct {
+	tail   error
+	offset int64
+	seq    uint64
+	count  int
+}
+
+// readWAL applies the records after the sequence until the end of the log or the first invalid record.
+func readWAL(src io.Reader, after uint64, apply func(m model.Metric) error) (walRead, error) {
+	var res walRead
+
+	r := bufio.NewReader(src)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				res.tail = errors.New("wal last record is incomplete")
+			}
+			return res, nil
+		}
+
+		if err != nil {
+			return res, fmt.Errorf("wal read failed: %w", err)
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			res.tail = fmt.Errorf("wal decode record failed: %w", err)
+			return res, nil
+		}
+
+		if rec.Seq == 0 || rec.Seq > after {
+			if err := apply(rec.Metric); err != nil {
+				res.tail = fmt.Errorf("wal apply record failed: %w", err)
+				return res, nil
+			}
+
+			res.seq = max(res.seq, rec.Seq)
+			res.count++
+		}
+
+		res.offset += int64(len(line))
+	}
+}
+
+// truncate drops everything after offset and returns the reason why it was needed.
+func (w *wal) truncate(offset int64, reason error) error {
+	if err := w.file.Truncate(offset); err != nil {
+		return fmt.Errorf("wal truncate failed: %w", err)
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal sync failed: %w", err)
+	}
+
+	return fmt.Errorf("%w, log truncated at offset %d", reason, offset)
+}
+
+// reset empties the log, it is called after a snapshot is written.
+func (w *wal) reset() error {
+	if w == nil {
+		return errors.New("wal reset failed: wal is not opened")
+	}
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("wal reset failed: %w", err)
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal sync failed: %w", err)
+	}
+
+	return nil
+}
+
+func (w *wal) close() error {
+	if w == nil {
+		return nil
+	}
+
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("wal close failed: %w", err)
+	}
+
+	return nil
+}
+
+// writeAtomic writes data to a temporary file in the same directory and renames it
+// over path, so readers see either the old or the new content but never a partial one.
+func writeAtomic(path string, perm fs.FileMode, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write atomic create temp failed: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return fmt.Errorf("write atomic write failed: %w", err)
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("write atomic chmod failed: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("write atomic sync failed: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("write atomic close failed: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write atomic rename failed: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir flushes the directory entry, so the rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("sync dir open failed: %w", err)
+	}
+
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return fmt.Errorf("sync dir failed: %w", err)
+	}
+
+	if err := d.Close(); err != nil {
+		return fmt.Errorf("sync dir close failed: %w", err)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/arefev/mtrcstore/internal/server/dashboard"
 	"github.com/arefev/mtrcstore/internal/server/handler"
 	"github.com/arefev/mtrcstore/internal/server/middleware"
 	"github.com/go-chi/chi/v5"
@@ -12,7 +13,12 @@ import (
 func InitRouter(h *handler.MetricHandlers, log *zap.Logger, cidr string, secretKey string, cryptoKey string) *chi.Mux {
 	m := middleware.NewMiddleware(log, cidr, secretKey, cryptoKey)
 	r := chi.NewRouter()
+	r.Use(m.Trace)
+	if h.Stats != nil {
+		r.Use(middleware.Observe(h.Stats))
+	}
 	r.Use(m.IsPrivateIP)
+	r.Use(m.Source)
 	r.Use(m.Logger)
 	r.Use(m.Decrypt)
 	r.Use(m.Compress)
@@ -21,6 +27,8 @@ func InitRouter(h *handler.MetricHandlers, log *zap.Logger, cidr string, secretK
 
 	r.Get("/", h.Get)
 	r.Get("/ping", h.Ping)
+	r.Get("/stream", h.Stream)
+	r.Get("/alerts", h.Alerts)
 
 	r.Route("/value", func(r chi.Router) {
 		r.Get("/{type}/{name}", h.Find)
@@ -33,6 +41,27 @@ func InitRouter(h *handler.MetricHandlers, log *zap.Logger, cidr string, secretK
 	})
 
 	r.Post("/updates/", h.Updates)
+	r.Post("/v1/metrics", h.OTLP)
+	r.Post("/api/v1/write", h.RemoteWrite)
+	r.Post("/write", h.InfluxWrite)
+
+	r.Route("/dashboard", func(r chi.Router) {
+		r.Get("/metric/{type}/{name}", h.MetricPage)
+		r.Get("/api/metrics", h.DashboardData)
+		r.Handle("/static/*", dashboard.Static("/dashboard/static/"))
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Post("/snapshot", h.Snapshot)
+		r.Get("/limits", h.Limits)
+		r.Get("/breakers", h.Breakers)
+		r.Get("/stats", h.StatsSnapshot)
+		r.Get("/sources", h.Sources)
+		r.Get("/forward", h.Forward)
+		r.Get("/relay", h.RelayStatus)
+		r.Get("/export", h.Export)
+		r.Post("/import", h.Import)
+	})
 
 	return r
 }
@@ -45,3 +45,20 @@ func (c *compressWriter) Close() error {
 	}
 	return nil
 }
+
+// FlushError sends the compressed data written so far, so the streamed responses reach the client.
+func (c *compressWriter) FlushError() error {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	if err := c.zw.Flush(); err != nil {
+		return fmt.Errorf("compressWriter Flush failed: %w", err)
+	}
+
+	if err := http.NewResponseController(c.ResponseWriter).Flush(); err != nil {
+		return fmt.Errorf("compressWriter Flush failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/ingest"
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	graphiteBatchSize     = 1000
+	graphiteFlushInterval = time.Second
+	graphiteIdleTimeout   = 5 * time.Minute
+)
+
+// GraphiteServer receives the Graphite plaintext protocol over TCP.
+// The lines of a connection are saved in batches, every second or every thousand lines,
+// fewer when the storage limits the batch size. The connections over MaxConns are closed right after accept.
+type GraphiteServer struct {
+	Storage  repository.Storage
+	Graphite *ingest.Graphite
+	Log      *zap.Logger
+	MaxConns int
+}
+
+// Serve accepts the connections until the context is done, then closes the listener and the open connections
+// and returns when their last batches are saved.
+func (gs *GraphiteServer) Serve(ctx context.Context, listen net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// the batches left on close are saved past the serve context
+	saveCtx := context.WithoutCancel(ctx)
+	conns := make(map[net.Conn]struct{})
+	mutex := &sync.Mutex{}
+
+	go func() {
+		<-ctx.Done()
+		if err := listen.Close(); err != nil {
+			gs.Log.Error("graphite listener close failed", zap.Error(err))
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("graphite accept failed: %w", err)
+		}
+
+		mutex.Lock()
+		if ctx.Err() != nil || (gs.MaxConns > 0 && len(conns) >= gs.MaxConns) {
+			mutex.Unlock()
+			gs.Log.Warn("graphite connection refused", zap.String("remote", conn.RemoteAddr().String()))
+			_ = conn.Close()
+			continue
+		}
+		conns[conn] = struct{}{}
+		mutex.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gs.handle(saveCtx, conn)
+
+			mutex.Lock()
+			delete(conns, conn)
+			mutex.Unlock()
+		}()
+	}
+}
+
+// handle reads the lines in a goroutine of its own, so a quiet connection still gets its batch saved.
+func (gs *GraphiteServer) handle(ctx context.Context, conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	log := gs.Log.With(zap.String("remote", conn.RemoteAddr().String()))
+	ctx = repository.WithSource(ctx, host(conn.RemoteAddr()))
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(conn)
+		for {
+			if err := conn.SetReadDeadline(time.Now().Add(graphiteIdleTimeout)); err != nil {
+				return
+			}
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+					log.Debug("graphite connection read failed", zap.Error(err))
+				}
+				return
+			}
+			lines <- scanner.Text()
+		}
+	}()
+
+	ticker := time.NewTicker(graphiteFlushInterval)
+	defer ticker.Stop()
+
+	size := repository.BatchSize(gs.Storage, graphiteBatchSize)
+	batch := make([]model.Metric, 0, size)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				gs.save(ctx, batch, log)
+				return
+			}
+
+			m, err := gs.Graphite.Metric(line)
+			if err != nil {
+				log.Warn("graphite line rejected", zap.String("line", line), zap.Error(err))
+				continue
+			}
+
+			if batch = append(batch, m); len(batch) >= size {
+				gs.save(ctx, batch, log)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			gs.save(ctx, batch, log)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (gs *GraphiteServer) save(ctx context.Context, batch []model.Metric, log *zap.Logger) {
+	if len(batch) == 0 {
+		return
+	}
+
+	results, err := repository.MassSavePartial(ctx, gs.Storage, batch)
+	if err != nil {
+		log.Error("graphite save failed", zap.Int("metrics", len(batch)), zap.Error(err))
+		return
+	}
+
+	for _, r := range results {
+		if r.Status == model.ResultRejected {
+			log.Warn("graphite metric rejected", zap.String("name", r.ID), zap.String("reason", r.Reason))
+		}
+	}
+}
+
+// host is the address without the port, so the reconnects of a client are the same source.
+func host(addr net.Addr) string {
+	h, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return h
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arefev/mtrcstore/internal/server/ingest"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestGraphiteServe(t *testing.T) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	rules, err := ingest.ParseGraphiteRules("servers.*.load=load.host.$1")
+	require.NoError(t, err)
+
+	storage := repository.NewMemory()
+	gs := &GraphiteServer{Storage: storage, Graphite: ingest.NewGraphite(rules), Log: zap.NewNop(), MaxConns: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- gs.Serve(ctx, listen)
+	}()
+
+	conn, err := net.Dial("tcp", listen.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+
+	_, err = fmt.Fprint(conn, "servers.web1.load 0.5 1700000000\nbroken\n")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		m, err := storage.Find(context.Background(), "load.host.web1", repository.GaugeName)
+		return err == nil && *m.Value == 0.5
+	}, 3*time.Second, 50*time.Millisecond)
+
+	t.Run("connection over the limit is closed", func(t *testing.T) {
+		extra, err := net.Dial("tcp", listen.Addr().String())
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, extra.Close())
+		}()
+
+		require.NoError(t, extra.SetReadDeadline(time.Now().Add(3*time.Second)))
+		_, err = extra.Read(make([]byte, 1))
+		require.Error(t, err)
+		require.False(t, isTimeout(err))
+	})
+
+	t.Run("last batch is saved on shutdown", func(t *testing.T) {
+		_, err = fmt.Fprint(conn, "servers.web2.load 2 1700000000\n")
+		require.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-served)
+
+		m, err := storage.Find(context.Background(), "load.host.web2", repository.GaugeName)
+		require.NoError(t, err)
+		require.InDelta(t, 2, *m.Value, 1e-9)
+	})
+}
+
+func TestGraphiteBatchLimit(t *testing.T) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	rules, err := ingest.ParseGraphiteRules("servers.*.load=load.host.$1")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage, err := repository.NewLimited(ctx, repository.NewMemory(), repository.Limits{MaxBatchSize: 5})
+	require.NoError(t, err)
+	gs := &GraphiteServer{Storage: storage, Graphite: ingest.NewGraphite(rules), Log: zap.NewNop()}
+
+	served := make(chan error)
+	go func() {
+		served <- gs.Serve(ctx, listen)
+	}()
+
+	conn, err := net.Dial("tcp", listen.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+
+	for i := range 12 {
+		_, err = fmt.Fprintf(conn, "servers.web%d.load %d 1700000000\n", i, i)
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		for i := range 12 {
+			if _, err := storage.Find(context.Background(), fmt.Sprintf("load.host.web%d", i), repository.GaugeName); err != nil {
+				return false
+			}
+		}
+		return true
+	}, 3*time.Second, 50*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-served)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
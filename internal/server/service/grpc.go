@@ -2,13 +2,25 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/arefev/mtrcstore/internal/proto"
 	"github.com/arefev/mtrcstore/internal/server/model"
 	"github.com/arefev/mtrcstore/internal/server/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
+var tracer = otel.Tracer("github.com/arefev/mtrcstore/internal/server/service")
+
 type GRPCServer struct {
 	proto.UnimplementedMetricsServer
 	Storage repository.Storage
@@ -18,8 +30,84 @@ func (gs *GRPCServer) UpdateMetric(
 	ctx context.Context,
 	in *proto.UpdateMetricRequest,
 ) (*proto.UpdateMetricResponse, error) {
-	metrics := make([]model.Metric, 0, len(in.GetMetrics()))
-	for _, m := range in.GetMetrics() {
+	ctx = withPeer(ctx)
+	metrics := metricsModel(in.GetMetrics())
+
+	if in.GetPartial() {
+		results, err := repository.MassSavePartial(ctx, gs.Storage, metrics)
+		if err != nil {
+			return &proto.UpdateMetricResponse{}, statusError("grpc update metric partial save failed", err)
+		}
+
+		return &proto.UpdateMetricResponse{Results: resultsProto(results)}, nil
+	}
+
+	if err := gs.Storage.MassSave(ctx, metrics); err != nil {
+		return &proto.UpdateMetricResponse{}, statusError("grpc update metric mass save failed", err)
+	}
+
+	return &proto.UpdateMetricResponse{}, nil
+}
+
+// StreamMetrics saves every received batch in the partial success mode and acknowledges it,
+// a batch that can not be processed as a whole is acknowledged with the status code of the error.
+func (gs *GRPCServer) StreamMetrics(stream proto.Metrics_StreamMetricsServer) error {
+	for {
+		batch, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("grpc stream metrics receive failed: %w", err)
+		}
+
+		if err := stream.Send(gs.saveBatch(withPeer(stream.Context()), batch)); err != nil {
+			return fmt.Errorf("grpc stream metrics send ack failed: %w", err)
+		}
+	}
+}
+
+// saveBatch traces every batch of the stream as a child of the span that sent it,
+// the stream itself is traced as a whole by the stats handler.
+func (gs *GRPCServer) saveBatch(ctx context.Context, batch *proto.MetricBatch) *proto.BatchAck {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(batch.GetTrace()))
+	ctx, span := tracer.Start(ctx, "GRPCServer.StreamMetrics batch", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int64("batch.seq", int64(batch.GetSeq())),
+		attribute.Int("metrics.count", len(batch.GetMetrics())),
+	)
+
+	ack := &proto.BatchAck{Seq: batch.GetSeq()}
+	results, err := repository.MassSavePartial(ctx, gs.Storage, metricsModel(batch.GetMetrics()))
+	if err != nil {
+		s := status.Convert(statusError("grpc stream metrics save failed", err))
+		ack.Code = uint32(s.Code())
+		ack.Error = s.Message()
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, s.Code().String())
+	} else {
+		ack.Results = resultsProto(results)
+	}
+
+	return ack
+}
+
+// withPeer names the source of the writes by the address of the gRPC client.
+func withPeer(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ctx
+	}
+
+	return repository.WithSource(ctx, host(p.Addr))
+}
+
+func metricsModel(in []*proto.Metric) []model.Metric {
+	metrics := make([]model.Metric, 0, len(in))
+	for _, m := range in {
 		value := m.GetValue()
 		delta := m.GetDelta()
 		metrics = append(metrics, model.Metric{
@@ -30,10 +118,42 @@ func (gs *GRPCServer) UpdateMetric(
 		})
 	}
 
-	err := gs.Storage.MassSave(ctx, metrics)
-	if err != nil {
-		return &proto.UpdateMetricResponse{}, fmt.Errorf("grpc update metric mass save failed: %w", err)
+	return metrics
+}
+
+func resultsProto(results []model.Result) []*proto.MetricResult {
+	out := make([]*proto.MetricResult, 0, len(results))
+	for _, r := range results {
+		out = append(out, &proto.MetricResult{
+			ID:       r.ID,
+			Type:     r.MType,
+			Accepted: r.Status == model.ResultAccepted,
+			Reason:   r.Reason,
+		})
 	}
 
-	return &proto.UpdateMetricResponse{}, nil
+	return out
+}
+
+// statusError maps the storage error to the gRPC status code.
+func statusError(msg string, err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, repository.ErrInvalid):
+		code = codes.InvalidArgument
+	case errors.Is(err, repository.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, repository.ErrBatchLimit), errors.Is(err, repository.ErrSeriesLimit):
+		code = codes.ResourceExhausted
+	case errors.Is(err, repository.ErrUnavailable):
+		code = codes.Unavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		code = codes.Internal
+	}
+
+	return status.Error(code, fmt.Sprintf("%s: %s", msg, err.Error()))
 }
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/proto"
+	"github.com/arefev/mtrcstore/internal/server/ingest"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	"github.com/arefev/mtrcstore/internal/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		err  error
+		name string
+		code codes.Code
+	}{
+		{name: "invalid metric", err: repository.ErrInvalid, code: codes.InvalidArgument},
+		{name: "invalid name", err: repository.ErrInvalidName, code: codes.InvalidArgument},
+		{name: "not found", err: fmt.Errorf("find: %w", repository.ErrNotFound), code: codes.NotFound},
+		{name: "batch limit", err: repository.ErrBatchLimit, code: codes.ResourceExhausted},
+		{name: "storage unavailable", err: repository.ErrUnavailable, code: codes.Unavailable},
+		{name: "deadline", err: context.DeadlineExceeded, code: codes.DeadlineExceeded},
+		{name: "unknown error", err: errors.New("test"), code: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := status.FromError(statusError("test", tt.err))
+			require.True(t, ok)
+			require.Equal(t, tt.code, s.Code())
+		})
+	}
+}
+
+func TestUpdateMetric(t *testing.T) {
+	t.Run("update metric with unknown type", func(t *testing.T) {
+		gs := &GRPCServer{Storage: repository.NewMemory()}
+		_, err := gs.UpdateMetric(context.Background(), &proto.UpdateMetricRequest{
+			Metrics: []*proto.Metric{{ID: "Alloc", Type: "test", Value: 1}},
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("update metric success", func(t *testing.T) {
+		gs := &GRPCServer{Storage: repository.NewMemory()}
+		_, err := gs.UpdateMetric(context.Background(), &proto.UpdateMetricRequest{
+			Metrics: []*proto.Metric{{ID: "Alloc", Type: "gauge", Value: 1}},
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestUpdateMetricPartial(t *testing.T) {
+	t.Run("update metric returns the status of every metric", func(t *testing.T) {
+		gs := &GRPCServer{Storage: repository.NewMemory()}
+		resp, err := gs.UpdateMetric(context.Background(), &proto.UpdateMetricRequest{
+			Metrics: []*proto.Metric{
+				{ID: "Alloc", Type: "gauge", Value: 1},
+				{ID: "Alloc", Type: "test", Value: 1},
+			},
+			Partial: true,
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.GetResults(), 2)
+		require.True(t, resp.GetResults()[0].GetAccepted())
+		require.False(t, resp.GetResults()[1].GetAccepted())
+		require.NotEmpty(t, resp.GetResults()[1].GetReason())
+	})
+}
+
+func TestStreamMetrics(t *testing.T) {
+	t.Run("stream metrics acknowledges every batch", func(t *testing.T) {
+		ctx := context.Background()
+		storage, err := repository.NewLimited(ctx, repository.NewMemory(), repository.Limits{MaxBatchSize: 2})
+		require.NoError(t, err)
+
+		lis := bufconn.Listen(1024 * 1024)
+		srv := grpc.NewServer()
+		proto.RegisterMetricsServer(srv, &GRPCServer{Storage: storage})
+		go func() {
+			_ = srv.Serve(lis)
+		}()
+		defer srv.Stop()
+
+		conn, err := grpc.NewClient(
+			"passthrough:///bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, conn.Close())
+		}()
+
+		stream, err := proto.NewMetricsClient(conn).StreamMetrics(ctx)
+		require.NoError(t, err)
+
+		err = stream.Send(&proto.MetricBatch{Seq: 1, Metrics: []*proto.Metric{
+			{ID: "Alloc", Type: "gauge", Value: 1},
+			{ID: "Alloc", Type: "test", Value: 1},
+		}})
+		require.NoError(t, err)
+
+		err = stream.Send(&proto.MetricBatch{Seq: 2, Metrics: []*proto.Metric{
+			{ID: "A", Type: "gauge"}, {ID: "B", Type: "gauge"}, {ID: "C", Type: "gauge"},
+		}})
+		require.NoError(t, err)
+		require.NoError(t, stream.CloseSend())
+
+		ack, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), ack.GetSeq())
+		require.Zero(t, ack.GetCode())
+		require.True(t, ack.GetResults()[0].GetAccepted())
+		require.False(t, ack.GetResults()[1].GetAccepted())
+
+		ack, err = stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), ack.GetSeq())
+		require.Equal(t, uint32(codes.ResourceExhausted), ack.GetCode())
+
+		_, err = stream.Recv()
+		require.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestSaveBatchTrace(t *testing.T) {
+	t.Run("batch span continues the agent trace", func(t *testing.T) {
+		_, err := tracing.Setup(context.Background(), tracing.Config{})
+		require.NoError(t, err)
+
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+		const traceID = "0af7651916cd43dd8448eb211c80319c"
+		gs := &GRPCServer{Storage: repository.NewMemory()}
+		ack := gs.saveBatch(context.Background(), &proto.MetricBatch{
+			Seq:     7,
+			Metrics: []*proto.Metric{{ID: "Alloc", Type: "gauge", Value: 1}},
+			Trace:   map[string]string{"traceparent": "00-" + traceID + "-b7ad6b7169203331-01"},
+		})
+		require.Equal(t, uint64(7), ack.GetSeq())
+		require.True(t, ack.GetResults()[0].GetAccepted())
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 1)
+		require.Equal(t, traceID, spans[0].SpanContext().TraceID().String())
+	})
+}
+
+func TestOTLPExport(t *testing.T) {
+	t.Run("otlp export saves the gauge", func(t *testing.T) {
+		ctx := context.Background()
+		storage := repository.NewMemory()
+		s := &OTLPServer{Storage: storage, OTLP: ingest.NewOTLP()}
+
+		resp, err := s.Export(ctx, &colmetrics.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metrics.ResourceMetrics{{
+				ScopeMetrics: []*metrics.ScopeMetrics{{
+					Metrics: []*metrics.Metric{{
+						Name: "Alloc",
+						Data: &metrics.Metric_Gauge{Gauge: &metrics.Gauge{DataPoints: []*metrics.NumberDataPoint{{
+							Value: &metrics.NumberDataPoint_AsDouble{AsDouble: 2.5},
+						}}}},
+					}},
+				}},
+			}},
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp.GetPartialSuccess())
+
+		m, err := storage.Find(ctx, "Alloc", repository.GaugeName)
+		require.NoError(t, err)
+		require.InDelta(t, 2.5, *m.Value, 1e-9)
+	})
+
+	t.Run("otlp export maps the storage error", func(t *testing.T) {
+		ctx := context.Background()
+		storage, err := repository.NewLimited(ctx, repository.NewMemory(), repository.Limits{MaxBatchSize: 1})
+		require.NoError(t, err)
+		s := &OTLPServer{Storage: storage, OTLP: ingest.NewOTLP()}
+
+		gauge := &metrics.Metric_Gauge{Gauge: &metrics.Gauge{DataPoints: []*metrics.NumberDataPoint{{}, {}}}}
+		_, err = s.Export(ctx, &colmetrics.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metrics.ResourceMetrics{{
+				ScopeMetrics: []*metrics.ScopeMetrics{{
+					Metrics: []*metrics.Metric{{Name: "Alloc", Data: gauge}},
+				}},
+			}},
+		})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+}
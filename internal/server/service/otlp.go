@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+
+	"github.com/arefev/mtrcstore/internal/server/ingest"
+	"github.com/arefev/mtrcstore/internal/server/repository"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+)
+
+// OTLPServer receives the OTLP/gRPC metric exports next to the Metrics service.
+type OTLPServer struct {
+	colmetrics.UnimplementedMetricsServiceServer
+	Storage repository.Storage
+	OTLP    *ingest.OTLP
+}
+
+func (s *OTLPServer) Export(
+	ctx context.Context,
+	in *colmetrics.ExportMetricsServiceRequest,
+) (*colmetrics.ExportMetricsServiceResponse, error) {
+	resp, err := s.OTLP.Export(ctx, s.Storage, in)
+	if err != nil {
+		return nil, statusError("grpc otlp export failed", err)
+	}
+
+	return resp, nil
+}
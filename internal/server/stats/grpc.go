@@ -0,0 +1,37 @@
+package stats
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor records the latency and the status code of every unary call.
+func (reg *Registry) UnaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	reg.ObserveGRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+
+	return resp, err
+}
+
+// StreamInterceptor records the lifetime and the status code of every stream.
+func (reg *Registry) StreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	reg.ObserveGRPC(info.FullMethod, status.Code(err).String(), time.Since(start))
+
+	return err
+}
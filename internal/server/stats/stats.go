@@ -0,0 +1,207 @@
+// The stats package collects the operational metrics of the server itself.
+package stats
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix is reserved for the internal metrics the server writes into its own storage.
+const Prefix = "mtrcstore."
+
+// buckets are the upper bounds of the latency histograms in seconds.
+var buckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Histogram is a snapshot of the latencies of one kind of operation.
+type Histogram struct {
+	Buckets map[string]int64 `json:"buckets"` // cumulative counts by the upper bound in seconds
+	Count   int64            `json:"count"`
+	Sum     float64          `json:"sum"` // total duration in seconds
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	h.count++
+	h.sum += seconds
+	for i, bound := range buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Buckets: make(map[string]int64, len(buckets)+1),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	for i, bound := range buckets {
+		s.Buckets[strconv.FormatFloat(bound, 'f', -1, 64)] = h.counts[i]
+	}
+	s.Buckets["+Inf"] = h.count
+
+	return s
+}
+
+// group keeps the histograms by the labels joined with a space.
+type group map[string]*histogram
+
+func (g group) observe(d time.Duration, labels ...string) {
+	key := strings.Join(labels, " ")
+	h, ok := g[key]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(buckets))}
+		g[key] = h
+	}
+	h.observe(d)
+}
+
+func (g group) snapshot() map[string]Histogram {
+	s := make(map[string]Histogram, len(g))
+	for key, h := range g {
+		s[key] = h.snapshot()
+	}
+
+	return s
+}
+
+// Snapshot is the content of the stats endpoint.
+type Snapshot struct {
+	Pool      *sql.DBStats         `json:"db_pool,omitempty"`
+	Requests  map[string]Histogram `json:"requests"`  // by "method route status"
+	Storage   map[string]Histogram `json:"storage"`   // by "backend method"
+	GRPC      map[string]Histogram `json:"grpc"`      // by "method code"
+	Snapshots map[string]Histogram `json:"snapshots"` // by "result"
+}
+
+// Registry collects the stats, it is safe for concurrent use.
+type Registry struct {
+	requests  group
+	storage   group
+	grpc      group
+	snapshots group
+	pool      func() sql.DBStats
+	mutex     *sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		requests:  make(group),
+		storage:   make(group),
+		grpc:      make(group),
+		snapshots: make(group),
+		mutex:     &sync.Mutex{},
+	}
+}
+
+func (reg *Registry) ObserveRequest(method, route string, status int, d time.Duration) {
+	reg.observe(reg.requests, d, method, route, strconv.Itoa(status))
+}
+
+func (reg *Registry) ObserveStorage(backend, method string, d time.Duration) {
+	reg.observe(reg.storage, d, backend, method)
+}
+
+func (reg *Registry) ObserveGRPC(method, code string, d time.Duration) {
+	reg.observe(reg.grpc, d, method, code)
+}
+
+func (reg *Registry) ObserveSnapshot(err error, d time.Duration) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	reg.observe(reg.snapshots, d, result)
+}
+
+// SetPool registers the source of the database connection pool stats.
+func (reg *Registry) SetPool(pool func() sql.DBStats) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	reg.pool = pool
+}
+
+func (reg *Registry) observe(g group, d time.Duration, labels ...string) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	g.observe(d, labels...)
+}
+
+func (reg *Registry) Snapshot() Snapshot {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	s := Snapshot{
+		Requests:  reg.requests.snapshot(),
+		Storage:   reg.storage.snapshot(),
+		GRPC:      reg.grpc.snapshot(),
+		Snapshots: reg.snapshots.snapshot(),
+	}
+
+	if reg.pool != nil {
+		pool := reg.pool()
+		s.Pool = &pool
+	}
+
+	return s
+}
+
+// Gauges flattens the snapshot into gauges named under Prefix, so they can be kept in the storage.
+func (s Snapshot) Gauges() map[string]float64 {
+	gauges := make(map[string]float64)
+	add := func(kind string, histograms map[string]Histogram) {
+		keys := make([]string, 0, len(histograms))
+		for key := range histograms {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			name := Prefix + kind + "." + sanitize(key)
+			gauges[name+".count"] = float64(histograms[key].Count)
+			gauges[name+".seconds"] = histograms[key].Sum
+		}
+	}
+
+	add("http", s.Requests)
+	add("storage", s.Storage)
+	add("grpc", s.GRPC)
+	add("snapshot", s.Snapshots)
+
+	if s.Pool != nil {
+		gauges[Prefix+"db.open_connections"] = float64(s.Pool.OpenConnections)
+		gauges[Prefix+"db.in_use"] = float64(s.Pool.InUse)
+		gauges[Prefix+"db.idle"] = float64(s.Pool.Idle)
+		gauges[Prefix+"db.wait_count"] = float64(s.Pool.WaitCount)
+		gauges[Prefix+"db.wait_seconds"] = s.Pool.WaitDuration.Seconds()
+	}
+
+	return gauges
+}
+
+// sanitize keeps the characters allowed in metric names and replaces the rest with "_".
+func sanitize(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == ':':
+			return r
+		case r == ' ':
+			return '.'
+		default:
+			return '_'
+		}
+	}, key)
+}
@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("histograms are cumulative", func(t *testing.T) {
+		reg := NewRegistry()
+		reg.ObserveRequest("POST", "/update/", 200, 2*time.Millisecond)
+		reg.ObserveRequest("POST", "/update/", 200, 200*time.Millisecond)
+		reg.ObserveRequest("POST", "/update/", 400, time.Millisecond)
+
+		s := reg.Snapshot()
+		require.Len(t, s.Requests, 2)
+
+		h := s.Requests["POST /update/ 200"]
+		require.Equal(t, int64(2), h.Count)
+		require.InDelta(t, 0.202, h.Sum, 1e-9)
+		require.Equal(t, int64(0), h.Buckets["0.001"])
+		require.Equal(t, int64(1), h.Buckets["0.005"])
+		require.Equal(t, int64(2), h.Buckets["0.5"])
+		require.Equal(t, int64(2), h.Buckets["+Inf"])
+	})
+
+	t.Run("snapshots and pool", func(t *testing.T) {
+		reg := NewRegistry()
+		reg.ObserveSnapshot(nil, time.Millisecond)
+		reg.ObserveSnapshot(errors.New("disk full"), time.Millisecond)
+		reg.SetPool(func() sql.DBStats {
+			return sql.DBStats{OpenConnections: 3, InUse: 1, Idle: 2}
+		})
+
+		s := reg.Snapshot()
+		require.Equal(t, int64(1), s.Snapshots["ok"].Count)
+		require.Equal(t, int64(1), s.Snapshots["failed"].Count)
+		require.NotNil(t, s.Pool)
+		require.Equal(t, 3, s.Pool.OpenConnections)
+	})
+}
+
+func TestGauges(t *testing.T) {
+	reg := NewRegistry()
+	reg.ObserveRequest("GET", "/value/{type}/{name}", 404, time.Second)
+	reg.ObserveStorage("memory", "Find", time.Second)
+	reg.SetPool(func() sql.DBStats {
+		return sql.DBStats{InUse: 4}
+	})
+
+	gauges := reg.Snapshot().Gauges()
+	require.Equal(t, map[string]float64{
+		"mtrcstore.http.GET._value__type___name_.404.count":   1,
+		"mtrcstore.http.GET._value__type___name_.404.seconds": 1,
+		"mtrcstore.storage.memory.Find.count":                 1,
+		"mtrcstore.storage.memory.Find.seconds":               1,
+		"mtrcstore.db.open_connections":                       0,
+		"mtrcstore.db.in_use":                                 4,
+		"mtrcstore.db.idle":                                   0,
+		"mtrcstore.db.wait_count":                             0,
+		"mtrcstore.db.wait_seconds":                           0,
+	}, gauges)
+}
+
+func TestInterceptors(t *testing.T) {
+	reg := NewRegistry()
+
+	_, err := reg.UnaryInterceptor(
+		context.Background(),
+		nil,
+		&grpc.UnaryServerInfo{FullMethod: "/proto.Metrics/UpdateMetric"},
+		func(context.Context, any) (any, error) {
+			return nil, status.Error(codes.InvalidArgument, "bad metric")
+		},
+	)
+	require.Error(t, err)
+
+	err = reg.StreamInterceptor(
+		nil,
+		nil,
+		&grpc.StreamServerInfo{FullMethod: "/proto.Metrics/StreamMetrics"},
+		func(any, grpc.ServerStream) error {
+			return nil
+		},
+	)
+	require.NoError(t, err)
+
+	s := reg.Snapshot()
+	require.Equal(t, int64(1), s.GRPC["/proto.Metrics/UpdateMetric InvalidArgument"].Count)
+	require.Equal(t, int64(1), s.GRPC["/proto.Metrics/StreamMetrics OK"].Count)
+}
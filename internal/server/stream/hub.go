@@ -0,0 +1,95 @@
+// Package stream delivers the saved metrics to the live subscribers.
+package stream
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+)
+
+// bufferSize is the number of metrics a subscriber may lag behind before the new ones are dropped.
+const bufferSize = 256
+
+// Filter selects the metrics of a subscription, the zero filter selects all of them.
+type Filter struct {
+	Name *regexp.Regexp // pattern of the metric names, nil for any name
+	Type string         // gauge or counter, empty for both
+}
+
+func (f Filter) Match(m model.Metric) bool {
+	if f.Type != "" && f.Type != m.MType {
+		return false
+	}
+
+	return f.Name == nil || f.Name.MatchString(m.ID)
+}
+
+// Subscription receives the matching metrics on C until it is closed.
+type Subscription struct {
+	C       <-chan model.Metric
+	c       chan model.Metric
+	hub     *Hub
+	filter  Filter
+	dropped atomic.Int64
+}
+
+// Dropped returns the number of metrics lost because the subscriber was too slow.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes and closes C, the metrics already queued can still be read.
+func (s *Subscription) Close() {
+	s.hub.mutex.Lock()
+	defer s.hub.mutex.Unlock()
+
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.c)
+	}
+}
+
+// Hub fans the saved metrics out to the subscriptions, it is the storage notifier of the live stream.
+// The write path never waits for a subscriber: a full subscription misses the metric.
+type Hub struct {
+	subs  map[*Subscription]struct{}
+	mutex sync.RWMutex
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+func (h *Hub) Subscribe(f Filter) *Subscription {
+	c := make(chan model.Metric, bufferSize)
+	s := &Subscription{C: c, c: c, hub: h, filter: f}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+func (h *Hub) Notify(_ context.Context, elems []model.Metric) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for s := range h.subs {
+		for _, m := range elems {
+			if !s.filter.Match(m) {
+				continue
+			}
+
+			select {
+			case s.c <- m:
+			default:
+				s.dropped.Add(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/arefev/mtrcstore/internal/server/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	value, delta := 1.0, int64(1)
+	alloc := model.Metric{ID: "Alloc", MType: "gauge", Value: &value}
+	poll := model.Metric{ID: "PollCount", MType: "counter", Delta: &delta}
+	ctx := context.Background()
+
+	h := NewHub()
+	all := h.Subscribe(Filter{})
+	gauges := h.Subscribe(Filter{Type: "gauge"})
+	polls := h.Subscribe(Filter{Name: regexp.MustCompile("^Poll")})
+
+	h.Notify(ctx, []model.Metric{alloc, poll})
+
+	require.Equal(t, alloc, <-all.C)
+	require.Equal(t, poll, <-all.C)
+	require.Equal(t, alloc, <-gauges.C)
+	require.Len(t, gauges.C, 0)
+	require.Equal(t, poll, <-polls.C)
+
+	t.Run("slow subscriber drops", func(t *testing.T) {
+		for range bufferSize + 2 {
+			h.Notify(ctx, []model.Metric{poll})
+		}
+		require.Equal(t, int64(2), polls.Dropped())
+	})
+
+	t.Run("closed subscription", func(t *testing.T) {
+		all.Close()
+		all.Close()
+		h.Notify(ctx, []model.Metric{alloc})
+
+		n := 0
+		for range all.C {
+			n++
+		}
+		require.Equal(t, bufferSize, n)
+	})
+}
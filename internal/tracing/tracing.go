@@ -0,0 +1,73 @@
+// The tracing package sets up OpenTelemetry tracing shared by the agent and the server.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	ExporterNone   = ""
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+// Config chooses where the spans go, an empty Exporter keeps tracing disabled.
+type Config struct {
+	Exporter string
+	Endpoint string // host:port of the OTLP gRPC collector
+	Service  string
+}
+
+// Shutdown flushes the spans left in the buffer and stops the exporter.
+type Shutdown func(ctx context.Context) error
+
+// Setup installs the global tracer provider and the W3C trace context propagator.
+// The propagator is installed even when the tracing is disabled,
+// so the trace context received from the clients still reaches the next hop.
+func Setup(ctx context.Context, c Config) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch c.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		exporter, err = otlptracegrpc.New(ctx,
+			otlptracegrpc.WithEndpoint(c.Endpoint),
+			otlptracegrpc.WithInsecure(),
+		)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownExporter, c.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("tracing exporter init failed: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(c.Service))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		err      error
+		name     string
+		exporter string
+	}{
+		{name: "disabled", exporter: ExporterNone},
+		{name: "stdout", exporter: ExporterStdout},
+		{name: "otlp", exporter: ExporterOTLP},
+		{name: "unknown exporter", exporter: "zipkin", err: ErrUnknownExporter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			shutdown, err := Setup(ctx, Config{
+				Exporter: tt.exporter,
+				Endpoint: "localhost:4317",
+				Service:  "test",
+			})
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, shutdown(ctx))
+
+			fields := otel.GetTextMapPropagator().Fields()
+			require.Contains(t, fields, "traceparent")
+			require.Contains(t, fields, "baggage")
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	_, err := Setup(context.Background(), Config{})
+	require.NoError(t, err)
+
+	carrier := propagation.MapCarrier{
+		"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+
+	out := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, out)
+	require.Equal(t, carrier["traceparent"], out["traceparent"])
+}